@@ -4,6 +4,8 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"os"
@@ -11,10 +13,16 @@ import (
 	"syscall"
 
 	"github.com/fitstack/fitstack-payments/config"
+	"github.com/fitstack/fitstack-payments/internal/adapters/credcache"
 	"github.com/fitstack/fitstack-payments/internal/adapters/django"
+	"github.com/fitstack/fitstack-payments/internal/adapters/eventhub"
 	"github.com/fitstack/fitstack-payments/internal/adapters/mercadopago"
+	"github.com/fitstack/fitstack-payments/internal/adapters/sqlstore"
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
 	"github.com/fitstack/fitstack-payments/internal/core/service"
 	"github.com/fitstack/fitstack-payments/internal/handlers"
+	"github.com/fitstack/fitstack-payments/internal/signing"
 )
 
 func main() {
@@ -22,27 +30,188 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
-	log.Printf("Config: Port=%s, Django=%s", cfg.Server.Port, cfg.Django.BaseURL)
+	log.Printf("Config: Env=%s, Port=%s, Django=%s, Database=%s, PublicURL=%s",
+		cfg.Server.Environment, cfg.Server.Port, cfg.Django.BaseURL, cfg.Database.Driver, cfg.Webhook.PublicBaseURL)
 
 	// Wire up dependencies (Clean Architecture)
 	// ============================================
 
 	// Adapters (Infrastructure Layer)
 	mpAdapter := mercadopago.NewAdapter()
-	mpValidator := mercadopago.NewWebhookValidator()
-	djangoClient := django.NewClient(cfg.Django.BaseURL, cfg.Django.APIKey)
+	mpValidator := mercadopago.NewWebhookValidator(cfg.Webhook.SignatureTolerance)
+	var signingSecret string
+	if len(cfg.Django.SigningSecrets) > 0 {
+		signingSecret = cfg.Django.SigningSecrets[0]
+	}
+	djangoClient := django.NewClient(cfg.Django.BaseURL, cfg.Django.APIKey, signing.NewSigner(signingSecret))
+	db, err := sqlstore.Open(context.Background(), cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Fatalf("Database error: %v", err)
+	}
+	defer db.Close()
+
+	// Gyms connected through OAuth use their stored tokens, the rest Django's
+	oauthClient := mercadopago.NewOAuthClient(cfg.OAuth.ClientID, cfg.OAuth.ClientSecret, cfg.OAuth.RedirectURI)
+	var oauthTokenRepo *sqlstore.OAuthTokenRepository
+	var credentialSource ports.GymCredentialProvider = djangoClient
+	if cfg.OAuth.TokenKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.OAuth.TokenKey)
+		if err != nil {
+			log.Fatalf("Invalid MP_OAUTH_TOKEN_KEY (expected base64): %v", err)
+		}
+		oauthTokenRepo, err = sqlstore.NewOAuthTokenRepository(db, key)
+		if err != nil {
+			log.Fatalf("OAuth token store error: %v", err)
+		}
+		credentialSource = service.NewOAuthCredentialProvider(oauthTokenRepo, djangoClient, domain.WebhookSecrets{
+			Current:           cfg.OAuth.WebhookSecret,
+			Previous:          cfg.OAuth.PreviousWebhookSecret,
+			PreviousExpiresAt: cfg.OAuth.PreviousWebhookSecretExpiresAt,
+		})
+	} else if oauthClient.Configured() {
+		log.Fatalf("MP_OAUTH_TOKEN_KEY is required when MP_CLIENT_ID and MP_CLIENT_SECRET are set")
+	}
+	credentials, err := credcache.New(credentialSource, cfg.Django.CredentialCacheTTL, cfg.Django.CredentialNegativeTTL)
+	if err != nil {
+		log.Fatalf("Credential cache error: %v", err)
+	}
+	tenantTokens := mercadopago.NewTenantTokenSigner(cfg.Webhook.TenantTokenSecret)
+
+	paymentRepo := sqlstore.NewPaymentRepository(db)
+	idempotencyRepo := sqlstore.NewIdempotencyRepository(db)
+	webhookEventRepo := sqlstore.NewWebhookEventRepository(db)
+	outboxRepo := sqlstore.NewOutboxRepository(db)
+	subscriptionRepo := sqlstore.NewSubscriptionRepository(db)
+	nonceRepo := sqlstore.NewNonceRepository(db)
+	reconciliationRepo := sqlstore.NewReconciliationRepository(db)
 
 	// Service Layer
+	settingsResolver := service.NewGymSettingsResolver(
+		djangoClient, // GymSettingsProvider
+		domain.GymDefaults{
+			SiteID:              cfg.Gyms.DefaultSiteID,
+			FrontendURL:         cfg.Gyms.FrontendURL,
+			NotificationBaseURL: cfg.Webhook.PublicBaseURL,
+		},
+		tenantTokens,                   // TenantTokenSigner
+		cfg.Webhook.RequireTenantToken, // reject webhooks without a token
+		cfg.Django.SettingsCacheTTL,
+	)
+	accessTokens := service.NewAccessTokenResolver(
+		credentials, // GymCredentialProvider
+		cfg.Auth.AllowInBodyAccessToken,
+	)
+	subscriptionService := service.NewSubscriptionService(
+		mpAdapter,        // SubscriptionGateway
+		credentials,      // GymCredentialProvider
+		accessTokens,     // AccessTokenResolver
+		subscriptionRepo, // SubscriptionRepository
+		webhookEventRepo, // WebhookEventRepository
+		outboxRepo,       // OutboxRepository
+		db,               // Transactor
+		settingsResolver, // GymSettingsResolver
+	)
+	eventHub := eventhub.New(cfg.Events.SubscriberBuffer)
 	paymentService := service.NewPaymentService(
-		mpAdapter,      // PaymentGateway
-		djangoClient,   // GymCredentialProvider
-		djangoClient,   // DjangoNotifier
-		mpValidator,    // WebhookValidator
+		mpAdapter,           // PaymentGateway
+		credentials,         // GymCredentialProvider
+		accessTokens,        // AccessTokenResolver
+		mpValidator,         // WebhookValidator
+		paymentRepo,         // PaymentRepository
+		idempotencyRepo,     // IdempotencyRepository
+		webhookEventRepo,    // WebhookEventRepository
+		outboxRepo,          // OutboxRepository
+		db,                  // Transactor
+		settingsResolver,    // GymSettingsResolver
+		subscriptionService, // SubscriptionService (webhooks)
+		eventHub,            // PaymentEventBus (live status)
+		cfg.Webhook.AllowUnsignedIPN,
+	)
+	deliveryService := service.NewDeliveryService(outboxRepo)
+	oauthService := service.NewOAuthService(
+		oauthClient,    // OAuthGateway
+		oauthTokenRepo, // OAuthTokenRepository
+		nonceRepo,      // NonceStore (single-use state)
+		credentials,    // CredentialInvalidator
+		cfg.OAuth.StateSecret,
+		cfg.OAuth.StateTTL,
 	)
 
+	reconciliationService := service.NewReconciliationService(
+		mpAdapter,          // PaymentGateway
+		credentials,        // GymCredentialProvider
+		paymentService,     // PaymentService (records and notifies)
+		paymentRepo,        // PaymentRepository
+		outboxRepo,         // OutboxRepository
+		reconciliationRepo, // ReconciliationRepository
+		cfg.Reconcile.Window,
+		cfg.Reconcile.PageSize,
+	)
+
+	// Background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	outboxDispatcher := service.NewOutboxDispatcher(
+		outboxRepo,   // OutboxRepository
+		djangoClient, // DjangoNotifier
+		service.RetryPolicy{
+			MaxAttempts: cfg.Outbox.MaxAttempts,
+			BaseDelay:   cfg.Outbox.BaseDelay,
+			MaxDelay:    cfg.Outbox.MaxDelay,
+		},
+		cfg.Outbox.PollInterval,
+		cfg.Outbox.BatchSize,
+		django.RequestTimeout,
+	)
+	go outboxDispatcher.Run(workerCtx)
+
+	if oauthClient.Configured() {
+		oauthRefresher := service.NewOAuthRefresher(
+			oauthService,
+			cfg.OAuth.RefreshInterval,
+			cfg.OAuth.RefreshWindow,
+			cfg.Outbox.BatchSize,
+		)
+		go oauthRefresher.Run(workerCtx)
+	} else {
+		log.Println("Mercado Pago OAuth not configured (MP_CLIENT_ID, MP_CLIENT_SECRET), onboarding disabled")
+	}
+
+	if cfg.Reconcile.Interval > 0 {
+		reconciler := service.NewReconciler(
+			reconciliationService,
+			cfg.Reconcile.Interval,
+			cfg.Outbox.BatchSize,
+		)
+		go reconciler.Run(workerCtx)
+	} else {
+		log.Println("Reconciliation disabled (RECONCILE_INTERVAL=0)")
+	}
+
 	// Handlers (Interface Layer)
-	paymentHandler := handlers.NewPaymentHandler(paymentService)
-	router := handlers.SetupRouter(paymentHandler, cfg.Server.GinMode)
+	paymentHandler := handlers.NewPaymentHandler(paymentService, cfg.Events.HeartbeatInterval)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
+	deliveryHandler := handlers.NewDeliveryHandler(deliveryService)
+	credentialHandler := handlers.NewCredentialHandler(credentials)
+	oauthHandler := handlers.NewOAuthHandler(oauthService, cfg.OAuth.ReturnURL)
+	reconciliationHandler := handlers.NewReconciliationHandler(reconciliationService)
+	serviceKeys := make([]handlers.ServiceKey, 0, len(cfg.Auth.ServiceKeys))
+	for _, k := range cfg.Auth.ServiceKeys {
+		serviceKeys = append(serviceKeys, handlers.ServiceKey{ID: k.ID, Key: k.Key, Scopes: k.Scopes})
+	}
+	if len(serviceKeys) == 0 {
+		log.Println("WARNING: no service API keys configured (PAYMENTS_SERVICE_API_KEYS), authenticated endpoints reject every request")
+	}
+	signature := handlers.SignatureConfig{
+		Secrets:   cfg.Django.SigningSecrets,
+		Tolerance: cfg.Django.SignatureTolerance,
+		Nonces:    nonceRepo,
+	}
+	if len(signature.Secrets) == 0 {
+		log.Println("WARNING: DJANGO_SIGNING_SECRETS not set, Django requests and callbacks are not signed")
+	}
+	router := handlers.SetupRouter(paymentHandler, subscriptionHandler, deliveryHandler, credentialHandler, oauthHandler, reconciliationHandler, serviceKeys, signature, cfg.Server.GinMode)
 
 	// Start server
 	serverAddr := fmt.Sprintf(":%s", cfg.Server.Port)
@@ -59,4 +228,5 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down...")
+	stopWorkers()
 }
@@ -0,0 +1,142 @@
+// FitStack Payments backfill
+//
+// Imports a gym's existing Mercado Pago payments into the ledger and
+// optionally queues them for Django as payment.imported events.
+//
+//	go run ./cmd/backfill -gym level-gym -from 2025-06-01 -to 2026-01-01 [-replay] [-dry-run]
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/config"
+	"github.com/fitstack/fitstack-payments/internal/adapters/django"
+	"github.com/fitstack/fitstack-payments/internal/adapters/mercadopago"
+	"github.com/fitstack/fitstack-payments/internal/adapters/sqlstore"
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+	"github.com/fitstack/fitstack-payments/internal/core/service"
+	"github.com/fitstack/fitstack-payments/internal/signing"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run runs the backfill and returns the process exit code, so deferred
+// cleanup runs before the process exits.
+func run() int {
+	var (
+		gymSlug  = flag.String("gym", "", "gym slug (required)")
+		from     = flag.String("from", "", "first creation date, YYYY-MM-DD or RFC 3339 (required)")
+		to       = flag.String("to", "", "end of the range, exclusive for dates; defaults to now")
+		replay   = flag.Bool("replay", false, "queue each imported payment for Django as payment.imported")
+		dryRun   = flag.Bool("dry-run", false, "only report what would be imported")
+		pageSize = flag.Int("page-size", 50, "payments fetched per Mercado Pago search request")
+	)
+	flag.Parse()
+
+	req := domain.BackfillRequest{GymSlug: *gymSlug, Replay: *replay, DryRun: *dryRun, To: time.Now()}
+	var err error
+	if req.From, err = parseDate(*from); err != nil {
+		return usage("invalid -from: %v", err)
+	}
+	if *to != "" {
+		if req.To, err = parseDate(*to); err != nil {
+			return usage("invalid -to: %v", err)
+		}
+	}
+	if req.GymSlug == "" {
+		return usage("-gym is required")
+	}
+
+	cfg := config.Load()
+
+	// Same adapters as the API server
+	mpAdapter := mercadopago.NewAdapter()
+	var signingSecret string
+	if len(cfg.Django.SigningSecrets) > 0 {
+		signingSecret = cfg.Django.SigningSecrets[0]
+	}
+	djangoClient := django.NewClient(cfg.Django.BaseURL, cfg.Django.APIKey, signing.NewSigner(signingSecret))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sqlstore.Open(ctx, cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	// Gyms connected through OAuth use their stored tokens, the rest Django's
+	var credentials ports.GymCredentialProvider = djangoClient
+	if cfg.OAuth.TokenKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.OAuth.TokenKey)
+		if err != nil {
+			log.Printf("Invalid MP_OAUTH_TOKEN_KEY (expected base64): %v", err)
+			return 1
+		}
+		oauthTokenRepo, err := sqlstore.NewOAuthTokenRepository(db, key)
+		if err != nil {
+			log.Printf("OAuth token store error: %v", err)
+			return 1
+		}
+		credentials = service.NewOAuthCredentialProvider(oauthTokenRepo, djangoClient, domain.WebhookSecrets{})
+	}
+
+	backfill := service.NewBackfillService(
+		mpAdapter,                         // PaymentGateway
+		credentials,                       // GymCredentialProvider
+		sqlstore.NewPaymentRepository(db), // PaymentRepository
+		db,                                // Transactor
+		sqlstore.NewOutboxRepository(db),  // OutboxRepository
+		*pageSize,
+	)
+
+	mode := "import"
+	if req.Replay {
+		mode = "import and replay"
+	}
+	if req.DryRun {
+		mode += " (dry run)"
+	}
+	log.Printf("Backfill of gym %s: payments created from %s to %s, %s",
+		req.GymSlug, req.From.Format(time.RFC3339), req.To.Format(time.RFC3339), mode)
+
+	result, err := backfill.Backfill(ctx, req)
+	log.Printf("Backfill of gym %s: %d found, %d imported, %d already recorded, %d without external reference, %d replays queued",
+		req.GymSlug, result.Found, result.Imported, result.AlreadyRecorded, result.Skipped, result.Replayed)
+	if err != nil {
+		log.Printf("Backfill stopped: %v", err)
+		return 1
+	}
+	if result.Replayed > 0 && !req.DryRun {
+		log.Println("Replays are delivered to Django by the server's outbox dispatcher")
+	}
+	return 0
+}
+
+// parseDate parses a YYYY-MM-DD date (midnight UTC) or an RFC 3339 time.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// usage reports a flag error and returns the exit code for it.
+func usage(format string, args ...any) int {
+	fmt.Fprintf(os.Stderr, format+"\n\n", args...)
+	flag.Usage()
+	return 2
+}
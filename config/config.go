@@ -1,43 +1,350 @@
 // Package config handles application configuration.
 package config
 
-import "os"
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Config holds all configuration values.
 type Config struct {
-	Server  ServerConfig
-	Django  DjangoConfig
+	Server    ServerConfig
+	Django    DjangoConfig
+	Database  DatabaseConfig
+	Webhook   WebhookConfig
+	Outbox    OutboxConfig
+	Gyms      GymsConfig
+	Auth      AuthConfig
+	OAuth     OAuthConfig
+	Events    EventsConfig
+	Reconcile ReconcileConfig
 }
 
 // ServerConfig holds HTTP server configuration.
 type ServerConfig struct {
 	Port    string
 	GinMode string
+	// Environment is "production", "staging", "local", etc.
+	Environment string
 }
 
 // DjangoConfig holds Django backend configuration.
 type DjangoConfig struct {
 	BaseURL string
 	APIKey  string
+	// CredentialCacheTTL is how long gym credentials are cached (0 disables).
+	CredentialCacheTTL time.Duration
+	// CredentialNegativeTTL is how long an unknown gym is remembered.
+	CredentialNegativeTTL time.Duration
+	// SettingsCacheTTL is how long gym checkout settings are cached (0 disables).
+	SettingsCacheTTL time.Duration
+	// SigningSecrets are the HMAC secrets shared with Django. The first signs
+	// outgoing requests; all are accepted on incoming ones (rotation).
+	// Empty disables request signing.
+	SigningSecrets []string
+	// SignatureTolerance is the maximum clock skew of a signed request.
+	SignatureTolerance time.Duration
+}
+
+// DatabaseConfig holds payment ledger database configuration.
+// Driver is "sqlite3" for local development or "pgx" for Postgres.
+type DatabaseConfig struct {
+	Driver string
+	URL    string
+}
+
+// WebhookConfig holds Mercado Pago webhook handling configuration.
+type WebhookConfig struct {
+	// SignatureTolerance is the maximum age of a signed x-signature ts.
+	// Zero disables the check.
+	SignatureTolerance time.Duration
+	// PublicBaseURL is where Mercado Pago reaches this service; the
+	// notification_url of every preference is built from it.
+	PublicBaseURL string
+	// TenantTokenSecret signs a tenant_token query parameter embedded in
+	// notification URLs. Empty disables tenant tokens.
+	TenantTokenSecret string
+	// RequireTenantToken rejects webhooks without a tenant_token.
+	RequireTenantToken bool
+	// AllowUnsignedIPN accepts topic-style IPN (?topic=...&id=...) without
+	// x-signature. The notified resource is always fetched from MP.
+	AllowUnsignedIPN bool
+}
+
+// OutboxConfig holds the Django notification dispatcher configuration.
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+}
+
+// EventsConfig holds the live payment events (SSE) configuration.
+type EventsConfig struct {
+	// SubscriberBuffer is how many events a slow stream may lag behind
+	// before it misses some.
+	SubscriberBuffer int
+	// HeartbeatInterval is how often idle streams get a keep-alive comment,
+	// so proxies do not close them.
+	HeartbeatInterval time.Duration
+}
+
+// ReconcileConfig holds the Mercado Pago reconciliation worker configuration.
+type ReconcileConfig struct {
+	// Interval is how often each gym is reconciled; zero disables the worker.
+	Interval time.Duration
+	// Window is how far back each run looks for updated payments. It should
+	// exceed Interval so consecutive runs overlap.
+	Window time.Duration
+	// PageSize is how many payments are searched per MP request.
+	PageSize int
+}
+
+// GymsConfig holds the checkout defaults for gyms without their own settings.
+type GymsConfig struct {
+	// DefaultSiteID is the Mercado Pago site (country), e.g. "MLA".
+	DefaultSiteID string
+	// FrontendURL is the base of the default back URLs.
+	FrontendURL string
+}
+
+// AuthConfig holds the API keys Django and operators call this service with.
+type AuthConfig struct {
+	ServiceKeys []ServiceKey
+	// AllowInBodyAccessToken still accepts the deprecated mp_access_token
+	// request field; when false the token is only looked up server-side.
+	AllowInBodyAccessToken bool
+}
+
+// ServiceKey is one accepted Bearer key. Several keys can be active at once
+// so a key can be rotated without downtime.
+type ServiceKey struct {
+	// ID identifies the key in logs; the key itself is never logged.
+	ID  string
+	Key string
+	// Scopes limits the route groups the key may call; empty allows all.
+	Scopes []string
+}
+
+// OAuthConfig holds the Mercado Pago OAuth application gyms connect through.
+// OAuth onboarding is disabled unless ClientID and ClientSecret are set.
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectURI must match the redirect URL registered for the application.
+	RedirectURI string
+	// ReturnURL is where admins land after connecting; "{gym_slug}" is replaced.
+	ReturnURL string
+	// StateSecret signs the state parameter of the flow.
+	StateSecret string
+	StateTTL    time.Duration
+	// TokenKey is the base64 AES-256 key tokens are encrypted with at rest.
+	TokenKey string
+	// WebhookSecret is the application's webhook secret, used to validate
+	// notifications of OAuth-connected gyms. While it is rotated,
+	// PreviousWebhookSecret is accepted until PreviousWebhookSecretExpiresAt.
+	WebhookSecret                  string
+	PreviousWebhookSecret          string
+	PreviousWebhookSecretExpiresAt time.Time
+	// RefreshInterval is how often expiring tokens are looked for, and
+	// RefreshWindow how long before expiry they are renewed.
+	RefreshInterval time.Duration
+	RefreshWindow   time.Duration
 }
 
 // Load reads configuration from environment variables.
 func Load() *Config {
+	port := getEnv("PORT", "8080")
+	ginMode := getEnv("GIN_MODE", "debug")
+	env := getEnv("APP_ENV", defaultEnvironment(ginMode))
+	publicURL := publicBaseURL(env, port)
+	frontendURL := getEnv("FRONTEND_BASE_URL", "https://fitstackapp.com")
+	oauthClientSecret := getEnv("MP_CLIENT_SECRET", "")
+
 	return &Config{
 		Server: ServerConfig{
-			Port:    getEnv("PORT", "8080"),
-			GinMode: getEnv("GIN_MODE", "debug"),
+			Port:        port,
+			GinMode:     ginMode,
+			Environment: env,
 		},
 		Django: DjangoConfig{
-			BaseURL: getEnv("DJANGO_BACKEND_URL", "http://localhost:8000"),
-			APIKey:  getEnv("DJANGO_API_KEY", ""),
+			BaseURL:               getEnv("DJANGO_BACKEND_URL", "http://localhost:8000"),
+			APIKey:                getEnv("DJANGO_API_KEY", ""),
+			SigningSecrets:        getEnvList("DJANGO_SIGNING_SECRETS"),
+			SignatureTolerance:    getEnvDuration("DJANGO_SIGNATURE_TOLERANCE", 5*time.Minute),
+			CredentialCacheTTL:    getEnvDuration("CREDENTIAL_CACHE_TTL", 5*time.Minute),
+			CredentialNegativeTTL: getEnvDuration("CREDENTIAL_CACHE_NEGATIVE_TTL", 30*time.Second),
+			SettingsCacheTTL:      getEnvDuration("GYM_SETTINGS_CACHE_TTL", time.Minute),
+		},
+		Database: DatabaseConfig{
+			Driver: getEnv("DATABASE_DRIVER", "sqlite3"),
+			URL:    getEnv("DATABASE_URL", "file:fitstack_payments.db?_foreign_keys=on&_busy_timeout=5000"),
+		},
+		Webhook: WebhookConfig{
+			SignatureTolerance: getEnvDuration("MP_WEBHOOK_TOLERANCE", 5*time.Minute),
+			PublicBaseURL:      publicURL,
+			TenantTokenSecret:  getEnv("WEBHOOK_TENANT_TOKEN_SECRET", ""),
+			RequireTenantToken: getEnvBool("WEBHOOK_REQUIRE_TENANT_TOKEN", false),
+			AllowUnsignedIPN:   getEnvBool("WEBHOOK_ALLOW_UNSIGNED_IPN", false),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", 2*time.Second),
+			BatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 20),
+			MaxAttempts:  getEnvInt("OUTBOX_MAX_ATTEMPTS", 12),
+			BaseDelay:    getEnvDuration("OUTBOX_BASE_DELAY", 5*time.Second),
+			MaxDelay:     getEnvDuration("OUTBOX_MAX_DELAY", 30*time.Minute),
+		},
+		Events: EventsConfig{
+			SubscriberBuffer:  getEnvInt("EVENTS_SUBSCRIBER_BUFFER", 16),
+			HeartbeatInterval: getEnvDuration("SSE_HEARTBEAT_INTERVAL", 15*time.Second),
+		},
+		Reconcile: ReconcileConfig{
+			Interval: getEnvDuration("RECONCILE_INTERVAL", time.Hour),
+			Window:   getEnvDuration("RECONCILE_WINDOW", 48*time.Hour),
+			PageSize: getEnvInt("RECONCILE_PAGE_SIZE", 50),
+		},
+		Auth: AuthConfig{
+			ServiceKeys:            serviceKeys(),
+			AllowInBodyAccessToken: getEnvBool("ALLOW_INBODY_ACCESS_TOKEN", true),
+		},
+		Gyms: GymsConfig{
+			DefaultSiteID: getEnv("MP_DEFAULT_SITE_ID", "MLA"),
+			FrontendURL:   frontendURL,
+		},
+		OAuth: OAuthConfig{
+			ClientID:                       getEnv("MP_CLIENT_ID", ""),
+			ClientSecret:                   oauthClientSecret,
+			RedirectURI:                    getEnv("MP_OAUTH_REDIRECT_URI", publicURL+"/oauth/mercadopago/callback"),
+			ReturnURL:                      getEnv("MP_OAUTH_RETURN_URL", strings.TrimRight(frontendURL, "/")+"/gym/{gym_slug}/settings/payments"),
+			StateSecret:                    getEnv("MP_OAUTH_STATE_SECRET", oauthClientSecret),
+			StateTTL:                       getEnvDuration("MP_OAUTH_STATE_TTL", 15*time.Minute),
+			TokenKey:                       getEnv("MP_OAUTH_TOKEN_KEY", ""),
+			WebhookSecret:                  getEnv("MP_OAUTH_WEBHOOK_SECRET", ""),
+			PreviousWebhookSecret:          getEnv("MP_OAUTH_PREVIOUS_WEBHOOK_SECRET", ""),
+			PreviousWebhookSecretExpiresAt: getEnvTime("MP_OAUTH_PREVIOUS_WEBHOOK_SECRET_EXPIRES_AT"),
+			RefreshInterval:                getEnvDuration("MP_OAUTH_REFRESH_INTERVAL", time.Hour),
+			RefreshWindow:                  getEnvDuration("MP_OAUTH_REFRESH_WINDOW", 7*24*time.Hour),
 		},
 	}
 }
 
+// defaultEnvironment assumes production only for release builds, so a local
+// run never registers production notification URLs by accident.
+func defaultEnvironment(ginMode string) string {
+	if ginMode == "release" {
+		return "production"
+	}
+	return "local"
+}
+
+// publicBaseURL resolves the public base URL: PUBLIC_BASE_URL_<ENV> (e.g.
+// PUBLIC_BASE_URL_STAGING), then PUBLIC_BASE_URL, then the environment default.
+func publicBaseURL(env, port string) string {
+	defaultURL := "http://localhost:" + port
+	if env == "production" {
+		defaultURL = "https://api.fitstackapp.com"
+	}
+	envKey := "PUBLIC_BASE_URL_" + strings.ToUpper(strings.ReplaceAll(env, "-", "_"))
+	return strings.TrimRight(getEnv(envKey, getEnv("PUBLIC_BASE_URL", defaultURL)), "/")
+}
+
+// serviceKeys parses PAYMENTS_SERVICE_API_KEYS, a comma-separated list of
+// id:key or id:key:scope|scope entries, plus the single legacy
+// PAYMENTS_SERVICE_API_KEY (ID "default", all scopes).
+func serviceKeys() []ServiceKey {
+	var keys []ServiceKey
+	for _, entry := range strings.Split(os.Getenv("PAYMENTS_SERVICE_API_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			log.Printf("Invalid entry in PAYMENTS_SERVICE_API_KEYS (expected id:key[:scopes]), skipping")
+			continue
+		}
+		key := ServiceKey{ID: parts[0], Key: parts[1]}
+		if len(parts) == 3 && parts[2] != "" {
+			key.Scopes = strings.Split(parts[2], "|")
+		}
+		keys = append(keys, key)
+	}
+
+	if legacy := os.Getenv("PAYMENTS_SERVICE_API_KEY"); legacy != "" {
+		keys = append(keys, ServiceKey{ID: "default", Key: legacy})
+	}
+	return keys
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s (%q), using %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+func getEnvTime(key string) time.Time {
+	value := os.Getenv(key)
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Printf("Invalid RFC 3339 time for %s (%q), ignoring", key, value)
+		return time.Time{}
+	}
+	return t
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
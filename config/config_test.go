@@ -0,0 +1,23 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestServiceKeys(t *testing.T) {
+	t.Setenv("PAYMENTS_SERVICE_API_KEYS", "django:k1, reports:k2:admin|payments,broken,:k3,empty:")
+	t.Setenv("PAYMENTS_SERVICE_API_KEY", "legacy")
+
+	want := []ServiceKey{
+		{ID: "django", Key: "k1"},
+		{ID: "reports", Key: "k2", Scopes: []string{"admin", "payments"}},
+		{ID: "default", Key: "legacy"},
+	}
+	got := serviceKeys()
+	if !slices.EqualFunc(got, want, func(a, b ServiceKey) bool {
+		return a.ID == b.ID && a.Key == b.Key && slices.Equal(a.Scopes, b.Scopes)
+	}) {
+		t.Errorf("serviceKeys() = %+v, want %+v", got, want)
+	}
+}
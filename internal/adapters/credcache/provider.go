@@ -0,0 +1,216 @@
+// Package credcache provides an in-memory cache in front of a
+// GymCredentialProvider.
+package credcache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+	"golang.org/x/sync/singleflight"
+)
+
+// Provider implements ports.GymCredentialProvider by caching another provider.
+//
+// A gym's webhook secrets and access token are fetched and cached together,
+// kept for ttl, and ErrGymNotFound for negativeTTL. Concurrent misses for
+// the same gym share one upstream call. Cached values are sealed
+// with AES-GCM under a key generated per process, so they never sit in
+// memory (or a heap dump) in clear.
+type Provider struct {
+	next        ports.GymCredentialProvider
+	ttl         time.Duration
+	negativeTTL time.Duration
+	aead        cipher.AEAD
+	group       singleflight.Group
+	now         func() time.Time
+
+	mu          sync.Mutex
+	entries     map[string]entry
+	generations map[string]uint64
+}
+
+// entry is a gym's cached credentials or a cached "gym not found".
+type entry struct {
+	sealed   []byte // nonce followed by ciphertext; nil when notFound
+	notFound bool
+	expires  time.Time
+}
+
+// New creates a caching credential provider in front of next.
+// A zero ttl disables caching of values, a zero negativeTTL of misses.
+func New(next ports.GymCredentialProvider, ttl, negativeTTL time.Duration) (*Provider, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate credential cache key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		next:        next,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		aead:        aead,
+		now:         time.Now,
+		entries:     make(map[string]entry),
+		generations: make(map[string]uint64),
+	}, nil
+}
+
+// GetWebhookSecrets returns the gym's webhook secrets, from cache when fresh.
+// The grace period of a previous secret is checked by the caller, so a
+// cached previous secret never outlives its expiry.
+func (p *Provider) GetWebhookSecrets(ctx context.Context, gymSlug string) (domain.WebhookSecrets, error) {
+	creds, err := p.GetCredentials(ctx, gymSlug)
+	return creds.WebhookSecrets, err
+}
+
+// GetAccessToken returns the gym's access token, from cache when fresh.
+func (p *Provider) GetAccessToken(ctx context.Context, gymSlug string) (string, error) {
+	creds, err := p.GetCredentials(ctx, gymSlug)
+	return creds.AccessToken, err
+}
+
+// GetCredentials returns the gym's credentials from cache when fresh, or
+// fetches them once for all waiting callers.
+func (p *Provider) GetCredentials(ctx context.Context, gymSlug string) (domain.GymCredentials, error) {
+	key := cacheKey(gymSlug)
+
+	if creds, err, ok := p.lookup(key); ok {
+		return creds, err
+	}
+
+	p.mu.Lock()
+	generation := p.generations[key]
+	p.mu.Unlock()
+
+	result, err, _ := p.group.Do(key, func() (any, error) {
+		// Shared by every waiting caller: one caller's cancellation must not fail the rest
+		creds, err := p.next.GetCredentials(context.WithoutCancel(ctx), gymSlug)
+		switch {
+		case err == nil:
+			p.store(key, generation, creds)
+		case errors.Is(err, domain.ErrGymNotFound):
+			p.storeNotFound(key, generation)
+		}
+		return creds, err
+	})
+	if err != nil {
+		return domain.GymCredentials{}, err
+	}
+	return result.(domain.GymCredentials), nil
+}
+
+// InvalidateGym drops the cached credentials of a gym. Lookups already in
+// flight are not cached either. Only this process's cache is cleared;
+// other replicas serve what they cached until it expires.
+func (p *Provider) InvalidateGym(gymSlug string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := cacheKey(gymSlug)
+	delete(p.entries, key)
+	p.generations[key]++
+	p.group.Forget(key)
+}
+
+// lookup returns a fresh cached entry; ok is false on a miss.
+func (p *Provider) lookup(key string) (creds domain.GymCredentials, err error, ok bool) {
+	p.mu.Lock()
+	e, found := p.entries[key]
+	if found && !p.now().Before(e.expires) {
+		delete(p.entries, key)
+		found = false
+	}
+	p.mu.Unlock()
+
+	if !found {
+		return domain.GymCredentials{}, nil, false
+	}
+	if e.notFound {
+		return domain.GymCredentials{}, domain.ErrGymNotFound, true
+	}
+
+	plain, openErr := p.open(key, e.sealed)
+	if openErr != nil {
+		return domain.GymCredentials{}, nil, false
+	}
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return domain.GymCredentials{}, nil, false
+	}
+	return creds, nil, true
+}
+
+// store caches credentials unless the gym was invalidated since generation.
+func (p *Provider) store(key string, generation uint64, creds domain.GymCredentials) {
+	if p.ttl <= 0 {
+		return
+	}
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return
+	}
+	sealed, err := p.seal(key, plain)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.generations[key] != generation {
+		return
+	}
+	p.entries[key] = entry{sealed: sealed, expires: p.now().Add(p.ttl)}
+}
+
+// storeNotFound caches a missing gym unless it was invalidated since generation.
+func (p *Provider) storeNotFound(key string, generation uint64) {
+	if p.negativeTTL <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.generations[key] != generation {
+		return
+	}
+	p.entries[key] = entry{notFound: true, expires: p.now().Add(p.negativeTTL)}
+}
+
+// seal encrypts plain, bound to its cache key.
+func (p *Provider) seal(key string, plain []byte) ([]byte, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return p.aead.Seal(nonce, nonce, plain, []byte(key)), nil
+}
+
+// open decrypts credentials sealed for key.
+func (p *Provider) open(key string, sealed []byte) ([]byte, error) {
+	size := p.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, errors.New("sealed credentials too short")
+	}
+	return p.aead.Open(nil, sealed[:size], sealed[size:], []byte(key))
+}
+
+// cacheKey identifies the credentials of one gym.
+func cacheKey(gymSlug string) string {
+	return "credentials:" + gymSlug
+}
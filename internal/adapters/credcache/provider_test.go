@@ -0,0 +1,233 @@
+package credcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// fakeUpstream is a GymCredentialProvider counting its lookups. When release
+// is set, lookups block until it is closed.
+type fakeUpstream struct {
+	token   string
+	secrets domain.WebhookSecrets
+	err     error
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (f *fakeUpstream) GetWebhookSecrets(ctx context.Context, gymSlug string) (domain.WebhookSecrets, error) {
+	creds, err := f.GetCredentials(ctx, gymSlug)
+	return creds.WebhookSecrets, err
+}
+
+func (f *fakeUpstream) GetAccessToken(ctx context.Context, gymSlug string) (string, error) {
+	creds, err := f.GetCredentials(ctx, gymSlug)
+	return creds.AccessToken, err
+}
+
+func (f *fakeUpstream) GetCredentials(_ context.Context, gymSlug string) (domain.GymCredentials, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	if f.err != nil {
+		return domain.GymCredentials{}, f.err
+	}
+	return domain.GymCredentials{GymSlug: gymSlug, WebhookSecrets: f.secrets, AccessToken: f.token}, nil
+}
+
+// newTestProvider returns a Provider in front of upstream whose clock is
+// advanced by the returned function.
+func newTestProvider(t *testing.T, upstream *fakeUpstream, ttl, negativeTTL time.Duration) (*Provider, func(time.Duration)) {
+	t.Helper()
+	p, err := New(upstream, ttl, negativeTTL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	return p, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestProviderGetAccessToken(t *testing.T) {
+	errUpstream := errors.New("django unreachable")
+
+	tests := []struct {
+		name        string
+		upstreamErr error
+		ttl         time.Duration
+		negativeTTL time.Duration
+		// between runs between the two lookups
+		between   func(p *Provider, advance func(time.Duration))
+		wantCalls int32
+		wantErr   error
+	}{
+		{name: "cached", ttl: time.Minute, wantCalls: 1},
+		{name: "expired", ttl: time.Minute,
+			between: func(_ *Provider, advance func(time.Duration)) { advance(time.Minute) }, wantCalls: 2},
+		{name: "caching disabled", wantCalls: 2},
+		{name: "invalidated", ttl: time.Minute,
+			between: func(p *Provider, _ func(time.Duration)) { p.InvalidateGym("level-gym") }, wantCalls: 2},
+		{name: "other gym invalidated", ttl: time.Minute,
+			between: func(p *Provider, _ func(time.Duration)) { p.InvalidateGym("other-gym") }, wantCalls: 1},
+		{name: "gym not found cached", upstreamErr: domain.ErrGymNotFound, ttl: time.Minute, negativeTTL: time.Second,
+			wantCalls: 1, wantErr: domain.ErrGymNotFound},
+		{name: "gym not found expired", upstreamErr: domain.ErrGymNotFound, ttl: time.Minute, negativeTTL: time.Second,
+			between:   func(_ *Provider, advance func(time.Duration)) { advance(time.Second) },
+			wantCalls: 2, wantErr: domain.ErrGymNotFound},
+		{name: "negative caching disabled", upstreamErr: domain.ErrGymNotFound, ttl: time.Minute,
+			wantCalls: 2, wantErr: domain.ErrGymNotFound},
+		{name: "transient errors not cached", upstreamErr: errUpstream, ttl: time.Minute, negativeTTL: time.Minute,
+			wantCalls: 2, wantErr: errUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &fakeUpstream{token: "APP_USR-123", err: tt.upstreamErr}
+			p, advance := newTestProvider(t, upstream, tt.ttl, tt.negativeTTL)
+
+			for i := 0; i < 2; i++ {
+				if i == 1 && tt.between != nil {
+					tt.between(p, advance)
+				}
+				token, err := p.GetAccessToken(context.Background(), "level-gym")
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("lookup %d: err = %v, want %v", i, err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil || token != "APP_USR-123" {
+					t.Fatalf("lookup %d = %q, %v; want APP_USR-123", i, token, err)
+				}
+			}
+			if got := upstream.calls.Load(); got != tt.wantCalls {
+				t.Errorf("upstream called %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestProviderGetWebhookSecrets(t *testing.T) {
+	secrets := domain.WebhookSecrets{
+		Current:           "new-secret",
+		Previous:          "old-secret",
+		PreviousExpiresAt: time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC),
+	}
+	upstream := &fakeUpstream{secrets: secrets}
+	p, _ := newTestProvider(t, upstream, time.Minute, 0)
+
+	for i := 0; i < 2; i++ {
+		got, err := p.GetWebhookSecrets(context.Background(), "level-gym")
+		if err != nil {
+			t.Fatalf("GetWebhookSecrets: %v", err)
+		}
+		if got.Current != secrets.Current || got.Previous != secrets.Previous ||
+			!got.PreviousExpiresAt.Equal(secrets.PreviousExpiresAt) {
+			t.Errorf("lookup %d = %+v, want %+v", i, got, secrets)
+		}
+	}
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("upstream called %d times, want 1", got)
+	}
+
+	// Cached values are sealed, never kept in clear
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, e := range p.entries {
+		if bytes.Contains(e.sealed, []byte("new-secret")) || bytes.Contains(e.sealed, []byte("old-secret")) {
+			t.Errorf("entry %s holds a secret in clear", key)
+		}
+	}
+}
+
+func TestProviderCachesCredentialsTogether(t *testing.T) {
+	upstream := &fakeUpstream{token: "APP_USR-123", secrets: domain.WebhookSecrets{Current: "secret"}}
+	p, _ := newTestProvider(t, upstream, time.Minute, 0)
+
+	secrets, err := p.GetWebhookSecrets(context.Background(), "level-gym")
+	if err != nil || secrets.Current != "secret" {
+		t.Fatalf("GetWebhookSecrets = %+v, %v; want secret", secrets, err)
+	}
+	token, err := p.GetAccessToken(context.Background(), "level-gym")
+	if err != nil || token != "APP_USR-123" {
+		t.Fatalf("GetAccessToken = %q, %v; want APP_USR-123", token, err)
+	}
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("upstream called %d times, want 1", got)
+	}
+
+	p.InvalidateGym("level-gym")
+	if _, err := p.GetAccessToken(context.Background(), "level-gym"); err != nil {
+		t.Fatalf("GetAccessToken: %v", err)
+	}
+	if _, err := p.GetWebhookSecrets(context.Background(), "level-gym"); err != nil {
+		t.Fatalf("GetWebhookSecrets: %v", err)
+	}
+	if got := upstream.calls.Load(); got != 2 {
+		t.Errorf("after invalidation: upstream called %d times, want 2", got)
+	}
+}
+
+func TestProviderSharesConcurrentMisses(t *testing.T) {
+	upstream := &fakeUpstream{token: "APP_USR-123", release: make(chan struct{})}
+	p, _ := newTestProvider(t, upstream, time.Minute, 0)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := p.GetAccessToken(context.Background(), "level-gym"); err != nil || token != "APP_USR-123" {
+				errs <- errors.New("unexpected lookup result " + token)
+			}
+		}()
+	}
+	// Let every caller join the in-flight lookup before it returns
+	for upstream.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("upstream called %d times, want 1", got)
+	}
+}
+
+func TestProviderInvalidateDuringLookup(t *testing.T) {
+	upstream := &fakeUpstream{token: "APP_USR-old", release: make(chan struct{})}
+	p, _ := newTestProvider(t, upstream, time.Minute, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.GetAccessToken(context.Background(), "level-gym")
+	}()
+	for upstream.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The gym reconnects while the old token is being fetched
+	p.InvalidateGym("level-gym")
+	close(upstream.release)
+	<-done
+
+	upstream.token = "APP_USR-new"
+	token, err := p.GetAccessToken(context.Background(), "level-gym")
+	if err != nil || token != "APP_USR-new" {
+		t.Errorf("GetAccessToken = %q, %v; want APP_USR-new", token, err)
+	}
+}
@@ -11,22 +11,30 @@ import (
 	"time"
 
 	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/signing"
 )
 
-// Client implements DjangoNotifier and GymCredentialProvider interfaces.
+// RequestTimeout bounds every request to Django.
+const RequestTimeout = 15 * time.Second
+
+// Client implements DjangoNotifier, GymCredentialProvider and
+// GymSettingsProvider interfaces.
 type Client struct {
 	baseURL    string
 	apiKey     string
+	signer     *signing.Signer
 	httpClient *http.Client
 }
 
 // NewClient creates a new Django backend client.
-func NewClient(baseURL, apiKey string) *Client {
+// Requests are HMAC-signed when signer has a secret.
+func NewClient(baseURL, apiKey string, signer *signing.Signer) *Client {
 	return &Client{
 		baseURL: baseURL,
 		apiKey:  apiKey,
+		signer:  signer,
 		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
+			Timeout: RequestTimeout,
 		},
 	}
 }
@@ -34,7 +42,18 @@ func NewClient(baseURL, apiKey string) *Client {
 // NotifyPaymentConfirmed sends payment confirmation to Django backend.
 // POST /api/v1/payments/webhook-callback/
 func (c *Client) NotifyPaymentConfirmed(ctx context.Context, payload domain.DjangoWebhookPayload) error {
-	url := fmt.Sprintf("%s/api/v1/payments/webhook-callback/", c.baseURL)
+	return c.postCallback(ctx, "/api/v1/payments/webhook-callback/", payload)
+}
+
+// NotifySubscriptionEvent sends a subscription lifecycle event to Django backend.
+// POST /api/v1/subscriptions/webhook-callback/
+func (c *Client) NotifySubscriptionEvent(ctx context.Context, payload domain.DjangoSubscriptionPayload) error {
+	return c.postCallback(ctx, "/api/v1/subscriptions/webhook-callback/", payload)
+}
+
+// postCallback posts a JSON callback to Django.
+func (c *Client) postCallback(ctx context.Context, path string, payload any) error {
+	url := c.baseURL + path
 
 	jsonBody, err := json.Marshal(payload)
 	if err != nil {
@@ -49,7 +68,12 @@ func (c *Client) NotifyPaymentConfirmed(ctx context.Context, payload domain.Djan
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Webhook-Secret", c.apiKey)
+	if c.signer.Enabled() {
+		c.signer.Sign(req, jsonBody)
+	} else {
+		// Legacy: shared secret in clear until Django verifies signatures
+		req.Header.Set("X-Webhook-Secret", c.apiKey)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -59,39 +83,57 @@ func (c *Client) NotifyPaymentConfirmed(ctx context.Context, payload domain.Djan
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return domain.NewServiceError(domain.ErrDjangoCallbackFailed,
-			fmt.Sprintf("Django returned status %d: %s", resp.StatusCode, string(body)),
-			"DJANGO_ERROR")
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return domain.NewServiceError(
+			&domain.CallbackError{StatusCode: resp.StatusCode, Body: string(body)},
+			"", "DJANGO_ERROR")
 	}
 
 	return nil
 }
 
 // gymCredentialsResponse represents the response from Django for gym credentials.
+// The previous webhook secret is only sent while it is being rotated.
 type gymCredentialsResponse struct {
-	GymSlug       string `json:"gym_slug"`
-	WebhookSecret string `json:"webhook_secret"`
-	AccessToken   string `json:"access_token"`
+	GymSlug                 string     `json:"gym_slug"`
+	WebhookSecret           string     `json:"webhook_secret"`
+	PreviousWebhookSecret   string     `json:"previous_webhook_secret"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_webhook_secret_expires_at"`
+	AccessToken             string     `json:"access_token"`
 }
 
-// GetWebhookSecret retrieves the webhook secret for a gym from Django.
-// GET /api/v1/internal/gyms/:slug/credentials/
-func (c *Client) GetWebhookSecret(ctx context.Context, gymSlug string) (string, error) {
-	creds, err := c.getGymCredentials(ctx, gymSlug)
-	if err != nil {
-		return "", err
-	}
-	return creds.WebhookSecret, nil
+// GetWebhookSecrets retrieves the webhook secrets for a gym from Django.
+func (c *Client) GetWebhookSecrets(ctx context.Context, gymSlug string) (domain.WebhookSecrets, error) {
+	creds, err := c.GetCredentials(ctx, gymSlug)
+	return creds.WebhookSecrets, err
 }
 
 // GetAccessToken retrieves the access token for a gym from Django.
 func (c *Client) GetAccessToken(ctx context.Context, gymSlug string) (string, error) {
-	creds, err := c.getGymCredentials(ctx, gymSlug)
+	creds, err := c.GetCredentials(ctx, gymSlug)
+	return creds.AccessToken, err
+}
+
+// GetCredentials retrieves the webhook secrets and access token for a gym
+// from Django.
+// GET /api/v1/internal/gyms/:slug/credentials/
+func (c *Client) GetCredentials(ctx context.Context, gymSlug string) (domain.GymCredentials, error) {
+	resp, err := c.getGymCredentials(ctx, gymSlug)
 	if err != nil {
-		return "", err
+		return domain.GymCredentials{}, err
+	}
+	creds := domain.GymCredentials{
+		GymSlug: gymSlug,
+		WebhookSecrets: domain.WebhookSecrets{
+			Current:  resp.WebhookSecret,
+			Previous: resp.PreviousWebhookSecret,
+		},
+		AccessToken: resp.AccessToken,
 	}
-	return creds.AccessToken, nil
+	if resp.PreviousSecretExpiresAt != nil {
+		creds.WebhookSecrets.PreviousExpiresAt = *resp.PreviousSecretExpiresAt
+	}
+	return creds, nil
 }
 
 // getGymCredentials fetches gym credentials from Django.
@@ -105,10 +147,11 @@ func (c *Client) getGymCredentials(ctx context.Context, gymSlug string) (*gymCre
 	}
 
 	req.Header.Set("X-Internal-API-Key", c.apiKey)
+	c.signer.Sign(req, nil)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, domain.NewServiceError(domain.ErrGymNotFound,
+		return nil, domain.NewServiceError(domain.ErrDjangoUnavailable,
 			"request failed: "+err.Error(), "HTTP_ERROR")
 	}
 	defer resp.Body.Close()
@@ -118,7 +161,7 @@ func (c *Client) getGymCredentials(ctx context.Context, gymSlug string) (*gymCre
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, domain.NewServiceError(domain.ErrGymNotFound,
+		return nil, domain.NewServiceError(domain.ErrDjangoUnavailable,
 			fmt.Sprintf("Django returned status %d", resp.StatusCode), "DJANGO_ERROR")
 	}
 
@@ -130,3 +173,42 @@ func (c *Client) getGymCredentials(ctx context.Context, gymSlug string) (*gymCre
 
 	return &creds, nil
 }
+
+// GetGymSettings retrieves the checkout settings a gym overrides.
+// GET /api/v1/internal/gyms/:slug/settings/
+func (c *Client) GetGymSettings(ctx context.Context, gymSlug string) (*domain.GymSettings, error) {
+	url := fmt.Sprintf("%s/api/v1/internal/gyms/%s/settings/", c.baseURL, gymSlug)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrDjangoUnavailable,
+			"failed to create request", "REQUEST_ERROR")
+	}
+
+	req.Header.Set("X-Internal-API-Key", c.apiKey)
+	c.signer.Sign(req, nil)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrDjangoUnavailable,
+			"request failed: "+err.Error(), "HTTP_ERROR")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, domain.ErrGymNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, domain.NewServiceError(domain.ErrDjangoUnavailable,
+			fmt.Sprintf("Django returned status %d", resp.StatusCode), "DJANGO_ERROR")
+	}
+
+	var settings domain.GymSettings
+	if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
+		return nil, domain.NewServiceError(domain.ErrDjangoUnavailable,
+			"failed to decode response", "DECODE_ERROR")
+	}
+
+	return &settings, nil
+}
@@ -0,0 +1,93 @@
+// Package eventhub provides an in-process PaymentEventBus.
+package eventhub
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// Hub implements ports.PaymentEventBus within a single process.
+//
+// Each subscriber gets a buffered channel; publishing never blocks, events
+// for a subscriber whose buffer is full are dropped.
+type Hub struct {
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[string]map[*subscriber]struct{}
+}
+
+// subscriber is one Subscribe call.
+type subscriber struct {
+	events chan domain.PaymentStatusEvent
+	once   sync.Once
+}
+
+// New creates an event hub whose subscribers buffer up to buffer events.
+func New(buffer int) *Hub {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Hub{
+		buffer:      buffer,
+		subscribers: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// Publish sends an event to the subscribers of its gym and external reference.
+func (h *Hub) Publish(ctx context.Context, event domain.PaymentStatusEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[topic(event.GymSlug, event.ExternalReference)] {
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("Event hub: dropped %s of payment %s for a slow subscriber (gym %s)",
+				event.Event, event.PaymentID, event.GymSlug)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the events of an external reference until unsubscribe
+// is called or ctx ends.
+func (h *Hub) Subscribe(ctx context.Context, gymSlug, externalReference string) (<-chan domain.PaymentStatusEvent, func(), error) {
+	key := topic(gymSlug, externalReference)
+	sub := &subscriber{events: make(chan domain.PaymentStatusEvent, h.buffer)}
+
+	h.mu.Lock()
+	if h.subscribers[key] == nil {
+		h.subscribers[key] = make(map[*subscriber]struct{})
+	}
+	h.subscribers[key][sub] = struct{}{}
+	h.mu.Unlock()
+
+	remove := func() {
+		sub.once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[key], sub)
+			if len(h.subscribers[key]) == 0 {
+				delete(h.subscribers, key)
+			}
+			h.mu.Unlock()
+			// Removed under the lock, so no Publish sends on it anymore
+			close(sub.events)
+		})
+	}
+	stop := context.AfterFunc(ctx, remove)
+	unsubscribe := func() {
+		stop()
+		remove()
+	}
+
+	return sub.events, unsubscribe, nil
+}
+
+// topic identifies the subscribers of a gym's external reference.
+func topic(gymSlug, externalReference string) string {
+	return gymSlug + "\x00" + externalReference
+}
@@ -0,0 +1,94 @@
+package eventhub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+func event(gymSlug, externalReference, status string) domain.PaymentStatusEvent {
+	return domain.PaymentStatusEvent{Event: "payment." + status, GymSlug: gymSlug,
+		ExternalReference: externalReference, PaymentID: "100", Status: status}
+}
+
+func TestHubRoutesEvents(t *testing.T) {
+	h := New(4)
+	ctx := context.Background()
+	mine, unsubscribeMine, _ := h.Subscribe(ctx, "level-gym", "ref-1")
+	defer unsubscribeMine()
+	other, unsubscribeOther, _ := h.Subscribe(ctx, "other-gym", "ref-1")
+	defer unsubscribeOther()
+
+	h.Publish(ctx, event("level-gym", "ref-1", "approved"))
+	h.Publish(ctx, event("level-gym", "ref-2", "approved"))
+
+	if got := <-mine; got.ExternalReference != "ref-1" || got.Status != "approved" {
+		t.Errorf("received %+v, want ref-1 approved", got)
+	}
+	select {
+	case got := <-mine:
+		t.Errorf("received %+v of another reference", got)
+	case got := <-other:
+		t.Errorf("another gym received %+v", got)
+	default:
+	}
+}
+
+func TestHubDropsEventsOfSlowSubscribers(t *testing.T) {
+	h := New(1)
+	ctx := context.Background()
+	events, unsubscribe, _ := h.Subscribe(ctx, "level-gym", "ref-1")
+	defer unsubscribe()
+
+	// Publishing never blocks on a full buffer
+	h.Publish(ctx, event("level-gym", "ref-1", "in_process"))
+	h.Publish(ctx, event("level-gym", "ref-1", "approved"))
+
+	if got := <-events; got.Status != "in_process" {
+		t.Errorf("received %q, want the buffered in_process", got.Status)
+	}
+	select {
+	case got := <-events:
+		t.Errorf("received %q, want it dropped", got.Status)
+	default:
+	}
+}
+
+func TestHubUnsubscribe(t *testing.T) {
+	tests := []struct {
+		name string
+		// stop ends the subscription
+		stop func(unsubscribe func(), cancel context.CancelFunc)
+	}{
+		{name: "unsubscribe", stop: func(unsubscribe func(), _ context.CancelFunc) { unsubscribe() }},
+		{name: "context ends", stop: func(_ func(), cancel context.CancelFunc) { cancel() }},
+		{name: "both", stop: func(unsubscribe func(), cancel context.CancelFunc) {
+			cancel()
+			unsubscribe()
+			unsubscribe()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(4)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, unsubscribe, _ := h.Subscribe(ctx, "level-gym", "ref-1")
+
+			tt.stop(unsubscribe, cancel)
+			// The channel is closed once the subscriber is removed
+			for got := range events {
+				t.Errorf("received %+v after unsubscribing", got)
+			}
+
+			h.Publish(context.Background(), event("level-gym", "ref-1", "approved"))
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if len(h.subscribers) != 0 {
+				t.Errorf("%d topics left subscribed, want none", len(h.subscribers))
+			}
+		})
+	}
+}
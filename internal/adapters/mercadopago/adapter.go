@@ -3,17 +3,25 @@ package mercadopago
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fitstack/fitstack-payments/internal/core/domain"
 	"github.com/mercadopago/sdk-go/pkg/config"
+	"github.com/mercadopago/sdk-go/pkg/merchantorder"
+	"github.com/mercadopago/sdk-go/pkg/mperror"
 	"github.com/mercadopago/sdk-go/pkg/payment"
 	"github.com/mercadopago/sdk-go/pkg/preference"
+	"github.com/mercadopago/sdk-go/pkg/refund"
 )
 
-// Adapter implements ports.PaymentGateway using Mercado Pago SDK.
+// Adapter implements ports.PaymentGateway and ports.SubscriptionGateway
+// using Mercado Pago SDK.
 type Adapter struct{}
 
 // NewAdapter creates a new Mercado Pago adapter.
@@ -22,7 +30,8 @@ func NewAdapter() *Adapter {
 }
 
 // CreatePreference creates a Checkout Pro preference.
-func (a *Adapter) CreatePreference(ctx context.Context, accessToken string, req domain.PaymentRequest) (*domain.PaymentResponse, error) {
+// Back URLs in the request override the gym's defaults.
+func (a *Adapter) CreatePreference(ctx context.Context, accessToken string, req domain.PaymentRequest, settings domain.GymSettings) (*domain.PaymentResponse, error) {
 	cfg, err := config.New(accessToken)
 	if err != nil {
 		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
@@ -34,27 +43,37 @@ func (a *Adapter) CreatePreference(ctx context.Context, accessToken string, req
 	// Build back URLs
 	successURL := req.SuccessURL
 	if successURL == "" {
-		successURL = fmt.Sprintf("https://fitstackapp.com/gym/%s/payment/success", req.GymSlug)
+		successURL = settings.SuccessURL
 	}
 	failureURL := req.FailureURL
 	if failureURL == "" {
-		failureURL = fmt.Sprintf("https://fitstackapp.com/gym/%s/payment/failure", req.GymSlug)
+		failureURL = settings.FailureURL
 	}
 	pendingURL := req.PendingURL
 	if pendingURL == "" {
-		pendingURL = fmt.Sprintf("https://fitstackapp.com/gym/%s/payment/pending", req.GymSlug)
+		pendingURL = settings.PendingURL
+	}
+
+	checkoutItems, err := req.CheckoutItems()
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest, err.Error(), "INVALID_AMOUNT")
+	}
+	items := make([]preference.ItemRequest, 0, len(checkoutItems))
+	for _, item := range checkoutItems {
+		items = append(items, preference.ItemRequest{
+			ID:          item.ID,
+			Title:       item.Title,
+			Description: item.Description,
+			CategoryID:  item.CategoryID,
+			PictureURL:  item.PictureURL,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice.Float64(),
+			CurrencyID:  settings.Currency,
+		})
 	}
 
 	prefRequest := preference.Request{
-		Items: []preference.ItemRequest{
-			{
-				Title:       req.Title,
-				Description: req.Description,
-				Quantity:    1,
-				UnitPrice:   req.Amount,
-				CurrencyID:  "ARS",
-			},
-		},
+		Items: items,
 		Payer: &preference.PayerRequest{
 			Email: req.PayerEmail,
 		},
@@ -65,9 +84,17 @@ func (a *Adapter) CreatePreference(ctx context.Context, accessToken string, req
 			Failure: failureURL,
 			Pending: pendingURL,
 		},
-		NotificationURL: fmt.Sprintf("https://api.fitstackapp.com/webhooks/%s", req.GymSlug),
+		NotificationURL:     notificationURL(settings),
+		StatementDescriptor: settings.StatementDescriptor,
+		Metadata: map[string]any{
+			"gym_slug": req.GymSlug,
+			"site_id":  settings.SiteID,
+			"locale":   settings.Locale,
+		},
 	}
 
+	expiresAt := expireAfter(&prefRequest, req.ExpiresInMinutes, time.Now())
+
 	result, err := client.Create(ctx, prefRequest)
 	if err != nil {
 		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
@@ -79,9 +106,23 @@ func (a *Adapter) CreatePreference(ctx context.Context, accessToken string, req
 		PreferenceID:     result.ID,
 		InitPoint:        result.InitPoint,
 		SandboxInitPoint: result.SandboxInitPoint,
+		ExpiresAt:        expiresAt,
 	}, nil
 }
 
+// expireAfter limits a preference to the minutes from now and returns when
+// it expires, or nil when minutes is 0 and it never does.
+func expireAfter(prefRequest *preference.Request, minutes int, now time.Time) *time.Time {
+	if minutes <= 0 {
+		return nil
+	}
+	to := now.Add(time.Duration(minutes) * time.Minute)
+	prefRequest.Expires = true
+	prefRequest.ExpirationDateFrom = &now
+	prefRequest.ExpirationDateTo = &to
+	return &to
+}
+
 // GetPaymentInfo retrieves payment details from Mercado Pago.
 func (a *Adapter) GetPaymentInfo(ctx context.Context, accessToken string, paymentID string) (*domain.PaymentInfo, error) {
 	cfg, err := config.New(accessToken)
@@ -99,26 +140,273 @@ func (a *Adapter) GetPaymentInfo(ctx context.Context, accessToken string, paymen
 	}
 
 	result, err := client.Get(ctx, id)
+	if err != nil {
+		return nil, mpError(err, "failed to get payment info", "MP_PAYMENT_ERROR")
+	}
+
+	return toPaymentInfo(paymentID, result)
+}
+
+// CancelPayment cancels a pending or in-process payment.
+func (a *Adapter) CancelPayment(ctx context.Context, accessToken string, paymentID string) (*domain.PaymentInfo, error) {
+	cfg, err := config.New(accessToken)
 	if err != nil {
 		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
-			"failed to get payment info: "+err.Error(), "MP_PAYMENT_ERROR")
+			"failed to create MP config", "MP_CONFIG_ERROR")
 	}
 
-	dateApproved := result.DateApproved
-	if dateApproved.IsZero() {
-		dateApproved = time.Now()
+	client := payment.NewClient(cfg)
+
+	id, err := strconv.Atoi(paymentID)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest,
+			"invalid payment ID format", "INVALID_PAYMENT_ID")
 	}
 
-	return &domain.PaymentInfo{
+	result, err := client.Cancel(ctx, id)
+	if err != nil {
+		return nil, mpError(err, "failed to cancel payment", "MP_CANCEL_ERROR")
+	}
+
+	return toPaymentInfo(paymentID, result)
+}
+
+// GetMerchantOrder retrieves a merchant order from Mercado Pago.
+func (a *Adapter) GetMerchantOrder(ctx context.Context, accessToken string, orderID string) (*domain.MerchantOrder, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	client := merchantorder.NewClient(cfg)
+
+	id, err := strconv.Atoi(orderID)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest,
+			"invalid merchant order ID format", "INVALID_MERCHANT_ORDER_ID")
+	}
+
+	result, err := client.Get(ctx, id)
+	if err != nil {
+		// An order MP does not know will not appear on a redelivery either
+		return nil, mpResourceError(err, domain.ErrInvalidRequest,
+			"failed to get merchant order", "MP_MERCHANT_ORDER_ERROR")
+	}
+
+	return toMerchantOrder(orderID, result)
+}
+
+// toMerchantOrder converts an MP merchant order into the domain entity.
+// The currency is taken from its payments, or its items before any payment.
+func toMerchantOrder(orderID string, result *merchantorder.Response) (*domain.MerchantOrder, error) {
+	currency := ""
+	for _, p := range result.Payments {
+		if p.CurrencyID != "" {
+			currency = p.CurrencyID
+			break
+		}
+	}
+	if currency == "" {
+		for _, item := range result.Items {
+			if item.CurrencyID != "" {
+				currency = item.CurrencyID
+				break
+			}
+		}
+	}
+
+	paymentIDs := make([]string, 0, len(result.Payments))
+	for _, p := range result.Payments {
+		paymentIDs = append(paymentIDs, strconv.Itoa(p.ID))
+	}
+
+	totalAmount, err := mpAmount(result.TotalAmount, currency)
+	if err != nil {
+		return nil, err
+	}
+	paidAmount, err := mpAmount(result.PaidAmount, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.MerchantOrder{
+		OrderID:           orderID,
+		PreferenceID:      result.PreferenceID,
+		ExternalReference: result.ExternalReference,
+		Status:            result.Status,
+		OrderStatus:       result.OrderStatus,
+		TotalAmount:       totalAmount,
+		PaidAmount:        paidAmount,
+		Currency:          currency,
+		PaymentIDs:        paymentIDs,
+	}, nil
+}
+
+// searchTimeLayout is the date format of MP's payment search.
+const searchTimeLayout = "2006-01-02T15:04:05.000-07:00"
+
+// SearchPayments returns a page of the gym's payments whose search.Field
+// falls between search.From and search.To, oldest first.
+func (a *Adapter) SearchPayments(ctx context.Context, accessToken string, search domain.PaymentSearch) (*domain.PaymentPage, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	field := search.Field
+	if field == "" {
+		field = domain.PaymentSearchUpdated
+	}
+
+	client := payment.NewClient(cfg)
+	result, err := client.Search(ctx, payment.SearchRequest{
+		Limit:  search.Limit,
+		Offset: search.Offset,
+		Filters: map[string]string{
+			"range":      field,
+			"begin_date": search.From.UTC().Format(searchTimeLayout),
+			"end_date":   search.To.UTC().Format(searchTimeLayout),
+			"sort":       field,
+			"criteria":   "asc",
+		},
+	})
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrInvalidRequest,
+			"failed to search payments", "MP_SEARCH_ERROR")
+	}
+
+	page := &domain.PaymentPage{
+		Payments: make([]domain.PaymentInfo, 0, len(result.Results)),
+		Total:    result.Paging.Total,
+	}
+	for i := range result.Results {
+		r := &result.Results[i]
+		info, err := toPaymentInfo(strconv.Itoa(r.ID), r)
+		if err != nil {
+			return nil, err
+		}
+		page.Payments = append(page.Payments, *info)
+	}
+	return page, nil
+}
+
+// toPaymentInfo converts an MP payment into the domain entity.
+func toPaymentInfo(paymentID string, result *payment.Response) (*domain.PaymentInfo, error) {
+	amount, err := mpAmount(result.TransactionAmount, result.CurrencyID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &domain.PaymentInfo{
 		PaymentID:         paymentID,
 		Status:            result.Status,
 		StatusDetail:      result.StatusDetail,
 		ExternalReference: result.ExternalReference,
-		Amount:            result.TransactionAmount,
+		Amount:            amount,
 		Currency:          result.CurrencyID,
 		PaymentMethod:     result.PaymentMethodID,
 		PaymentType:       result.PaymentTypeID,
 		PayerEmail:        result.Payer.Email,
-		DateApproved:      dateApproved,
+		DateLastUpdated:   result.DateLastUpdated,
+	}
+	if !result.DateApproved.IsZero() {
+		dateApproved := result.DateApproved
+		info.DateApproved = &dateApproved
+	}
+	return info, nil
+}
+
+// RefundPayment refunds a payment in full, or partially when amount is set.
+// The refunded amount is returned in amount's currency, or without currency
+// for full refunds since MP does not report it.
+func (a *Adapter) RefundPayment(ctx context.Context, accessToken string, paymentID string, amount *domain.Money) (*domain.RefundInfo, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	client := refund.NewClient(cfg)
+
+	id, err := strconv.Atoi(paymentID)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest,
+			"invalid payment ID format", "INVALID_PAYMENT_ID")
+	}
+
+	currency := ""
+	var result *refund.Response
+	if amount != nil {
+		currency = amount.Currency
+		result, err = client.CreatePartialRefund(ctx, id, amount.Float64())
+	} else {
+		result, err = client.Create(ctx, id)
+	}
+	if err != nil {
+		return nil, mpError(err, "failed to refund payment", "MP_REFUND_ERROR")
+	}
+
+	refunded, err := mpAmount(result.Amount, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.RefundInfo{
+		RefundID:    strconv.Itoa(result.ID),
+		PaymentID:   paymentID,
+		Amount:      refunded,
+		Status:      result.Status,
+		DateCreated: result.DateCreated,
 	}, nil
 }
+
+// mpError converts an SDK error into a service error. MP 404s map to
+// ErrPaymentNotFound and 400/422 to ErrInvalidRequest, so callers can tell
+// a rejected request from a gateway failure. Any other status, including a
+// revoked token (401/403) or rate limiting (429), is a gateway error, which
+// a retry may get past.
+func mpError(err error, message, code string) error {
+	return mpResourceError(err, domain.ErrPaymentNotFound, message, code)
+}
+
+// mpResourceError is mpError for resources other than payments, mapping MP
+// 404s to notFound.
+func mpResourceError(err error, notFound error, message, code string) error {
+	var respErr *mperror.ResponseError
+	if errors.As(err, &respErr) {
+		switch {
+		case respErr.StatusCode == http.StatusNotFound:
+			return domain.NewServiceError(notFound,
+				message+": "+respErr.Message, code)
+		case respErr.StatusCode == http.StatusBadRequest,
+			respErr.StatusCode == http.StatusUnprocessableEntity:
+			return domain.NewServiceError(domain.ErrInvalidRequest,
+				message+": "+respErr.Message, code)
+		}
+	}
+	return domain.NewServiceError(domain.ErrPaymentGatewayError,
+		message+": "+err.Error(), code)
+}
+
+// mpAmount converts an amount reported by MP. NaN or amounts out of range
+// are reported as gateway errors rather than recorded as zero.
+func mpAmount(f float64, currency string) (domain.Money, error) {
+	m, err := domain.MoneyFromFloat(f, currency)
+	if err != nil {
+		return domain.Money{}, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"invalid amount from Mercado Pago: "+err.Error(), "MP_INVALID_AMOUNT")
+	}
+	return m, nil
+}
+
+// notificationURL returns the webhook URL MP notifies for a gym's payments,
+// with the tenant token when one is set.
+func notificationURL(settings domain.GymSettings) string {
+	u := fmt.Sprintf("%s/webhooks/%s", strings.TrimRight(settings.NotificationBaseURL, "/"), url.PathEscape(settings.GymSlug))
+	if settings.NotificationToken != "" {
+		u += "?tenant_token=" + url.QueryEscape(settings.NotificationToken)
+	}
+	return u
+}
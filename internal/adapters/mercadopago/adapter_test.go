@@ -0,0 +1,62 @@
+package mercadopago
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/mercadopago/sdk-go/pkg/mperror"
+	"github.com/mercadopago/sdk-go/pkg/preference"
+)
+
+func TestMPResourceError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "not found", err: &mperror.ResponseError{StatusCode: http.StatusNotFound}, want: domain.ErrChargebackNotFound},
+		{name: "bad request", err: &mperror.ResponseError{StatusCode: http.StatusBadRequest}, want: domain.ErrInvalidRequest},
+		{name: "unprocessable", err: &mperror.ResponseError{StatusCode: http.StatusUnprocessableEntity}, want: domain.ErrInvalidRequest},
+		{name: "unauthorized", err: &mperror.ResponseError{StatusCode: http.StatusUnauthorized}, want: domain.ErrPaymentGatewayError},
+		{name: "forbidden", err: &mperror.ResponseError{StatusCode: http.StatusForbidden}, want: domain.ErrPaymentGatewayError},
+		{name: "rate limited", err: &mperror.ResponseError{StatusCode: http.StatusTooManyRequests}, want: domain.ErrPaymentGatewayError},
+		{name: "server error", err: &mperror.ResponseError{StatusCode: http.StatusBadGateway}, want: domain.ErrPaymentGatewayError},
+		{name: "transport", err: errors.New("connection reset"), want: domain.ErrPaymentGatewayError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mpResourceError(tt.err, domain.ErrChargebackNotFound, "failed to get chargeback", "MP_CHARGEBACK_ERROR")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("mpResourceError() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpireAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("never expires", func(t *testing.T) {
+		var req preference.Request
+		if got := expireAfter(&req, 0, now); got != nil || req.Expires || req.ExpirationDateTo != nil {
+			t.Errorf("expireAfter(0) = %v, request %+v, want no expiration", got, req)
+		}
+	})
+
+	t.Run("expires after the minutes", func(t *testing.T) {
+		var req preference.Request
+		got := expireAfter(&req, 30, now)
+		want := now.Add(30 * time.Minute)
+		if got == nil || !got.Equal(want) {
+			t.Fatalf("expireAfter(30) = %v, want %s", got, want)
+		}
+		if !req.Expires || !req.ExpirationDateFrom.Equal(now) || !req.ExpirationDateTo.Equal(want) {
+			t.Errorf("request expires %t from %v to %v, want from %s to %s",
+				req.Expires, req.ExpirationDateFrom, req.ExpirationDateTo, now, want)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package mercadopago
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/mercadopago/sdk-go/pkg/config"
+	"github.com/mercadopago/sdk-go/pkg/mperror"
+)
+
+// chargebacksURL is the MP chargebacks API; the SDK has no client for it.
+const chargebacksURL = "https://api.mercadopago.com/v1/chargebacks/"
+
+// chargebackResponse is the part of an MP chargeback the service uses.
+// IDs may come as numbers or strings.
+type chargebackResponse struct {
+	ID                        json.Number   `json:"id"`
+	Payments                  []json.Number `json:"payments"`
+	Currency                  string        `json:"currency"`
+	Amount                    float64       `json:"amount"`
+	CoverageApplied           *bool         `json:"coverage_applied"`
+	CoverageElegible          bool          `json:"coverage_elegible"`
+	DocumentationRequired     bool          `json:"documentation_required"`
+	DocumentationStatus       string        `json:"documentation_status"`
+	DateDocumentationDeadline *time.Time    `json:"date_documentation_deadline"`
+	DateCreated               time.Time     `json:"date_created"`
+	DateLastUpdated           time.Time     `json:"date_last_updated"`
+}
+
+// GetChargeback retrieves a chargeback from Mercado Pago.
+func (a *Adapter) GetChargeback(ctx context.Context, accessToken string, chargebackID string) (*domain.Chargeback, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	var result chargebackResponse
+	if err := getJSON(ctx, cfg, chargebacksURL+url.PathEscape(chargebackID), &result); err != nil {
+		// A chargeback MP does not know will not appear on a redelivery either
+		return nil, mpResourceError(err, domain.ErrInvalidRequest,
+			"failed to get chargeback", "MP_CHARGEBACK_ERROR")
+	}
+
+	return toChargeback(chargebackID, &result)
+}
+
+// toChargeback converts an MP chargeback into the domain entity. It stays
+// open until MP reports whether coverage applies.
+func toChargeback(chargebackID string, result *chargebackResponse) (*domain.Chargeback, error) {
+	amount, err := mpAmount(result.Amount, result.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	chargeback := &domain.Chargeback{
+		ChargebackID:          chargebackID,
+		Amount:                amount,
+		Currency:              result.Currency,
+		Status:                domain.ChargebackOpen,
+		CoverageEligible:      result.CoverageElegible,
+		DocumentationRequired: result.DocumentationRequired,
+		DocumentationStatus:   result.DocumentationStatus,
+		DocumentationDeadline: result.DateDocumentationDeadline,
+		DateCreated:           result.DateCreated,
+		DateLastUpdated:       result.DateLastUpdated,
+	}
+	if len(result.Payments) > 0 {
+		chargeback.PaymentID = result.Payments[0].String()
+	}
+	if result.CoverageApplied != nil {
+		chargeback.Status = domain.ChargebackResolved
+		chargeback.CoverageApplied = *result.CoverageApplied
+	}
+	return chargeback, nil
+}
+
+// getJSON sends an authenticated GET through the SDK's requester and decodes
+// the response into v. Error responses are returned as *mperror.ResponseError,
+// like the SDK's, so mpResourceError can classify them.
+func getJSON(ctx context.Context, cfg *config.Config, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+
+	res, err := cfg.Requester.Do(req)
+	if err != nil {
+		return fmt.Errorf("transport level error: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return &mperror.ResponseError{
+			StatusCode: res.StatusCode,
+			Message:    "error reading response body: " + err.Error(),
+			Headers:    res.Header,
+		}
+	}
+	if res.StatusCode > 399 {
+		return &mperror.ResponseError{
+			StatusCode: res.StatusCode,
+			Message:    string(body),
+			Headers:    res.Header,
+		}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package mercadopago
+
+import (
+	"context"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/mercadopago/sdk-go/pkg/config"
+	"github.com/mercadopago/sdk-go/pkg/oauth"
+)
+
+// OAuthClient implements ports.OAuthGateway using the Mercado Pago SDK.
+type OAuthClient struct {
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	now          func() time.Time
+}
+
+// NewOAuthClient creates a new OAuth client for the platform application.
+// redirectURI must match the one registered for the application in MP.
+func NewOAuthClient(clientID, clientSecret, redirectURI string) *OAuthClient {
+	return &OAuthClient{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURI:  redirectURI,
+		now:          time.Now,
+	}
+}
+
+// Configured reports whether the application credentials are set.
+func (c *OAuthClient) Configured() bool {
+	return c.clientID != "" && c.clientSecret != ""
+}
+
+// AuthorizationURL returns the MP authorization URL carrying state.
+func (c *OAuthClient) AuthorizationURL(state string) string {
+	return oauth.NewClient(&config.Config{}).GetAuthorizationURL(c.clientID, c.redirectURI, state)
+}
+
+// ExchangeCode trades an authorization code for the gym's tokens.
+func (c *OAuthClient) ExchangeCode(ctx context.Context, code string) (*domain.OAuthToken, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.Create(ctx, code, c.redirectURI)
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrInvalidRequest,
+			"failed to exchange authorization code", "OAUTH_EXCHANGE_FAILED")
+	}
+	return c.toOAuthToken(result), nil
+}
+
+// RefreshToken renews a gym's tokens with its refresh token.
+func (c *OAuthClient) RefreshToken(ctx context.Context, refreshToken string) (*domain.OAuthToken, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.Refresh(ctx, refreshToken)
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrInvalidRequest,
+			"failed to refresh OAuth token", "OAUTH_REFRESH_FAILED")
+	}
+	return c.toOAuthToken(result), nil
+}
+
+// client returns an SDK client authenticated with the application secret.
+func (c *OAuthClient) client() (oauth.Client, error) {
+	cfg, err := config.New(c.clientSecret)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+	return oauth.NewClient(cfg), nil
+}
+
+// toOAuthToken converts an SDK OAuth response.
+func (c *OAuthClient) toOAuthToken(result *oauth.Response) *domain.OAuthToken {
+	return &domain.OAuthToken{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		PublicKey:    result.PublicKey,
+		Scope:        result.Scope,
+		LiveMode:     result.LiveMode,
+		ExpiresAt:    c.now().Add(time.Duration(result.ExpiresIn) * time.Second).UTC(),
+	}
+}
@@ -0,0 +1,217 @@
+package mercadopago
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/mercadopago/sdk-go/pkg/config"
+	"github.com/mercadopago/sdk-go/pkg/invoice"
+	"github.com/mercadopago/sdk-go/pkg/preapproval"
+	"github.com/mercadopago/sdk-go/pkg/preapprovalplan"
+)
+
+// CreatePlan creates a preapproval plan.
+func (a *Adapter) CreatePlan(ctx context.Context, accessToken string, req domain.SubscriptionPlanRequest, settings domain.GymSettings) (*domain.SubscriptionPlan, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	client := preapprovalplan.NewClient(cfg)
+
+	currency := settings.Currency
+	amount, err := req.Amount.WithCurrency(currency)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest, err.Error(), "INVALID_AMOUNT")
+	}
+	result, err := client.Create(ctx, preapprovalplan.Request{
+		Reason:  req.Reason,
+		BackURL: subscriptionBackURL(req.BackURL, settings),
+		AutoRecurring: &preapprovalplan.AutoRecurringRequest{
+			Frequency:         req.Frequency,
+			FrequencyType:     req.FrequencyType,
+			TransactionAmount: amount.Float64(),
+			CurrencyID:        currency,
+		},
+	})
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrSubscriptionNotFound,
+			"failed to create plan", "MP_PLAN_ERROR")
+	}
+
+	planAmount, err := mpAmount(result.AutoRecurring.TransactionAmount, result.AutoRecurring.CurrencyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.SubscriptionPlan{
+		PlanID:        result.ID,
+		Reason:        result.Reason,
+		Status:        result.Status,
+		Amount:        planAmount,
+		Currency:      result.AutoRecurring.CurrencyID,
+		Frequency:     result.AutoRecurring.Frequency,
+		FrequencyType: result.AutoRecurring.FrequencyType,
+		InitPoint:     result.InitPoint,
+	}, nil
+}
+
+// CreateSubscription creates a preapproval, attached to a plan when PlanID is set.
+// Without a card token the preapproval stays pending until the member
+// authorizes it at the returned init_point.
+func (a *Adapter) CreateSubscription(ctx context.Context, accessToken string, req domain.SubscriptionRequest, settings domain.GymSettings) (*domain.SubscriptionInfo, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	client := preapproval.NewClient(cfg)
+
+	preapprovalRequest := preapproval.Request{
+		PreapprovalPlanID: req.PlanID,
+		CardTokenID:       req.CardTokenID,
+		PayerEmail:        req.PayerEmail,
+		ExternalReference: req.ExternalReference,
+		Reason:            req.Reason,
+		BackURL:           subscriptionBackURL(req.BackURL, settings),
+	}
+	if req.PlanID == "" {
+		currency := settings.Currency
+		amount, err := req.Amount.WithCurrency(currency)
+		if err != nil {
+			return nil, domain.NewServiceError(domain.ErrInvalidRequest, err.Error(), "INVALID_AMOUNT")
+		}
+		preapprovalRequest.Status = domain.SubscriptionPending
+		preapprovalRequest.AutoRecurring = &preapproval.AutoRecurringRequest{
+			Frequency:         req.Frequency,
+			FrequencyType:     req.FrequencyType,
+			TransactionAmount: amount.Float64(),
+			CurrencyID:        currency,
+		}
+	} else if req.CardTokenID != "" {
+		preapprovalRequest.Status = domain.SubscriptionAuthorized
+	}
+
+	result, err := client.Create(ctx, preapprovalRequest)
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrSubscriptionNotFound,
+			"failed to create subscription", "MP_SUBSCRIPTION_ERROR")
+	}
+
+	return toSubscriptionInfo(result)
+}
+
+// GetSubscription retrieves a preapproval from Mercado Pago.
+func (a *Adapter) GetSubscription(ctx context.Context, accessToken string, subscriptionID string) (*domain.SubscriptionInfo, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	client := preapproval.NewClient(cfg)
+
+	result, err := client.Get(ctx, subscriptionID)
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrSubscriptionNotFound,
+			"failed to get subscription", "MP_SUBSCRIPTION_ERROR")
+	}
+
+	return toSubscriptionInfo(result)
+}
+
+// UpdateSubscriptionStatus pauses, resumes (authorized) or cancels a preapproval.
+func (a *Adapter) UpdateSubscriptionStatus(ctx context.Context, accessToken string, subscriptionID string, status string) (*domain.SubscriptionInfo, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	client := preapproval.NewClient(cfg)
+
+	result, err := client.Update(ctx, subscriptionID, preapproval.UpdateRequest{Status: status})
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrSubscriptionNotFound,
+			"failed to update subscription", "MP_SUBSCRIPTION_ERROR")
+	}
+
+	return toSubscriptionInfo(result)
+}
+
+// GetSubscriptionCharge retrieves an authorized payment (subscription invoice).
+func (a *Adapter) GetSubscriptionCharge(ctx context.Context, accessToken string, chargeID string) (*domain.SubscriptionCharge, error) {
+	cfg, err := config.New(accessToken)
+	if err != nil {
+		return nil, domain.NewServiceError(domain.ErrPaymentGatewayError,
+			"failed to create MP config", "MP_CONFIG_ERROR")
+	}
+
+	client := invoice.NewClient(cfg)
+
+	result, err := client.Get(ctx, chargeID)
+	if err != nil {
+		return nil, mpResourceError(err, domain.ErrSubscriptionNotFound,
+			"failed to get subscription charge", "MP_SUBSCRIPTION_ERROR")
+	}
+
+	amount, err := mpAmount(result.TransactionAmount, result.CurrencyID)
+	if err != nil {
+		return nil, err
+	}
+
+	charge := &domain.SubscriptionCharge{
+		ChargeID:          strconv.Itoa(result.ID),
+		SubscriptionID:    result.PreapprovalID,
+		ExternalReference: result.ExternalReference,
+		Status:            result.Status,
+		PaymentStatus:     result.Payment.Status,
+		Amount:            amount,
+		Currency:          result.CurrencyID,
+		RetryAttempt:      result.RetryAttempt,
+		DebitDate:         result.DebitDate,
+	}
+	if result.Payment.ID != 0 {
+		charge.PaymentID = strconv.Itoa(result.Payment.ID)
+	}
+	return charge, nil
+}
+
+// toSubscriptionInfo converts an MP preapproval into the domain entity.
+func toSubscriptionInfo(result *preapproval.Response) (*domain.SubscriptionInfo, error) {
+	amount, err := mpAmount(result.AutoRecurring.TransactionAmount, result.AutoRecurring.CurrencyID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &domain.SubscriptionInfo{
+		SubscriptionID:    result.ID,
+		PlanID:            result.PreapprovalPlanID,
+		Status:            result.Status,
+		ExternalReference: result.ExternalReference,
+		PayerEmail:        result.PayerEmail,
+		Reason:            result.Reason,
+		Amount:            amount,
+		Currency:          result.AutoRecurring.CurrencyID,
+		Frequency:         result.AutoRecurring.Frequency,
+		FrequencyType:     result.AutoRecurring.FrequencyType,
+		InitPoint:         result.InitPoint,
+	}
+	if !result.NextPaymentDate.IsZero() {
+		next := result.NextPaymentDate
+		info.NextPaymentDate = &next
+	}
+	return info, nil
+}
+
+// subscriptionBackURL returns the URL MP redirects the member to after
+// authorizing a subscription.
+func subscriptionBackURL(backURL string, settings domain.GymSettings) string {
+	if backURL != "" {
+		return backURL
+	}
+	return settings.SubscriptionURL
+}
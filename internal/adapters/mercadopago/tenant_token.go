@@ -0,0 +1,38 @@
+package mercadopago
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// TenantTokenSigner signs the tenant_token embedded in notification URLs,
+// so a webhook can only be routed to the gym its preference was created for.
+type TenantTokenSigner struct {
+	secret []byte
+}
+
+// NewTenantTokenSigner creates a new tenant token signer.
+// An empty secret disables tenant tokens.
+func NewTenantTokenSigner(secret string) *TenantTokenSigner {
+	return &TenantTokenSigner{secret: []byte(secret)}
+}
+
+// Sign returns the token for a gym, or "" when tokens are disabled.
+func (s *TenantTokenSigner) Sign(gymSlug string) string {
+	if len(s.secret) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("tenant:" + gymSlug))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether token was signed for gymSlug.
+// Any token is accepted when tokens are disabled.
+func (s *TenantTokenSigner) Verify(gymSlug, token string) bool {
+	if len(s.secret) == 0 {
+		return true
+	}
+	return hmac.Equal([]byte(token), []byte(s.Sign(gymSlug)))
+}
@@ -0,0 +1,66 @@
+package mercadopago
+
+import (
+	"testing"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+func TestTenantTokenSigner(t *testing.T) {
+	signer := NewTenantTokenSigner("secret")
+	token := signer.Sign("level-gym")
+
+	tests := []struct {
+		name    string
+		signer  *TenantTokenSigner
+		gymSlug string
+		token   string
+		want    bool
+	}{
+		{name: "own token", signer: signer, gymSlug: "level-gym", token: token, want: true},
+		{name: "another gym's token", signer: signer, gymSlug: "other-gym", token: token},
+		{name: "other secret", signer: NewTenantTokenSigner("rotated"), gymSlug: "level-gym", token: token},
+		{name: "missing token", signer: signer, gymSlug: "level-gym"},
+		{name: "disabled", signer: NewTenantTokenSigner(""), gymSlug: "other-gym", token: token, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.signer.Verify(tt.gymSlug, tt.token); got != tt.want {
+				t.Errorf("Verify(%q) = %t, want %t", tt.gymSlug, got, tt.want)
+			}
+		})
+	}
+
+	if got := NewTenantTokenSigner("").Sign("level-gym"); got != "" {
+		t.Errorf("disabled Sign() = %q, want no token", got)
+	}
+}
+
+func TestNotificationURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings domain.GymSettings
+		want     string
+	}{
+		{
+			name:     "without token",
+			settings: domain.GymSettings{GymSlug: "level-gym", NotificationBaseURL: "https://staging.example.com/"},
+			want:     "https://staging.example.com/webhooks/level-gym",
+		},
+		{
+			name: "with token",
+			settings: domain.GymSettings{GymSlug: "level gym", NotificationBaseURL: "https://payments.example.com",
+				NotificationToken: "a+b/c"},
+			want: "https://payments.example.com/webhooks/level%20gym?tenant_token=a%2Bb%2Fc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := notificationURL(tt.settings); got != tt.want {
+				t.Errorf("notificationURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
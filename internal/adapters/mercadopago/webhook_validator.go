@@ -6,42 +6,66 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // WebhookValidator validates Mercado Pago webhook signatures.
-type WebhookValidator struct{}
+type WebhookValidator struct {
+	// tolerance is the maximum age (or clock skew) accepted for the signed ts.
+	// Zero disables the timestamp check.
+	tolerance time.Duration
+	now       func() time.Time
+}
 
 // NewWebhookValidator creates a new webhook validator.
-func NewWebhookValidator() *WebhookValidator {
-	return &WebhookValidator{}
+// Signatures whose ts is further than tolerance from now are rejected.
+func NewWebhookValidator(tolerance time.Duration) *WebhookValidator {
+	return &WebhookValidator{
+		tolerance: tolerance,
+		now:       time.Now,
+	}
 }
 
-// ValidateSignature validates the x-signature header from Mercado Pago.
+// ValidateSignature validates the x-signature header from Mercado Pago
+// against each of secrets and returns the index of the one that matched.
 // See: https://www.mercadopago.com.ar/developers/es/docs/your-integrations/notifications/webhooks
 //
 // The x-signature header contains: ts=<timestamp>,v1=<signature>
 // The signature is HMAC-SHA256 of: id:<data.id>;request-id:<x-request-id>;ts:<timestamp>;
-func (v *WebhookValidator) ValidateSignature(xSignature, xRequestID, dataID, secret string) bool {
-	if xSignature == "" || secret == "" {
-		return false
+func (v *WebhookValidator) ValidateSignature(xSignature, xRequestID, dataID string, secrets []string) (int, bool) {
+	if xSignature == "" || len(secrets) == 0 {
+		return -1, false
 	}
 
 	// Parse x-signature header
 	ts, hash := parseSignatureHeader(xSignature)
 	if ts == "" || hash == "" {
-		return false
+		return -1, false
+	}
+
+	// Reject stale or future-dated signatures (replay protection)
+	if !v.timestampWithinTolerance(ts) {
+		return -1, false
 	}
 
 	// Build the manifest string
 	// Format: id:<data.id>;request-id:<x-request-id>;ts:<timestamp>;
 	manifest := buildManifest(dataID, xRequestID, ts)
 
-	// Calculate expected signature
-	expectedHash := calculateHMAC(manifest, secret)
-
-	// Compare signatures (constant-time comparison)
-	return hmac.Equal([]byte(hash), []byte(expectedHash))
+	// Compare against every secret (constant-time comparison)
+	matched := -1
+	for i, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		expectedHash := calculateHMAC(manifest, secret)
+		if hmac.Equal([]byte(hash), []byte(expectedHash)) && matched < 0 {
+			matched = i
+		}
+	}
+	return matched, matched >= 0
 }
 
 // parseSignatureHeader extracts ts and v1 values from x-signature header.
@@ -63,6 +87,32 @@ func parseSignatureHeader(header string) (ts, hash string) {
 	return ts, hash
 }
 
+// timestampWithinTolerance checks the signed ts against the tolerance window.
+// MP sends ts in milliseconds, but seconds are accepted as well.
+func (v *WebhookValidator) timestampWithinTolerance(ts string) bool {
+	if v.tolerance <= 0 {
+		return true
+	}
+
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || n <= 0 {
+		return false
+	}
+
+	var signedAt time.Time
+	if n >= 1e12 {
+		signedAt = time.UnixMilli(n)
+	} else {
+		signedAt = time.Unix(n, 0)
+	}
+
+	skew := v.now().Sub(signedAt)
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew <= v.tolerance
+}
+
 // buildManifest constructs the string to be signed.
 func buildManifest(dataID, requestID, ts string) string {
 	var parts []string
@@ -0,0 +1,84 @@
+package mercadopago
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookValidatorValidateSignature(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	sign := func(ts string) string {
+		return "ts=" + ts + ",v1=" + calculateHMAC(buildManifest("123456", "req-1", ts), "secret")
+	}
+	millis := func(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) }
+
+	tests := []struct {
+		name       string
+		tolerance  time.Duration
+		xSignature string
+		dataID     string
+		want       bool
+	}{
+		{name: "valid", tolerance: 5 * time.Minute, xSignature: sign(millis(now)), dataID: "123456", want: true},
+		{name: "timestamp in seconds", tolerance: 5 * time.Minute,
+			xSignature: sign(strconv.FormatInt(now.Unix(), 10)), dataID: "123456", want: true},
+		{name: "within skew", tolerance: 5 * time.Minute,
+			xSignature: sign(millis(now.Add(4 * time.Minute))), dataID: "123456", want: true},
+		{name: "stale", tolerance: 5 * time.Minute,
+			xSignature: sign(millis(now.Add(-6 * time.Minute))), dataID: "123456"},
+		{name: "future-dated", tolerance: 5 * time.Minute,
+			xSignature: sign(millis(now.Add(6 * time.Minute))), dataID: "123456"},
+		{name: "stale without tolerance", xSignature: sign(millis(now.Add(-time.Hour))), dataID: "123456", want: true},
+		{name: "signed for another payment", tolerance: 5 * time.Minute, xSignature: sign(millis(now)), dataID: "654321"},
+		{name: "wrong hash", tolerance: 5 * time.Minute, xSignature: "ts=" + millis(now) + ",v1=deadbeef", dataID: "123456"},
+		{name: "invalid timestamp", tolerance: 5 * time.Minute, xSignature: sign("yesterday"), dataID: "123456"},
+		{name: "missing hash", tolerance: 5 * time.Minute, xSignature: "ts=" + millis(now), dataID: "123456"},
+		{name: "missing header", tolerance: 5 * time.Minute, dataID: "123456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewWebhookValidator(tt.tolerance)
+			v.now = func() time.Time { return now }
+
+			_, ok := v.ValidateSignature(tt.xSignature, "req-1", tt.dataID, []string{"secret"})
+			if ok != tt.want {
+				t.Errorf("ValidateSignature() = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookValidatorValidateSignatureSecrets(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	ts := strconv.FormatInt(now.UnixMilli(), 10)
+	sign := func(secret string) string {
+		return "ts=" + ts + ",v1=" + calculateHMAC(buildManifest("123456", "req-1", ts), secret)
+	}
+
+	tests := []struct {
+		name        string
+		secrets     []string
+		xSignature  string
+		wantMatched int
+		wantOK      bool
+	}{
+		{name: "current secret", secrets: []string{"new", "old"}, xSignature: sign("new"), wantMatched: 0, wantOK: true},
+		{name: "previous secret", secrets: []string{"new", "old"}, xSignature: sign("old"), wantMatched: 1, wantOK: true},
+		{name: "retired secret", secrets: []string{"new"}, xSignature: sign("old")},
+		{name: "no secrets", xSignature: sign("new")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewWebhookValidator(5 * time.Minute)
+			v.now = func() time.Time { return now }
+
+			matched, ok := v.ValidateSignature(tt.xSignature, "req-1", "123456", tt.secrets)
+			if ok != tt.wantOK || ok && matched != tt.wantMatched {
+				t.Errorf("ValidateSignature() = %d, %v, want %d, %v", matched, ok, tt.wantMatched, tt.wantOK)
+			}
+		})
+	}
+}
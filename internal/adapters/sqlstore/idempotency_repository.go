@@ -0,0 +1,159 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// pendingKeyTTL is how long a pending key blocks retries before it is
+// considered abandoned (e.g. the process died mid-request) and taken over.
+const pendingKeyTTL = 2 * time.Minute
+
+// completedKeyTTL is how long a completed key replays its response. After
+// that, or once the replayed preference expired, the key is free again.
+const completedKeyTTL = 24 * time.Hour
+
+// IdempotencyRepository implements ports.IdempotencyRepository.
+type IdempotencyRepository struct {
+	db *DB
+}
+
+// NewIdempotencyRepository creates a new SQL-backed idempotency key store.
+func NewIdempotencyRepository(db *DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// ReserveKey claims the record's key for a new request. A key whose record
+// expired, or that was abandoned while pending by a request with the same
+// body, is taken over as if it were missing.
+func (r *IdempotencyRepository) ReserveKey(ctx context.Context, record domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	var (
+		existing *domain.IdempotencyRecord
+		reserved bool
+	)
+
+	err := r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+
+		res, err := r.db.conn(ctx).ExecContext(ctx, `
+			INSERT INTO checkout_idempotency
+				(idempotency_key, gym_slug, request_hash, status, response, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $6)
+			ON CONFLICT (idempotency_key) DO NOTHING`,
+			record.Key, record.GymSlug, record.RequestHash, domain.IdempotencyPending, "{}", now)
+		if err != nil {
+			return repositoryError("failed to reserve idempotency key", err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			reserved = true
+			return nil
+		}
+
+		existing, err = r.get(ctx, record.Key)
+		if err != nil {
+			return err
+		}
+		if !reusable(existing, record.RequestHash, now) {
+			return nil
+		}
+
+		_, err = r.db.conn(ctx).ExecContext(ctx, `
+			UPDATE checkout_idempotency
+			SET gym_slug = $1, request_hash = $2, status = $3, response = $4, created_at = $5, updated_at = $5
+			WHERE idempotency_key = $6`,
+			record.GymSlug, record.RequestHash, domain.IdempotencyPending, "{}", now, record.Key)
+		if err != nil {
+			return repositoryError("failed to reserve idempotency key", err)
+		}
+		existing, reserved = nil, true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, reserved, nil
+}
+
+// reusable reports whether an existing record can be taken over by a
+// request with requestHash.
+func reusable(existing *domain.IdempotencyRecord, requestHash string, now time.Time) bool {
+	switch existing.Status {
+	case domain.IdempotencyPending:
+		// Only the same request may resume an abandoned one
+		return existing.RequestHash == requestHash &&
+			existing.UpdatedAt.Before(now.Add(-pendingKeyTTL))
+	case domain.IdempotencyCompleted:
+		if expiresAt := existing.Response.ExpiresAt; expiresAt != nil && !now.Before(*expiresAt) {
+			return true
+		}
+		return existing.UpdatedAt.Before(now.Add(-completedKeyTTL))
+	default:
+		return false
+	}
+}
+
+// CompleteKey stores the response for a reserved key.
+func (r *IdempotencyRepository) CompleteKey(ctx context.Context, key string, response domain.PaymentResponse) error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return repositoryError("failed to marshal response", err)
+	}
+
+	_, err = r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE checkout_idempotency
+		SET status = $1, response = $2, updated_at = $3
+		WHERE idempotency_key = $4`,
+		domain.IdempotencyCompleted, string(body), time.Now().UTC(), key)
+	if err != nil {
+		return repositoryError("failed to complete idempotency key", err)
+	}
+	return nil
+}
+
+// ReleaseKey drops a pending key so the request can be retried.
+func (r *IdempotencyRepository) ReleaseKey(ctx context.Context, key string) error {
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		DELETE FROM checkout_idempotency
+		WHERE idempotency_key = $1 AND status = $2`,
+		key, domain.IdempotencyPending)
+	if err != nil {
+		return repositoryError("failed to release idempotency key", err)
+	}
+	return nil
+}
+
+// get loads an idempotency record by key. On Postgres its row stays locked
+// until the surrounding transaction ends.
+func (r *IdempotencyRepository) get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	var (
+		record   domain.IdempotencyRecord
+		response string
+	)
+	query := `
+		SELECT idempotency_key, gym_slug, request_hash, status, response, created_at, updated_at
+		FROM checkout_idempotency
+		WHERE idempotency_key = $1`
+	if r.db.driver == DriverPostgres {
+		query += ` FOR UPDATE`
+	}
+	err := r.db.conn(ctx).QueryRowContext(ctx, query, key).
+		Scan(&record.Key, &record.GymSlug, &record.RequestHash, &record.Status, &response,
+			&record.CreatedAt, &record.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released between our insert attempt and this read
+		return nil, repositoryError("idempotency key vanished", err)
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get idempotency key", err)
+	}
+
+	if err := json.Unmarshal([]byte(response), &record.Response); err != nil {
+		return nil, repositoryError("failed to decode stored response", err)
+	}
+	return &record, nil
+}
@@ -0,0 +1,156 @@
+package sqlstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+func TestIdempotencyRepositoryReserveKey(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// setup prepares the key before the request under test reserves it
+		setup        func(t *testing.T, repo *IdempotencyRepository)
+		hash         string
+		wantReserved bool
+		wantStatus   string
+	}{
+		{
+			name:         "new key",
+			hash:         "hash-a",
+			wantReserved: true,
+		},
+		{
+			name: "pending key",
+			setup: func(t *testing.T, repo *IdempotencyRepository) {
+				reserve(t, repo, "hash-a")
+			},
+			hash:       "hash-a",
+			wantStatus: domain.IdempotencyPending,
+		},
+		{
+			name: "abandoned pending key, same request",
+			setup: func(t *testing.T, repo *IdempotencyRepository) {
+				reserve(t, repo, "hash-a")
+				age(t, repo, pendingKeyTTL+time.Minute)
+			},
+			hash:         "hash-a",
+			wantReserved: true,
+		},
+		{
+			name: "abandoned pending key, different request",
+			setup: func(t *testing.T, repo *IdempotencyRepository) {
+				reserve(t, repo, "hash-a")
+				age(t, repo, pendingKeyTTL+time.Minute)
+			},
+			hash:       "hash-b",
+			wantStatus: domain.IdempotencyPending,
+		},
+		{
+			name: "completed key",
+			setup: func(t *testing.T, repo *IdempotencyRepository) {
+				reserve(t, repo, "hash-a")
+				complete(t, repo, &future)
+			},
+			hash:       "hash-a",
+			wantStatus: domain.IdempotencyCompleted,
+		},
+		{
+			name: "completed key whose preference expired",
+			setup: func(t *testing.T, repo *IdempotencyRepository) {
+				reserve(t, repo, "hash-a")
+				complete(t, repo, &past)
+			},
+			hash:         "hash-a",
+			wantReserved: true,
+		},
+		{
+			name: "completed key past its TTL",
+			setup: func(t *testing.T, repo *IdempotencyRepository) {
+				reserve(t, repo, "hash-a")
+				complete(t, repo, nil)
+				age(t, repo, completedKeyTTL+time.Minute)
+			},
+			hash:         "hash-b",
+			wantReserved: true,
+		},
+		{
+			name: "released key",
+			setup: func(t *testing.T, repo *IdempotencyRepository) {
+				reserve(t, repo, "hash-a")
+				if err := repo.ReleaseKey(context.Background(), "key-1"); err != nil {
+					t.Fatalf("ReleaseKey: %v", err)
+				}
+			},
+			hash:         "hash-b",
+			wantReserved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewIdempotencyRepository(openTestDB(t))
+			if tt.setup != nil {
+				tt.setup(t, repo)
+			}
+
+			existing, reserved, err := repo.ReserveKey(context.Background(), domain.IdempotencyRecord{
+				Key: "key-1", GymSlug: "level-gym", RequestHash: tt.hash,
+			})
+			if err != nil {
+				t.Fatalf("ReserveKey: %v", err)
+			}
+			if reserved != tt.wantReserved {
+				t.Fatalf("reserved = %v, want %v", reserved, tt.wantReserved)
+			}
+			if tt.wantReserved {
+				if existing != nil {
+					t.Errorf("existing = %+v, want nil", existing)
+				}
+				return
+			}
+			if existing == nil || existing.Status != tt.wantStatus {
+				t.Fatalf("existing = %+v, want status %q", existing, tt.wantStatus)
+			}
+			if existing.Status == domain.IdempotencyCompleted && existing.Response.PreferenceID != "pref-1" {
+				t.Errorf("replayed preference = %q, want pref-1", existing.Response.PreferenceID)
+			}
+		})
+	}
+}
+
+// reserve reserves key-1 for a request with hash.
+func reserve(t *testing.T, repo *IdempotencyRepository, hash string) {
+	t.Helper()
+	_, reserved, err := repo.ReserveKey(context.Background(), domain.IdempotencyRecord{
+		Key: "key-1", GymSlug: "level-gym", RequestHash: hash,
+	})
+	if err != nil || !reserved {
+		t.Fatalf("ReserveKey = %v, %v; want reserved", reserved, err)
+	}
+}
+
+// complete stores key-1's response, a preference expiring at expiresAt.
+func complete(t *testing.T, repo *IdempotencyRepository, expiresAt *time.Time) {
+	t.Helper()
+	if err := repo.CompleteKey(context.Background(), "key-1", domain.PaymentResponse{
+		Success: true, PreferenceID: "pref-1", ExpiresAt: expiresAt,
+	}); err != nil {
+		t.Fatalf("CompleteKey: %v", err)
+	}
+}
+
+// age moves key-1's last update back by d.
+func age(t *testing.T, repo *IdempotencyRepository, d time.Duration) {
+	t.Helper()
+	if _, err := repo.db.ExecContext(context.Background(),
+		`UPDATE checkout_idempotency SET updated_at = $1 WHERE idempotency_key = $2`,
+		time.Now().UTC().Add(-d), "key-1"); err != nil {
+		t.Fatalf("age key: %v", err)
+	}
+}
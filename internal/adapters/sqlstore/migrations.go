@@ -0,0 +1,525 @@
+package sqlstore
+
+// migrations is the ordered list of schema changes.
+// Never edit an applied migration; append a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "payment_ledger",
+		sqlite: []string{
+			`CREATE TABLE payment_preferences (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				gym_slug TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				preference_id TEXT NOT NULL,
+				title TEXT NOT NULL,
+				amount REAL NOT NULL,
+				payer_email TEXT NOT NULL,
+				init_point TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX idx_payment_preferences_ref ON payment_preferences (gym_slug, external_reference)`,
+			`CREATE TABLE payment_snapshots (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				gym_slug TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				status TEXT NOT NULL,
+				status_detail TEXT NOT NULL,
+				amount REAL NOT NULL,
+				currency TEXT NOT NULL,
+				payment_method TEXT NOT NULL,
+				payment_type TEXT NOT NULL,
+				payer_email TEXT NOT NULL,
+				date_approved TIMESTAMP NOT NULL,
+				fetched_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX idx_payment_snapshots_payment ON payment_snapshots (gym_slug, payment_id)`,
+			`CREATE INDEX idx_payment_snapshots_ref ON payment_snapshots (gym_slug, external_reference)`,
+			`CREATE TABLE payment_status_changes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				gym_slug TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				from_status TEXT NOT NULL,
+				to_status TEXT NOT NULL,
+				changed_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX idx_payment_status_changes_ref ON payment_status_changes (gym_slug, external_reference)`,
+		},
+		postgres: []string{
+			`CREATE TABLE payment_preferences (
+				id BIGSERIAL PRIMARY KEY,
+				gym_slug TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				preference_id TEXT NOT NULL,
+				title TEXT NOT NULL,
+				amount DOUBLE PRECISION NOT NULL,
+				payer_email TEXT NOT NULL,
+				init_point TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX idx_payment_preferences_ref ON payment_preferences (gym_slug, external_reference)`,
+			`CREATE TABLE payment_snapshots (
+				id BIGSERIAL PRIMARY KEY,
+				gym_slug TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				status TEXT NOT NULL,
+				status_detail TEXT NOT NULL,
+				amount DOUBLE PRECISION NOT NULL,
+				currency TEXT NOT NULL,
+				payment_method TEXT NOT NULL,
+				payment_type TEXT NOT NULL,
+				payer_email TEXT NOT NULL,
+				date_approved TIMESTAMPTZ NOT NULL,
+				fetched_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX idx_payment_snapshots_payment ON payment_snapshots (gym_slug, payment_id)`,
+			`CREATE INDEX idx_payment_snapshots_ref ON payment_snapshots (gym_slug, external_reference)`,
+			`CREATE TABLE payment_status_changes (
+				id BIGSERIAL PRIMARY KEY,
+				gym_slug TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				from_status TEXT NOT NULL,
+				to_status TEXT NOT NULL,
+				changed_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX idx_payment_status_changes_ref ON payment_status_changes (gym_slug, external_reference)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "checkout_idempotency",
+		sqlite: []string{
+			`CREATE TABLE checkout_idempotency (
+				idempotency_key TEXT PRIMARY KEY,
+				gym_slug TEXT NOT NULL,
+				request_hash TEXT NOT NULL,
+				status TEXT NOT NULL,
+				response TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+		},
+		postgres: []string{
+			`CREATE TABLE checkout_idempotency (
+				idempotency_key TEXT PRIMARY KEY,
+				gym_slug TEXT NOT NULL,
+				request_hash TEXT NOT NULL,
+				status TEXT NOT NULL,
+				response JSONB NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 3,
+		name:    "webhook_events",
+		sqlite: []string{
+			`CREATE TABLE webhook_events (
+				gym_slug TEXT NOT NULL,
+				event_key TEXT NOT NULL,
+				status TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (gym_slug, event_key)
+			)`,
+		},
+		postgres: []string{
+			`CREATE TABLE webhook_events (
+				gym_slug TEXT NOT NULL,
+				event_key TEXT NOT NULL,
+				status TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (gym_slug, event_key)
+			)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "django_outbox",
+		sqlite: []string{
+			`CREATE TABLE django_outbox (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				gym_slug TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				last_error TEXT NOT NULL DEFAULT '',
+				next_attempt_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX idx_django_outbox_due ON django_outbox (status, next_attempt_at)`,
+		},
+		postgres: []string{
+			`CREATE TABLE django_outbox (
+				id BIGSERIAL PRIMARY KEY,
+				gym_slug TEXT NOT NULL,
+				payload JSONB NOT NULL,
+				status TEXT NOT NULL,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				last_error TEXT NOT NULL DEFAULT '',
+				next_attempt_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX idx_django_outbox_due ON django_outbox (status, next_attempt_at)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "django_outbox_http_status",
+		sqlite: []string{
+			`ALTER TABLE django_outbox ADD COLUMN last_http_status INTEGER NOT NULL DEFAULT 0`,
+		},
+		postgres: []string{
+			`ALTER TABLE django_outbox ADD COLUMN last_http_status INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version: 6,
+		name:    "subscriptions",
+		sqlite: []string{
+			`CREATE TABLE subscriptions (
+				gym_slug TEXT NOT NULL,
+				subscription_id TEXT NOT NULL,
+				plan_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				status TEXT NOT NULL,
+				payer_email TEXT NOT NULL,
+				amount REAL NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (gym_slug, subscription_id)
+			)`,
+			`CREATE TABLE subscription_charges (
+				gym_slug TEXT NOT NULL,
+				charge_id TEXT NOT NULL,
+				subscription_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				status TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				payment_status TEXT NOT NULL,
+				amount REAL NOT NULL,
+				currency TEXT NOT NULL,
+				retry_attempt INTEGER NOT NULL,
+				debit_date TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (gym_slug, charge_id)
+			)`,
+		},
+		postgres: []string{
+			`CREATE TABLE subscriptions (
+				gym_slug TEXT NOT NULL,
+				subscription_id TEXT NOT NULL,
+				plan_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				status TEXT NOT NULL,
+				payer_email TEXT NOT NULL,
+				amount DOUBLE PRECISION NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (gym_slug, subscription_id)
+			)`,
+			`CREATE TABLE subscription_charges (
+				gym_slug TEXT NOT NULL,
+				charge_id TEXT NOT NULL,
+				subscription_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				status TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				payment_status TEXT NOT NULL,
+				amount DOUBLE PRECISION NOT NULL,
+				currency TEXT NOT NULL,
+				retry_attempt INTEGER NOT NULL,
+				debit_date TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (gym_slug, charge_id)
+			)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "django_outbox_kind",
+		sqlite: []string{
+			`ALTER TABLE django_outbox ADD COLUMN kind TEXT NOT NULL DEFAULT 'payment'`,
+		},
+		postgres: []string{
+			`ALTER TABLE django_outbox ADD COLUMN kind TEXT NOT NULL DEFAULT 'payment'`,
+		},
+	},
+	{
+		version: 8,
+		name:    "payment_preference_items",
+		sqlite: []string{
+			`ALTER TABLE payment_preferences ADD COLUMN items TEXT NOT NULL DEFAULT '[]'`,
+		},
+		postgres: []string{
+			`ALTER TABLE payment_preferences ADD COLUMN items JSONB NOT NULL DEFAULT '[]'`,
+		},
+	},
+	{
+		version: 9,
+		name:    "exact_amounts",
+		sqlite: []string{
+			// A gym charges in one currency: take it from its recorded payments
+			`ALTER TABLE payment_preferences ADD COLUMN currency TEXT NOT NULL DEFAULT 'ARS'`,
+			`UPDATE payment_preferences SET currency = COALESCE((
+				SELECT s.currency FROM payment_snapshots s
+				WHERE s.gym_slug = payment_preferences.gym_slug
+				ORDER BY s.fetched_at DESC LIMIT 1), 'ARS')`,
+			`ALTER TABLE subscriptions ADD COLUMN currency TEXT NOT NULL DEFAULT 'ARS'`,
+			`UPDATE subscriptions SET currency = COALESCE((
+				SELECT s.currency FROM payment_snapshots s
+				WHERE s.gym_slug = subscriptions.gym_slug
+				ORDER BY s.fetched_at DESC LIMIT 1), 'ARS')`,
+			// Minor units per currency exponent: CLP has none, the rest two
+			`ALTER TABLE payment_preferences ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE payment_preferences SET amount_minor = CAST(ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END) AS INTEGER)`,
+			`ALTER TABLE payment_snapshots ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE payment_snapshots SET amount_minor = CAST(ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END) AS INTEGER)`,
+			`ALTER TABLE subscriptions ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE subscriptions SET amount_minor = CAST(ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END) AS INTEGER)`,
+			`ALTER TABLE subscription_charges ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE subscription_charges SET amount_minor = CAST(ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END) AS INTEGER)`,
+			`ALTER TABLE subscription_charges DROP COLUMN amount`,
+		},
+		postgres: []string{
+			`ALTER TABLE payment_preferences ADD COLUMN currency TEXT NOT NULL DEFAULT 'ARS'`,
+			`UPDATE payment_preferences SET currency = COALESCE((
+				SELECT s.currency FROM payment_snapshots s
+				WHERE s.gym_slug = payment_preferences.gym_slug
+				ORDER BY s.fetched_at DESC LIMIT 1), 'ARS')`,
+			`ALTER TABLE subscriptions ADD COLUMN currency TEXT NOT NULL DEFAULT 'ARS'`,
+			`UPDATE subscriptions SET currency = COALESCE((
+				SELECT s.currency FROM payment_snapshots s
+				WHERE s.gym_slug = subscriptions.gym_slug
+				ORDER BY s.fetched_at DESC LIMIT 1), 'ARS')`,
+			`ALTER TABLE payment_preferences ADD COLUMN amount_minor BIGINT NOT NULL DEFAULT 0`,
+			`UPDATE payment_preferences SET amount_minor = ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END)::BIGINT`,
+			`ALTER TABLE payment_snapshots ADD COLUMN amount_minor BIGINT NOT NULL DEFAULT 0`,
+			`UPDATE payment_snapshots SET amount_minor = ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END)::BIGINT`,
+			`ALTER TABLE subscriptions ADD COLUMN amount_minor BIGINT NOT NULL DEFAULT 0`,
+			`UPDATE subscriptions SET amount_minor = ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END)::BIGINT`,
+			`ALTER TABLE subscription_charges ADD COLUMN amount_minor BIGINT NOT NULL DEFAULT 0`,
+			`UPDATE subscription_charges SET amount_minor = ROUND(CASE currency WHEN 'CLP' THEN amount ELSE amount * 100 END)::BIGINT`,
+			`ALTER TABLE subscription_charges DROP COLUMN amount`,
+		},
+	},
+	{
+		version: 10,
+		name:    "request_nonces",
+		sqlite: []string{
+			`CREATE TABLE request_nonces (
+				nonce TEXT PRIMARY KEY,
+				expires_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX idx_request_nonces_expires ON request_nonces (expires_at)`,
+		},
+		postgres: []string{
+			`CREATE TABLE request_nonces (
+				nonce TEXT PRIMARY KEY,
+				expires_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX idx_request_nonces_expires ON request_nonces (expires_at)`,
+		},
+	},
+	{
+		version: 11,
+		name:    "gym_oauth_tokens",
+		sqlite: []string{
+			`CREATE TABLE gym_oauth_tokens (
+				gym_slug TEXT PRIMARY KEY,
+				access_token TEXT NOT NULL,
+				refresh_token TEXT NOT NULL,
+				public_key TEXT NOT NULL DEFAULT '',
+				scope TEXT NOT NULL DEFAULT '',
+				live_mode BOOLEAN NOT NULL DEFAULT FALSE,
+				expires_at TIMESTAMP NOT NULL,
+				next_refresh_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX idx_gym_oauth_tokens_expires ON gym_oauth_tokens (expires_at)`,
+		},
+		postgres: []string{
+			`CREATE TABLE gym_oauth_tokens (
+				gym_slug TEXT PRIMARY KEY,
+				access_token TEXT NOT NULL,
+				refresh_token TEXT NOT NULL,
+				public_key TEXT NOT NULL DEFAULT '',
+				scope TEXT NOT NULL DEFAULT '',
+				live_mode BOOLEAN NOT NULL DEFAULT FALSE,
+				expires_at TIMESTAMPTZ NOT NULL,
+				next_refresh_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX idx_gym_oauth_tokens_expires ON gym_oauth_tokens (expires_at)`,
+		},
+	},
+	{
+		version: 12,
+		name:    "payment_chargebacks",
+		sqlite: []string{
+			`CREATE TABLE payment_chargebacks (
+				gym_slug TEXT NOT NULL,
+				chargeback_id TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				amount_minor INTEGER NOT NULL,
+				currency TEXT NOT NULL,
+				status TEXT NOT NULL,
+				coverage_applied BOOLEAN NOT NULL DEFAULT FALSE,
+				coverage_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+				documentation_required BOOLEAN NOT NULL DEFAULT FALSE,
+				documentation_status TEXT NOT NULL DEFAULT '',
+				documentation_deadline TIMESTAMP,
+				date_created TIMESTAMP NOT NULL,
+				date_last_updated TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (gym_slug, chargeback_id)
+			)`,
+			`CREATE INDEX idx_payment_chargebacks_ref ON payment_chargebacks (gym_slug, external_reference)`,
+		},
+		postgres: []string{
+			`CREATE TABLE payment_chargebacks (
+				gym_slug TEXT NOT NULL,
+				chargeback_id TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				amount_minor BIGINT NOT NULL,
+				currency TEXT NOT NULL,
+				status TEXT NOT NULL,
+				coverage_applied BOOLEAN NOT NULL DEFAULT FALSE,
+				coverage_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+				documentation_required BOOLEAN NOT NULL DEFAULT FALSE,
+				documentation_status TEXT NOT NULL DEFAULT '',
+				documentation_deadline TIMESTAMPTZ,
+				date_created TIMESTAMPTZ NOT NULL,
+				date_last_updated TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (gym_slug, chargeback_id)
+			)`,
+			`CREATE INDEX idx_payment_chargebacks_ref ON payment_chargebacks (gym_slug, external_reference)`,
+		},
+	},
+	{
+		version: 13,
+		name:    "rejected_status_changes",
+		sqlite: []string{
+			`ALTER TABLE payment_status_changes ADD COLUMN rejected BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE payment_status_changes ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+		},
+		postgres: []string{
+			`ALTER TABLE payment_status_changes ADD COLUMN rejected BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE payment_status_changes ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 14,
+		name:    "reconciliation",
+		sqlite: []string{
+			`ALTER TABLE django_outbox ADD COLUMN payment_id TEXT NOT NULL DEFAULT ''`,
+			`UPDATE django_outbox SET payment_id = COALESCE(json_extract(payload, '$.payment_id'), '')
+				WHERE kind = 'payment'`,
+			`CREATE INDEX idx_django_outbox_payment ON django_outbox (gym_slug, payment_id)`,
+			`CREATE TABLE reconciliation_gyms (
+				gym_slug TEXT PRIMARY KEY,
+				next_run_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE TABLE reconciliation_reports (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				gym_slug TEXT NOT NULL,
+				window_from TIMESTAMP NOT NULL,
+				window_to TIMESTAMP NOT NULL,
+				checked INTEGER NOT NULL,
+				discrepancies TEXT NOT NULL,
+				error TEXT NOT NULL DEFAULT '',
+				started_at TIMESTAMP NOT NULL,
+				finished_at TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX idx_reconciliation_reports_gym ON reconciliation_reports (gym_slug, id)`,
+			// Schedule the gyms recorded so far
+			`INSERT INTO reconciliation_gyms (gym_slug, next_run_at)
+				SELECT gym_slug, CURRENT_TIMESTAMP FROM (
+					SELECT gym_slug FROM payment_preferences
+					UNION
+					SELECT gym_slug FROM payment_snapshots
+				) AS recorded`,
+		},
+		postgres: []string{
+			`ALTER TABLE django_outbox ADD COLUMN payment_id TEXT NOT NULL DEFAULT ''`,
+			`UPDATE django_outbox SET payment_id = COALESCE(payload->>'payment_id', '')
+				WHERE kind = 'payment'`,
+			`CREATE INDEX idx_django_outbox_payment ON django_outbox (gym_slug, payment_id)`,
+			`CREATE TABLE reconciliation_gyms (
+				gym_slug TEXT PRIMARY KEY,
+				next_run_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE TABLE reconciliation_reports (
+				id BIGSERIAL PRIMARY KEY,
+				gym_slug TEXT NOT NULL,
+				window_from TIMESTAMPTZ NOT NULL,
+				window_to TIMESTAMPTZ NOT NULL,
+				checked INTEGER NOT NULL,
+				discrepancies JSONB NOT NULL,
+				error TEXT NOT NULL DEFAULT '',
+				started_at TIMESTAMPTZ NOT NULL,
+				finished_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX idx_reconciliation_reports_gym ON reconciliation_reports (gym_slug, id)`,
+			// Schedule the gyms recorded so far
+			`INSERT INTO reconciliation_gyms (gym_slug, next_run_at)
+				SELECT gym_slug, CURRENT_TIMESTAMP FROM (
+					SELECT gym_slug FROM payment_preferences
+					UNION
+					SELECT gym_slug FROM payment_snapshots
+				) AS recorded`,
+		},
+	},
+	{
+		version: 15,
+		name:    "nullable_date_approved",
+		sqlite: []string{
+			// SQLite cannot drop a NOT NULL constraint: rebuild the table
+			`CREATE TABLE payment_snapshots_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				gym_slug TEXT NOT NULL,
+				payment_id TEXT NOT NULL,
+				external_reference TEXT NOT NULL,
+				status TEXT NOT NULL,
+				status_detail TEXT NOT NULL,
+				amount REAL NOT NULL,
+				currency TEXT NOT NULL,
+				payment_method TEXT NOT NULL,
+				payment_type TEXT NOT NULL,
+				payer_email TEXT NOT NULL,
+				date_approved TIMESTAMP,
+				fetched_at TIMESTAMP NOT NULL,
+				amount_minor INTEGER NOT NULL DEFAULT 0
+			)`,
+			`INSERT INTO payment_snapshots_new
+				(id, gym_slug, payment_id, external_reference, status, status_detail, amount, currency,
+				 payment_method, payment_type, payer_email, date_approved, fetched_at, amount_minor)
+				SELECT id, gym_slug, payment_id, external_reference, status, status_detail, amount, currency,
+					payment_method, payment_type, payer_email, date_approved, fetched_at, amount_minor
+				FROM payment_snapshots`,
+			`DROP TABLE payment_snapshots`,
+			`ALTER TABLE payment_snapshots_new RENAME TO payment_snapshots`,
+			`CREATE INDEX idx_payment_snapshots_payment ON payment_snapshots (gym_slug, payment_id)`,
+			`CREATE INDEX idx_payment_snapshots_ref ON payment_snapshots (gym_slug, external_reference)`,
+			// Unapproved payments were stored with the time they were fetched
+			`UPDATE payment_snapshots SET date_approved = NULL
+				WHERE status IN ('pending', 'in_process', 'authorized', 'rejected', 'cancelled')`,
+		},
+		postgres: []string{
+			`ALTER TABLE payment_snapshots ALTER COLUMN date_approved DROP NOT NULL`,
+			`UPDATE payment_snapshots SET date_approved = NULL
+				WHERE status IN ('pending', 'in_process', 'authorized', 'rejected', 'cancelled')`,
+		},
+	},
+}
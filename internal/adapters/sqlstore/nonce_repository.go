@@ -0,0 +1,37 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+)
+
+// NonceRepository implements ports.NonceStore.
+type NonceRepository struct {
+	db *DB
+}
+
+// NewNonceRepository creates a new SQL-backed signed request nonce store.
+func NewNonceRepository(db *DB) *NonceRepository {
+	return &NonceRepository{db: db}
+}
+
+// UseNonce records a nonce until expiresAt. Expired nonces are purged first.
+func (r *NonceRepository) UseNonce(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	now := time.Now().UTC()
+
+	if _, err := r.db.conn(ctx).ExecContext(ctx, `
+		DELETE FROM request_nonces WHERE expires_at < $1`, now); err != nil {
+		return false, repositoryError("failed to purge request nonces", err)
+	}
+
+	res, err := r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO request_nonces (nonce, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (nonce) DO NOTHING`,
+		nonce, expiresAt.UTC())
+	if err != nil {
+		return false, repositoryError("failed to record request nonce", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
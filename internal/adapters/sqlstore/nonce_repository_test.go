@@ -0,0 +1,42 @@
+package sqlstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNonceRepositoryUseNonce(t *testing.T) {
+	tests := []struct {
+		name string
+		// used is a nonce recorded before, expiring at its offset from now
+		used      map[string]time.Duration
+		nonce     string
+		wantFresh bool
+	}{
+		{name: "new nonce", nonce: "nonce-1", wantFresh: true},
+		{name: "replayed nonce", used: map[string]time.Duration{"nonce-1": 5 * time.Minute}, nonce: "nonce-1"},
+		{name: "expired nonce", used: map[string]time.Duration{"nonce-1": -time.Second}, nonce: "nonce-1", wantFresh: true},
+		{name: "other nonce", used: map[string]time.Duration{"nonce-1": 5 * time.Minute}, nonce: "nonce-2", wantFresh: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewNonceRepository(openTestDB(t))
+			for nonce, ttl := range tt.used {
+				if fresh, err := repo.UseNonce(ctx, nonce, time.Now().Add(ttl)); err != nil || !fresh {
+					t.Fatalf("UseNonce = %v, %v; want fresh", fresh, err)
+				}
+			}
+
+			fresh, err := repo.UseNonce(ctx, tt.nonce, time.Now().Add(5*time.Minute))
+			if err != nil {
+				t.Fatalf("UseNonce: %v", err)
+			}
+			if fresh != tt.wantFresh {
+				t.Errorf("fresh = %v, want %v", fresh, tt.wantFresh)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// OAuthTokenRepository implements ports.OAuthTokenRepository.
+//
+// Access and refresh tokens are sealed with AES-GCM before they are written,
+// bound to their gym and column, so a database dump does not leak them.
+type OAuthTokenRepository struct {
+	db   *DB
+	aead cipher.AEAD
+}
+
+// NewOAuthTokenRepository creates a new SQL-backed OAuth token store.
+// key is the 32-byte AES-256 key tokens are encrypted with.
+func NewOAuthTokenRepository(db *DB, key []byte) (*OAuthTokenRepository, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("OAuth token key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokenRepository{db: db, aead: aead}, nil
+}
+
+// SaveToken inserts or replaces a gym's token. It becomes due for refresh
+// immediately; ClaimExpiring decides by its expiry.
+func (r *OAuthTokenRepository) SaveToken(ctx context.Context, token domain.OAuthToken) error {
+	accessToken, err := r.seal(token.GymSlug, "access_token", token.AccessToken)
+	if err != nil {
+		return repositoryError("failed to encrypt access token", err)
+	}
+	refreshToken, err := r.seal(token.GymSlug, "refresh_token", token.RefreshToken)
+	if err != nil {
+		return repositoryError("failed to encrypt refresh token", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO gym_oauth_tokens
+			(gym_slug, access_token, refresh_token, public_key, scope, live_mode,
+			 expires_at, next_refresh_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $8)
+		ON CONFLICT (gym_slug) DO UPDATE SET
+			access_token = excluded.access_token,
+			refresh_token = excluded.refresh_token,
+			public_key = excluded.public_key,
+			scope = excluded.scope,
+			live_mode = excluded.live_mode,
+			expires_at = excluded.expires_at,
+			next_refresh_at = excluded.next_refresh_at,
+			updated_at = excluded.updated_at`,
+		token.GymSlug, accessToken, refreshToken, token.PublicKey, token.Scope, token.LiveMode,
+		token.ExpiresAt.UTC(), now)
+	if err != nil {
+		return repositoryError("failed to save OAuth token", err)
+	}
+	return nil
+}
+
+// GetToken returns a gym's token.
+func (r *OAuthTokenRepository) GetToken(ctx context.Context, gymSlug string) (*domain.OAuthToken, error) {
+	row := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+oauthTokenColumns+`
+		FROM gym_oauth_tokens
+		WHERE gym_slug = $1`, gymSlug)
+
+	token, err := r.scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrOAuthTokenNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get OAuth token", err)
+	}
+	return token, nil
+}
+
+// ClaimExpiring returns tokens expiring before the given time and pushes
+// their next_refresh_at forward by lease so concurrent refreshers skip them.
+func (r *OAuthTokenRepository) ClaimExpiring(ctx context.Context, before time.Time, limit int, lease time.Duration) ([]domain.OAuthToken, error) {
+	var tokens []domain.OAuthToken
+
+	err := r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+
+		query := `
+			SELECT ` + oauthTokenColumns + `
+			FROM gym_oauth_tokens
+			WHERE expires_at <= $1 AND next_refresh_at <= $2
+			ORDER BY expires_at
+			LIMIT $3`
+		if r.db.driver == DriverPostgres {
+			query += ` FOR UPDATE SKIP LOCKED`
+		}
+
+		rows, err := r.db.conn(ctx).QueryContext(ctx, query, before.UTC(), now, limit)
+		if err != nil {
+			return repositoryError("failed to query expiring OAuth tokens", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			t, err := r.scanToken(rows)
+			if err != nil {
+				return repositoryError("failed to scan OAuth token", err)
+			}
+			tokens = append(tokens, *t)
+		}
+		if err := rows.Err(); err != nil {
+			return repositoryError("failed to query expiring OAuth tokens", err)
+		}
+		rows.Close()
+
+		leaseUntil := now.Add(lease)
+		for _, t := range tokens {
+			if _, err := r.db.conn(ctx).ExecContext(ctx, `
+				UPDATE gym_oauth_tokens SET next_refresh_at = $1 WHERE gym_slug = $2`,
+				leaseUntil, t.GymSlug); err != nil {
+				return repositoryError("failed to lease OAuth token", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// oauthTokenColumns is the column list read by scanToken.
+const oauthTokenColumns = `gym_slug, access_token, refresh_token, public_key, scope, live_mode,
+	expires_at, created_at, updated_at`
+
+// scanToken reads and decrypts a gym_oauth_tokens row selected with oauthTokenColumns.
+func (r *OAuthTokenRepository) scanToken(row rowScanner) (*domain.OAuthToken, error) {
+	var (
+		t                         domain.OAuthToken
+		accessToken, refreshToken string
+	)
+	if err := row.Scan(&t.GymSlug, &accessToken, &refreshToken, &t.PublicKey, &t.Scope, &t.LiveMode,
+		&t.ExpiresAt, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if t.AccessToken, err = r.open(t.GymSlug, "access_token", accessToken); err != nil {
+		return nil, err
+	}
+	if t.RefreshToken, err = r.open(t.GymSlug, "refresh_token", refreshToken); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// seal encrypts a token for a gym's column, as base64 of nonce and ciphertext.
+func (r *OAuthTokenRepository) seal(gymSlug, column, value string) (string, error) {
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := r.aead.Seal(nonce, nonce, []byte(value), []byte(gymSlug+":"+column))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a token sealed for a gym's column.
+func (r *OAuthTokenRepository) open(gymSlug, column, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	size := r.aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("sealed token too short")
+	}
+	plain, err := r.aead.Open(nil, sealed[:size], sealed[size:], []byte(gymSlug+":"+column))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", column, err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,111 @@
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+func TestOAuthTokenRepositoryEncryption(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	key := bytes.Repeat([]byte{1}, 32)
+	repo, err := NewOAuthTokenRepository(db, key)
+	if err != nil {
+		t.Fatalf("NewOAuthTokenRepository: %v", err)
+	}
+
+	token := domain.OAuthToken{
+		GymSlug: "level-gym", AccessToken: "APP_USR-secret-access", RefreshToken: "TG-secret-refresh",
+		ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+	}
+	if err := repo.SaveToken(ctx, token); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+
+	var access, refresh string
+	if err := db.QueryRowContext(ctx, `SELECT access_token, refresh_token FROM gym_oauth_tokens WHERE gym_slug = $1`,
+		"level-gym").Scan(&access, &refresh); err != nil {
+		t.Fatalf("read raw token: %v", err)
+	}
+	if strings.Contains(access, "secret") || strings.Contains(refresh, "secret") {
+		t.Errorf("tokens stored in clear: %q, %q", access, refresh)
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		gymSlug string
+		wantErr error
+	}{
+		{name: "same key", key: key, gymSlug: "level-gym"},
+		{name: "other key", key: bytes.Repeat([]byte{2}, 32), gymSlug: "level-gym", wantErr: domain.ErrRepositoryError},
+		{name: "unknown gym", key: key, gymSlug: "other-gym", wantErr: domain.ErrOAuthTokenNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := NewOAuthTokenRepository(db, tt.key)
+			if err != nil {
+				t.Fatalf("NewOAuthTokenRepository: %v", err)
+			}
+			got, err := repo.GetToken(ctx, tt.gymSlug)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetToken: %v", err)
+			}
+			if got.AccessToken != token.AccessToken || got.RefreshToken != token.RefreshToken ||
+				!got.ExpiresAt.Equal(token.ExpiresAt) {
+				t.Errorf("GetToken = %+v, want %+v", got, token)
+			}
+		})
+	}
+}
+
+func TestOAuthTokenRepositoryClaimExpiring(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewOAuthTokenRepository(openTestDB(t), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("NewOAuthTokenRepository: %v", err)
+	}
+	for gym, expiresIn := range map[string]time.Duration{"soon-gym": time.Hour, "later-gym": 30 * 24 * time.Hour} {
+		if err := repo.SaveToken(ctx, domain.OAuthToken{GymSlug: gym, AccessToken: "a", RefreshToken: "r",
+			ExpiresAt: time.Now().Add(expiresIn)}); err != nil {
+			t.Fatalf("SaveToken: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "expiring within window", want: []string{"soon-gym"}},
+		{name: "leased", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := repo.ClaimExpiring(ctx, time.Now().Add(7*24*time.Hour), 10, time.Minute)
+			if err != nil {
+				t.Fatalf("ClaimExpiring: %v", err)
+			}
+			var got []string
+			for _, token := range tokens {
+				got = append(got, token.GymSlug)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("claimed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
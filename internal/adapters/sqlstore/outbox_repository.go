@@ -0,0 +1,319 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// OutboxRepository implements ports.OutboxRepository.
+type OutboxRepository struct {
+	db *DB
+}
+
+// NewOutboxRepository creates a new SQL-backed Django notification outbox.
+func NewOutboxRepository(db *DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Enqueue stores a new pending message, due immediately unless NextAttemptAt is set.
+func (r *OutboxRepository) Enqueue(ctx context.Context, message domain.OutboxMessage) error {
+	var body any = message.Payload
+	if message.Kind == domain.OutboxKindSubscription {
+		body = message.Subscription
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return repositoryError("failed to marshal outbox payload", err)
+	}
+
+	kind := message.Kind
+	if kind == "" {
+		kind = domain.OutboxKindPayment
+	}
+	paymentID := ""
+	if kind == domain.OutboxKindPayment && message.Payload != nil {
+		paymentID = message.Payload.PaymentID
+	}
+
+	now := time.Now().UTC()
+	next := message.NextAttemptAt
+	if next.IsZero() {
+		next = now
+	}
+
+	_, err = r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO django_outbox
+			(gym_slug, kind, payment_id, payload, status, attempts, last_error, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, 0, '', $6, $7, $7)`,
+		message.GymSlug, kind, paymentID, string(payload), domain.OutboxPending, next.UTC(), now)
+	if err != nil {
+		return repositoryError("failed to enqueue outbox message", err)
+	}
+	return nil
+}
+
+// ClaimDue returns pending messages whose next attempt is due and pushes
+// their next_attempt_at forward by lease so concurrent dispatchers skip them.
+// Messages whose payload does not decode could never be delivered; they are
+// dead-lettered with the decoding error instead of failing the whole batch.
+func (r *OutboxRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxMessage, error) {
+	var messages []domain.OutboxMessage
+
+	err := r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+
+		query := `
+			SELECT ` + outboxColumns + `
+			FROM django_outbox
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3`
+		if r.db.driver == DriverPostgres {
+			query += ` FOR UPDATE SKIP LOCKED`
+		}
+
+		rows, err := r.db.conn(ctx).QueryContext(ctx, query, domain.OutboxPending, now, limit)
+		if err != nil {
+			return repositoryError("failed to query due outbox messages", err)
+		}
+		defer rows.Close()
+		undecodable := map[int64]string{}
+		for rows.Next() {
+			m, err := scanOutboxMessage(rows)
+			switch {
+			case errors.Is(err, errUndecodablePayload):
+				undecodable[m.ID] = err.Error()
+				continue
+			case err != nil:
+				return repositoryError("failed to scan outbox message", err)
+			}
+			messages = append(messages, *m)
+		}
+		if err := rows.Err(); err != nil {
+			return repositoryError("failed to query due outbox messages", err)
+		}
+		rows.Close()
+
+		for id, lastError := range undecodable {
+			if err := r.MarkDead(ctx, id, lastError, 0); err != nil {
+				return err
+			}
+		}
+
+		leaseUntil := now.Add(lease)
+		for _, m := range messages {
+			if _, err := r.db.conn(ctx).ExecContext(ctx, `
+				UPDATE django_outbox SET next_attempt_at = $1 WHERE id = $2`,
+				leaseUntil, m.ID); err != nil {
+				return repositoryError("failed to lease outbox message", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MarkDelivered records a successful delivery attempt.
+// The last error is kept for later inspection.
+func (r *OutboxRepository) MarkDelivered(ctx context.Context, id int64) error {
+	now := time.Now().UTC()
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE django_outbox
+		SET status = $1, attempts = attempts + 1, next_attempt_at = $2, updated_at = $2
+		WHERE id = $3`,
+		domain.OutboxDelivered, now, id)
+	if err != nil {
+		return repositoryError("failed to update outbox message", err)
+	}
+	return nil
+}
+
+// MarkRetry records a failed attempt and schedules the next one.
+func (r *OutboxRepository) MarkRetry(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string, httpStatus int) error {
+	return r.recordFailure(ctx, id, domain.OutboxPending, nextAttemptAt, lastError, httpStatus)
+}
+
+// MarkDead records a failed attempt and moves the message to the dead-letter state.
+func (r *OutboxRepository) MarkDead(ctx context.Context, id int64, lastError string, httpStatus int) error {
+	return r.recordFailure(ctx, id, domain.OutboxDead, time.Now(), lastError, httpStatus)
+}
+
+// recordFailure bumps the attempt counter and stores the failure.
+func (r *OutboxRepository) recordFailure(ctx context.Context, id int64, status string, nextAttemptAt time.Time, lastError string, httpStatus int) error {
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE django_outbox
+		SET status = $1, attempts = attempts + 1, last_error = $2, last_http_status = $3,
+			next_attempt_at = $4, updated_at = $5
+		WHERE id = $6`,
+		status, lastError, httpStatus, nextAttemptAt.UTC(), time.Now().UTC(), id)
+	if err != nil {
+		return repositoryError("failed to update outbox message", err)
+	}
+	return nil
+}
+
+// List returns messages matching the filter, newest first.
+func (r *OutboxRepository) List(ctx context.Context, filter domain.DeliveryFilter) ([]domain.OutboxMessage, error) {
+	query := `SELECT ` + outboxColumns + ` FROM django_outbox WHERE `
+	args := []any{}
+
+	switch filter.Status {
+	case domain.DeliveryFailed, "":
+		query += `(status = $1 OR (status = $2 AND attempts > 0))`
+		args = append(args, domain.OutboxDead, domain.OutboxPending)
+	case domain.DeliveryRetrying:
+		query += `status = $1 AND attempts > 0`
+		args = append(args, domain.OutboxPending)
+	default:
+		query += `status = $1`
+		args = append(args, filter.Status)
+	}
+
+	if filter.GymSlug != "" {
+		args = append(args, filter.GymSlug)
+		query += fmt.Sprintf(` AND gym_slug = $%d`, len(args))
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, repositoryError("failed to list outbox messages", err)
+	}
+	defer rows.Close()
+
+	messages := []domain.OutboxMessage{}
+	for rows.Next() {
+		// Dead-lettered undecodable messages are listed without their payload
+		m, err := scanOutboxMessage(rows)
+		if err != nil && !errors.Is(err, errUndecodablePayload) {
+			return nil, repositoryError("failed to scan outbox message", err)
+		}
+		messages = append(messages, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, repositoryError("failed to list outbox messages", err)
+	}
+	return messages, nil
+}
+
+// Requeue resets a failed message to pending, due immediately. Dead
+// messages qualify, and so do retrying ones once their next attempt is due;
+// until then a dispatcher may hold their lease and be delivering them.
+func (r *OutboxRepository) Requeue(ctx context.Context, id int64) (bool, error) {
+	now := time.Now().UTC()
+	res, err := r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE django_outbox
+		SET status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+		WHERE id = $3
+			AND (status = $4 OR (status = $1 AND attempts > 0 AND next_attempt_at <= $2))`,
+		domain.OutboxPending, now, id, domain.OutboxDead)
+	if err != nil {
+		return false, repositoryError("failed to requeue outbox message", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return true, nil
+	}
+
+	var status string
+	err = r.db.conn(ctx).QueryRowContext(ctx,
+		`SELECT status FROM django_outbox WHERE id = $1`, id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, domain.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return false, repositoryError("failed to requeue outbox message", err)
+	}
+	if status == domain.OutboxPending {
+		return false, domain.ErrDeliveryPending
+	}
+	return false, nil
+}
+
+// LatestPaymentDelivery returns the newest message queued for a payment.
+func (r *OutboxRepository) LatestPaymentDelivery(ctx context.Context, gymSlug, paymentID string) (*domain.OutboxMessage, error) {
+	row := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+outboxColumns+`
+		FROM django_outbox
+		WHERE gym_slug = $1 AND payment_id = $2 AND kind = $3
+		ORDER BY id DESC
+		LIMIT 1`, gymSlug, paymentID, domain.OutboxKindPayment)
+
+	m, err := scanOutboxMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get payment delivery", err)
+	}
+	return m, nil
+}
+
+// outboxColumns is the column list read by scanOutboxMessage.
+const outboxColumns = `id, gym_slug, kind, payload, status, attempts, last_error, last_http_status,
+	next_attempt_at, created_at, updated_at`
+
+// errUndecodablePayload is returned by scanOutboxMessage, along with the
+// rest of the message, when its payload does not decode.
+var errUndecodablePayload = errors.New("undecodable outbox payload")
+
+// scanOutboxMessage reads a django_outbox row selected with outboxColumns.
+// A payload that does not decode is left out of the returned message and
+// reported as errUndecodablePayload.
+func scanOutboxMessage(row rowScanner) (*domain.OutboxMessage, error) {
+	var (
+		m       domain.OutboxMessage
+		payload string
+	)
+	if err := row.Scan(&m.ID, &m.GymSlug, &m.Kind, &payload, &m.Status, &m.Attempts, &m.LastError,
+		&m.LastHTTPStatus, &m.NextAttemptAt, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := decodeOutboxPayload(&m, payload); err != nil {
+		m.Payload, m.Subscription = nil, nil
+		return &m, fmt.Errorf("%w: %v", errUndecodablePayload, err)
+	}
+	return &m, nil
+}
+
+// decodeOutboxPayload decodes the payload of a message of its kind.
+func decodeOutboxPayload(m *domain.OutboxMessage, payload string) error {
+	// Amounts decode without currency; bind them back to the payload's
+	var err error
+	if m.Kind == domain.OutboxKindSubscription {
+		if err := json.Unmarshal([]byte(payload), &m.Subscription); err != nil {
+			return err
+		}
+		if m.Subscription == nil {
+			return errors.New("empty subscription payload")
+		}
+		m.Subscription.Amount, err = m.Subscription.Amount.WithCurrency(m.Subscription.Currency)
+	} else {
+		if err := json.Unmarshal([]byte(payload), &m.Payload); err != nil {
+			return err
+		}
+		if m.Payload == nil {
+			return errors.New("empty payment payload")
+		}
+		m.Payload.Amount, err = m.Payload.Amount.WithCurrency(m.Payload.Currency)
+		if cb := m.Payload.Chargeback; cb != nil && err == nil {
+			cb.Amount, err = cb.Amount.WithCurrency(cb.Currency)
+		}
+	}
+	return err
+}
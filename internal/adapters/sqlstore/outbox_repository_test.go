@@ -0,0 +1,338 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+func TestOutboxRepositoryClaimDue(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup acts on the message claimed first, before it is claimed again
+		setup     func(t *testing.T, repo *OutboxRepository, id int64)
+		wantClaim bool
+	}{
+		{
+			name: "leased",
+		},
+		{
+			name: "retry due",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkRetry(context.Background(), id, time.Now().Add(-time.Second), "connection refused", 0); err != nil {
+					t.Fatalf("MarkRetry: %v", err)
+				}
+			},
+			wantClaim: true,
+		},
+		{
+			name: "retry scheduled later",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkRetry(context.Background(), id, time.Now().Add(time.Hour), "HTTP 503", 503); err != nil {
+					t.Fatalf("MarkRetry: %v", err)
+				}
+			},
+		},
+		{
+			name: "delivered",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkDelivered(context.Background(), id); err != nil {
+					t.Fatalf("MarkDelivered: %v", err)
+				}
+			},
+		},
+		{
+			name: "dead",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkDead(context.Background(), id, "HTTP 400", 400); err != nil {
+					t.Fatalf("MarkDead: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewOutboxRepository(openTestDB(t))
+
+			enqueuePayment(t, repo, "100", time.Time{})
+			// Not due yet: never claimed
+			enqueuePayment(t, repo, "200", time.Now().Add(time.Hour))
+
+			claimed, err := repo.ClaimDue(ctx, 10, time.Minute)
+			if err != nil {
+				t.Fatalf("ClaimDue: %v", err)
+			}
+			if len(claimed) != 1 || claimed[0].Payload == nil || claimed[0].Payload.PaymentID != "100" {
+				t.Fatalf("claimed %+v, want payment 100 only", claimed)
+			}
+			if tt.setup != nil {
+				tt.setup(t, repo, claimed[0].ID)
+			}
+
+			again, err := repo.ClaimDue(ctx, 10, time.Minute)
+			if err != nil {
+				t.Fatalf("ClaimDue: %v", err)
+			}
+			want := 0
+			if tt.wantClaim {
+				want = 1
+			}
+			if len(again) != want {
+				t.Errorf("claimed %d messages again, want %d", len(again), want)
+			}
+		})
+	}
+}
+
+func TestOutboxRepositoryClaimDueUndecodable(t *testing.T) {
+	ctx := context.Background()
+	repo := NewOutboxRepository(openTestDB(t))
+
+	enqueuePayment(t, repo, "100", time.Time{})
+	enqueuePayment(t, repo, "200", time.Time{})
+	if _, err := repo.db.ExecContext(ctx,
+		`UPDATE django_outbox SET payload = '{"amount": "15000.00.00"}' WHERE payment_id = '100'`); err != nil {
+		t.Fatalf("corrupt payload: %v", err)
+	}
+
+	claimed, err := repo.ClaimDue(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDue: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].Payload.PaymentID != "200" {
+		t.Fatalf("claimed %+v, want payment 200 only", claimed)
+	}
+
+	dead, err := repo.List(ctx, domain.DeliveryFilter{Status: domain.OutboxDead})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Payload != nil || !strings.Contains(dead[0].LastError, "undecodable") {
+		t.Errorf("dead messages = %+v, want the undecodable one with its error", dead)
+	}
+}
+
+func TestOutboxRepositoryEnqueueKinds(t *testing.T) {
+	ctx := context.Background()
+	repo := NewOutboxRepository(openTestDB(t))
+
+	messages := []domain.OutboxMessage{
+		{GymSlug: "level-gym", Kind: domain.OutboxKindPayment, Payload: &domain.DjangoWebhookPayload{
+			Event: "payment.approved", PaymentID: "100", Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS",
+		}},
+		{GymSlug: "level-gym", Kind: domain.OutboxKindSubscription, Subscription: &domain.DjangoSubscriptionPayload{
+			Event: "subscription.charged", SubscriptionID: "sub-1", Amount: domain.NewMoney(900000, "ARS"),
+		}},
+	}
+	for _, m := range messages {
+		if err := repo.Enqueue(ctx, m); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	claimed, err := repo.ClaimDue(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDue: %v", err)
+	}
+	if len(claimed) != len(messages) {
+		t.Fatalf("claimed %d messages, want %d", len(claimed), len(messages))
+	}
+	for _, m := range claimed {
+		switch m.Kind {
+		case domain.OutboxKindPayment:
+			if m.Payload == nil || m.Payload.PaymentID != "100" || m.Payload.Amount.String() != "15000.00" {
+				t.Errorf("payment message payload = %+v", m.Payload)
+			}
+		case domain.OutboxKindSubscription:
+			if m.Subscription == nil || m.Subscription.SubscriptionID != "sub-1" {
+				t.Errorf("subscription message payload = %+v", m.Subscription)
+			}
+		default:
+			t.Errorf("unexpected kind %q", m.Kind)
+		}
+	}
+}
+
+func TestOutboxRepositoryRequeue(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup brings the queued message into the state under test
+		setup        func(t *testing.T, repo *OutboxRepository, id int64)
+		missing      bool
+		wantRequeued bool
+		wantErr      error
+	}{
+		{
+			name: "dead",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkDead(context.Background(), id, "HTTP 400", 400); err != nil {
+					t.Fatalf("MarkDead: %v", err)
+				}
+			},
+			wantRequeued: true,
+		},
+		{
+			name: "retry due",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkRetry(context.Background(), id, time.Now().Add(-time.Second), "HTTP 503", 503); err != nil {
+					t.Fatalf("MarkRetry: %v", err)
+				}
+			},
+			wantRequeued: true,
+		},
+		{
+			name: "retry scheduled later",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkRetry(context.Background(), id, time.Now().Add(time.Hour), "HTTP 503", 503); err != nil {
+					t.Fatalf("MarkRetry: %v", err)
+				}
+			},
+			wantErr: domain.ErrDeliveryPending,
+		},
+		{
+			name: "leased by a dispatcher",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if _, err := repo.ClaimDue(context.Background(), 10, time.Minute); err != nil {
+					t.Fatalf("ClaimDue: %v", err)
+				}
+			},
+			wantErr: domain.ErrDeliveryPending,
+		},
+		{
+			name:    "never attempted",
+			wantErr: domain.ErrDeliveryPending,
+		},
+		{
+			name: "delivered",
+			setup: func(t *testing.T, repo *OutboxRepository, id int64) {
+				if err := repo.MarkDelivered(context.Background(), id); err != nil {
+					t.Fatalf("MarkDelivered: %v", err)
+				}
+			},
+		},
+		{
+			name:    "unknown",
+			missing: true,
+			wantErr: domain.ErrDeliveryNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewOutboxRepository(openTestDB(t))
+
+			enqueuePayment(t, repo, "100", time.Time{})
+			queued, err := repo.List(ctx, domain.DeliveryFilter{Status: domain.OutboxPending})
+			if err != nil || len(queued) != 1 {
+				t.Fatalf("List = %d messages, %v; want 1", len(queued), err)
+			}
+			id := queued[0].ID
+			if tt.setup != nil {
+				tt.setup(t, repo, id)
+			}
+			if tt.missing {
+				id++
+			}
+
+			requeued, err := repo.Requeue(ctx, id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if requeued != tt.wantRequeued {
+				t.Fatalf("requeued = %v, want %v", requeued, tt.wantRequeued)
+			}
+			if !requeued {
+				return
+			}
+
+			// A requeued message is due immediately with a fresh attempt budget
+			claimed, err := repo.ClaimDue(ctx, 10, time.Minute)
+			if err != nil {
+				t.Fatalf("ClaimDue: %v", err)
+			}
+			if len(claimed) != 1 || claimed[0].ID != id || claimed[0].Attempts != 0 {
+				t.Errorf("claimed %+v, want message %d with no attempts", claimed, id)
+			}
+		})
+	}
+}
+
+func TestOutboxRepositoryListFailed(t *testing.T) {
+	ctx := context.Background()
+	repo := NewOutboxRepository(openTestDB(t))
+
+	for _, id := range []string{"100", "200", "300", "400"} {
+		enqueuePayment(t, repo, id, time.Time{})
+	}
+	all, err := repo.List(ctx, domain.DeliveryFilter{Status: domain.OutboxPending})
+	if err != nil || len(all) != 4 {
+		t.Fatalf("List = %d messages, %v; want 4", len(all), err)
+	}
+	// Newest first: 400, 300, 200, 100
+	if err := repo.MarkDead(ctx, all[0].ID, "HTTP 400", 400); err != nil {
+		t.Fatalf("MarkDead: %v", err)
+	}
+	if err := repo.MarkRetry(ctx, all[1].ID, time.Now().Add(time.Hour), "HTTP 503", 503); err != nil {
+		t.Fatalf("MarkRetry: %v", err)
+	}
+	if err := repo.MarkDelivered(ctx, all[2].ID); err != nil {
+		t.Fatalf("MarkDelivered: %v", err)
+	}
+
+	tests := []struct {
+		status string
+		want   []string
+	}{
+		{status: "", want: []string{"400", "300"}},
+		{status: domain.DeliveryFailed, want: []string{"400", "300"}},
+		{status: domain.DeliveryRetrying, want: []string{"300"}},
+		{status: domain.OutboxDead, want: []string{"400"}},
+		{status: domain.OutboxDelivered, want: []string{"200"}},
+		{status: domain.OutboxPending, want: []string{"300", "100"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("status "+tt.status, func(t *testing.T) {
+			messages, err := repo.List(ctx, domain.DeliveryFilter{Status: tt.status, GymSlug: "level-gym"})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var got []string
+			for _, m := range messages {
+				got = append(got, m.Payload.PaymentID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got payments %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got payments %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// enqueuePayment queues a payment.approved message for level-gym, due at
+// next (immediately when zero).
+func enqueuePayment(t *testing.T, repo *OutboxRepository, paymentID string, next time.Time) {
+	t.Helper()
+	if err := repo.Enqueue(context.Background(), domain.OutboxMessage{
+		GymSlug: "level-gym",
+		Kind:    domain.OutboxKindPayment,
+		Payload: &domain.DjangoWebhookPayload{
+			Event: "payment.approved", GymSlug: "level-gym", PaymentID: paymentID,
+			Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS",
+		},
+		NextAttemptAt: next,
+	}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+}
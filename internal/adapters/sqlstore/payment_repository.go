@@ -0,0 +1,363 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// PaymentRepository implements ports.PaymentRepository.
+type PaymentRepository struct {
+	db *DB
+}
+
+// NewPaymentRepository creates a new SQL-backed payment ledger.
+func NewPaymentRepository(db *DB) *PaymentRepository {
+	return &PaymentRepository{db: db}
+}
+
+// SavePreference records a created Checkout Pro preference and schedules
+// the gym's reconciliation if this is its first.
+func (r *PaymentRepository) SavePreference(ctx context.Context, record domain.PreferenceRecord) error {
+	items, err := json.Marshal(record.Items)
+	if err != nil {
+		return repositoryError("failed to marshal preference items", err)
+	}
+	if record.Items == nil {
+		items = []byte("[]")
+	}
+
+	return r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := r.db.conn(ctx).ExecContext(ctx, `
+			INSERT INTO payment_preferences
+				(gym_slug, external_reference, preference_id, title, amount, amount_minor, currency,
+				 items, payer_email, init_point, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			record.GymSlug, record.ExternalReference, record.PreferenceID, record.Title,
+			record.Amount.Float64(), record.Amount.Minor, record.Currency,
+			string(items), record.PayerEmail, record.InitPoint, record.CreatedAt.UTC()); err != nil {
+			return repositoryError("failed to save preference", err)
+		}
+		return scheduleGym(ctx, r.db, record.GymSlug)
+	})
+}
+
+// SavePaymentSnapshot records a PaymentInfo fetched from Mercado Pago and
+// schedules the gym's reconciliation if it was never scheduled.
+func (r *PaymentRepository) SavePaymentSnapshot(ctx context.Context, snapshot domain.PaymentSnapshot) error {
+	p := snapshot.Payment
+	var dateApproved *time.Time
+	if p.DateApproved != nil {
+		utc := p.DateApproved.UTC()
+		dateApproved = &utc
+	}
+
+	return r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := r.db.conn(ctx).ExecContext(ctx, `
+			INSERT INTO payment_snapshots
+				(gym_slug, payment_id, external_reference, status, status_detail, amount, amount_minor,
+				 currency, payment_method, payment_type, payer_email, date_approved, fetched_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			snapshot.GymSlug, p.PaymentID, p.ExternalReference, p.Status, p.StatusDetail,
+			p.Amount.Float64(), p.Amount.Minor, p.Currency, p.PaymentMethod, p.PaymentType,
+			p.PayerEmail, dateApproved, snapshot.FetchedAt.UTC()); err != nil {
+			return repositoryError("failed to save payment snapshot", err)
+		}
+		return scheduleGym(ctx, r.db, snapshot.GymSlug)
+	})
+}
+
+// LockPayment serializes the transactions recording a payment until the
+// one bound to ctx ends.
+func (r *PaymentRepository) LockPayment(ctx context.Context, gymSlug, paymentID string) error {
+	return r.db.lock(ctx, "payment:"+gymSlug+":"+paymentID)
+}
+
+// GetLatestSnapshot returns the most recent snapshot of a payment.
+func (r *PaymentRepository) GetLatestSnapshot(ctx context.Context, gymSlug, paymentID string) (*domain.PaymentSnapshot, error) {
+	row := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+snapshotColumns+`
+		FROM payment_snapshots
+		WHERE gym_slug = $1 AND payment_id = $2
+		ORDER BY id DESC
+		LIMIT 1`, gymSlug, paymentID)
+
+	snapshot, err := scanSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get payment snapshot", err)
+	}
+	return snapshot, nil
+}
+
+// GetLatestSnapshotByReference returns the most recent snapshot of any
+// payment made for an external reference.
+func (r *PaymentRepository) GetLatestSnapshotByReference(ctx context.Context, gymSlug, externalReference string) (*domain.PaymentSnapshot, error) {
+	row := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+snapshotColumns+`
+		FROM payment_snapshots
+		WHERE gym_slug = $1 AND external_reference = $2
+		ORDER BY id DESC
+		LIMIT 1`, gymSlug, externalReference)
+
+	snapshot, err := scanSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get payment snapshot", err)
+	}
+	return snapshot, nil
+}
+
+// RecordStatusChange records a payment status transition, applied or rejected.
+func (r *PaymentRepository) RecordStatusChange(ctx context.Context, change domain.StatusChange) error {
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO payment_status_changes
+			(gym_slug, external_reference, payment_id, from_status, to_status, rejected, reason, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		change.GymSlug, change.ExternalReference, change.PaymentID,
+		change.FromStatus, change.ToStatus, change.Rejected, change.Reason, change.ChangedAt.UTC())
+	if err != nil {
+		return repositoryError("failed to record status change", err)
+	}
+	return nil
+}
+
+// LockChargeback serializes the transactions recording a chargeback until
+// the one bound to ctx ends.
+func (r *PaymentRepository) LockChargeback(ctx context.Context, gymSlug, chargebackID string) error {
+	return r.db.lock(ctx, "chargeback:"+gymSlug+":"+chargebackID)
+}
+
+// SaveChargeback inserts or updates a chargeback.
+func (r *PaymentRepository) SaveChargeback(ctx context.Context, chargeback domain.Chargeback) error {
+	var deadline *time.Time
+	if chargeback.DocumentationDeadline != nil {
+		utc := chargeback.DocumentationDeadline.UTC()
+		deadline = &utc
+	}
+
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO payment_chargebacks
+			(gym_slug, chargeback_id, payment_id, external_reference, amount_minor, currency, status,
+			 coverage_applied, coverage_eligible, documentation_required, documentation_status,
+			 documentation_deadline, date_created, date_last_updated, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (gym_slug, chargeback_id) DO UPDATE SET
+			payment_id = excluded.payment_id,
+			external_reference = excluded.external_reference,
+			amount_minor = excluded.amount_minor,
+			currency = excluded.currency,
+			status = excluded.status,
+			coverage_applied = excluded.coverage_applied,
+			coverage_eligible = excluded.coverage_eligible,
+			documentation_required = excluded.documentation_required,
+			documentation_status = excluded.documentation_status,
+			documentation_deadline = excluded.documentation_deadline,
+			date_created = excluded.date_created,
+			date_last_updated = excluded.date_last_updated,
+			updated_at = excluded.updated_at`,
+		chargeback.GymSlug, chargeback.ChargebackID, chargeback.PaymentID, chargeback.ExternalReference,
+		chargeback.Amount.Minor, chargeback.Currency, chargeback.Status,
+		chargeback.CoverageApplied, chargeback.CoverageEligible, chargeback.DocumentationRequired,
+		chargeback.DocumentationStatus, deadline, chargeback.DateCreated.UTC(),
+		chargeback.DateLastUpdated.UTC(), time.Now().UTC())
+	if err != nil {
+		return repositoryError("failed to save chargeback", err)
+	}
+	return nil
+}
+
+// GetChargeback returns a recorded chargeback.
+func (r *PaymentRepository) GetChargeback(ctx context.Context, gymSlug, chargebackID string) (*domain.Chargeback, error) {
+	row := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+chargebackColumns+`
+		FROM payment_chargebacks
+		WHERE gym_slug = $1 AND chargeback_id = $2`, gymSlug, chargebackID)
+
+	chargeback, err := scanChargeback(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrChargebackNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get chargeback", err)
+	}
+	return chargeback, nil
+}
+
+// GetHistory returns all ledger entries for an external reference, oldest first.
+func (r *PaymentRepository) GetHistory(ctx context.Context, gymSlug, externalReference string) (*domain.PaymentHistory, error) {
+	history := &domain.PaymentHistory{
+		GymSlug:           gymSlug,
+		ExternalReference: externalReference,
+		Preferences:       []domain.PreferenceRecord{},
+		Snapshots:         []domain.PaymentSnapshot{},
+		StatusChanges:     []domain.StatusChange{},
+		Chargebacks:       []domain.Chargeback{},
+	}
+
+	prefRows, err := r.db.conn(ctx).QueryContext(ctx, `
+		SELECT gym_slug, external_reference, preference_id, title, amount_minor, currency,
+			items, payer_email, init_point, created_at
+		FROM payment_preferences
+		WHERE gym_slug = $1 AND external_reference = $2
+		ORDER BY id`, gymSlug, externalReference)
+	if err != nil {
+		return nil, repositoryError("failed to query preferences", err)
+	}
+	defer prefRows.Close()
+	for prefRows.Next() {
+		var (
+			p           domain.PreferenceRecord
+			amountMinor int64
+			items       string
+		)
+		if err := prefRows.Scan(&p.GymSlug, &p.ExternalReference, &p.PreferenceID, &p.Title,
+			&amountMinor, &p.Currency, &items, &p.PayerEmail, &p.InitPoint, &p.CreatedAt); err != nil {
+			return nil, repositoryError("failed to scan preference", err)
+		}
+		p.Amount = domain.NewMoney(amountMinor, p.Currency)
+		if err := json.Unmarshal([]byte(items), &p.Items); err != nil {
+			return nil, repositoryError("failed to decode preference items", err)
+		}
+		for i := range p.Items {
+			if p.Items[i].UnitPrice, err = p.Items[i].UnitPrice.WithCurrency(p.Currency); err != nil {
+				return nil, repositoryError("failed to decode preference items", err)
+			}
+		}
+		history.Preferences = append(history.Preferences, p)
+	}
+	if err := prefRows.Err(); err != nil {
+		return nil, repositoryError("failed to query preferences", err)
+	}
+
+	snapRows, err := r.db.conn(ctx).QueryContext(ctx, `
+		SELECT `+snapshotColumns+`
+		FROM payment_snapshots
+		WHERE gym_slug = $1 AND external_reference = $2
+		ORDER BY id`, gymSlug, externalReference)
+	if err != nil {
+		return nil, repositoryError("failed to query snapshots", err)
+	}
+	defer snapRows.Close()
+	for snapRows.Next() {
+		s, err := scanSnapshot(snapRows)
+		if err != nil {
+			return nil, repositoryError("failed to scan snapshot", err)
+		}
+		history.Snapshots = append(history.Snapshots, *s)
+	}
+	if err := snapRows.Err(); err != nil {
+		return nil, repositoryError("failed to query snapshots", err)
+	}
+
+	changeRows, err := r.db.conn(ctx).QueryContext(ctx, `
+		SELECT gym_slug, external_reference, payment_id, from_status, to_status, rejected, reason, changed_at
+		FROM payment_status_changes
+		WHERE gym_slug = $1 AND external_reference = $2
+		ORDER BY id`, gymSlug, externalReference)
+	if err != nil {
+		return nil, repositoryError("failed to query status changes", err)
+	}
+	defer changeRows.Close()
+	for changeRows.Next() {
+		var c domain.StatusChange
+		if err := changeRows.Scan(&c.GymSlug, &c.ExternalReference, &c.PaymentID,
+			&c.FromStatus, &c.ToStatus, &c.Rejected, &c.Reason, &c.ChangedAt); err != nil {
+			return nil, repositoryError("failed to scan status change", err)
+		}
+		history.StatusChanges = append(history.StatusChanges, c)
+	}
+	if err := changeRows.Err(); err != nil {
+		return nil, repositoryError("failed to query status changes", err)
+	}
+
+	chargebackRows, err := r.db.conn(ctx).QueryContext(ctx, `
+		SELECT `+chargebackColumns+`
+		FROM payment_chargebacks
+		WHERE gym_slug = $1 AND external_reference = $2
+		ORDER BY date_created`, gymSlug, externalReference)
+	if err != nil {
+		return nil, repositoryError("failed to query chargebacks", err)
+	}
+	defer chargebackRows.Close()
+	for chargebackRows.Next() {
+		cb, err := scanChargeback(chargebackRows)
+		if err != nil {
+			return nil, repositoryError("failed to scan chargeback", err)
+		}
+		history.Chargebacks = append(history.Chargebacks, *cb)
+	}
+	if err := chargebackRows.Err(); err != nil {
+		return nil, repositoryError("failed to query chargebacks", err)
+	}
+
+	return history, nil
+}
+
+// snapshotColumns is the column list read by scanSnapshot.
+const snapshotColumns = `gym_slug, payment_id, external_reference, status, status_detail, amount_minor,
+	currency, payment_method, payment_type, payer_email, date_approved, fetched_at`
+
+// chargebackColumns is the column list read by scanChargeback.
+const chargebackColumns = `gym_slug, chargeback_id, payment_id, external_reference, amount_minor, currency,
+	status, coverage_applied, coverage_eligible, documentation_required, documentation_status,
+	documentation_deadline, date_created, date_last_updated`
+
+// scanChargeback reads a payment_chargebacks row selected with chargebackColumns.
+func scanChargeback(row rowScanner) (*domain.Chargeback, error) {
+	var (
+		cb          domain.Chargeback
+		amountMinor int64
+		deadline    sql.NullTime
+	)
+	if err := row.Scan(&cb.GymSlug, &cb.ChargebackID, &cb.PaymentID, &cb.ExternalReference,
+		&amountMinor, &cb.Currency, &cb.Status, &cb.CoverageApplied, &cb.CoverageEligible,
+		&cb.DocumentationRequired, &cb.DocumentationStatus, &deadline,
+		&cb.DateCreated, &cb.DateLastUpdated); err != nil {
+		return nil, err
+	}
+	cb.Amount = domain.NewMoney(amountMinor, cb.Currency)
+	if deadline.Valid {
+		cb.DocumentationDeadline = &deadline.Time
+	}
+	return &cb, nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSnapshot reads a payment_snapshots row selected with snapshotColumns.
+func scanSnapshot(row rowScanner) (*domain.PaymentSnapshot, error) {
+	var (
+		s            domain.PaymentSnapshot
+		amountMinor  int64
+		dateApproved sql.NullTime
+	)
+	p := &s.Payment
+	if err := row.Scan(&s.GymSlug, &p.PaymentID, &p.ExternalReference, &p.Status, &p.StatusDetail,
+		&amountMinor, &p.Currency, &p.PaymentMethod, &p.PaymentType, &p.PayerEmail,
+		&dateApproved, &s.FetchedAt); err != nil {
+		return nil, err
+	}
+	if dateApproved.Valid {
+		p.DateApproved = &dateApproved.Time
+	}
+	p.Amount = domain.NewMoney(amountMinor, p.Currency)
+	return &s, nil
+}
+
+// repositoryError wraps a database error as a domain service error.
+func repositoryError(message string, err error) error {
+	return domain.NewServiceError(domain.ErrRepositoryError,
+		message+": "+err.Error(), "REPOSITORY_ERROR")
+}
@@ -0,0 +1,182 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+func TestPaymentRepositoryLatestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	repo := NewPaymentRepository(openTestDB(t))
+
+	approvedAt := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	snapshots := []domain.PaymentSnapshot{
+		{GymSlug: "level-gym", FetchedAt: approvedAt.Add(-time.Minute), Payment: domain.PaymentInfo{
+			PaymentID: "100", Status: domain.PaymentPending, ExternalReference: "ref-1",
+			Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS",
+		}},
+		{GymSlug: "level-gym", FetchedAt: approvedAt, Payment: domain.PaymentInfo{
+			PaymentID: "100", Status: domain.PaymentApproved, ExternalReference: "ref-1",
+			Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS", DateApproved: &approvedAt,
+		}},
+		{GymSlug: "other-gym", FetchedAt: approvedAt, Payment: domain.PaymentInfo{
+			PaymentID: "200", Status: domain.PaymentRejected, ExternalReference: "ref-1",
+			Amount: domain.NewMoney(15000, "CLP"), Currency: "CLP",
+		}},
+	}
+	for _, s := range snapshots {
+		if err := repo.SavePaymentSnapshot(ctx, s); err != nil {
+			t.Fatalf("SavePaymentSnapshot: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		gymSlug      string
+		paymentID    string
+		reference    string
+		wantStatus   string
+		wantAmount   domain.Money
+		wantApproved bool
+		wantErr      error
+	}{
+		{name: "latest by payment id", gymSlug: "level-gym", paymentID: "100",
+			wantStatus: domain.PaymentApproved, wantAmount: domain.NewMoney(1500000, "ARS"), wantApproved: true},
+		{name: "latest by reference", gymSlug: "level-gym", reference: "ref-1",
+			wantStatus: domain.PaymentApproved, wantAmount: domain.NewMoney(1500000, "ARS"), wantApproved: true},
+		{name: "unapproved payment", gymSlug: "other-gym", paymentID: "200",
+			wantStatus: domain.PaymentRejected, wantAmount: domain.NewMoney(15000, "CLP")},
+		{name: "payment of another gym", gymSlug: "other-gym", paymentID: "100", wantErr: domain.ErrPaymentNotFound},
+		{name: "unknown reference", gymSlug: "level-gym", reference: "ref-2", wantErr: domain.ErrPaymentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got *domain.PaymentSnapshot
+				err error
+			)
+			if tt.reference != "" {
+				got, err = repo.GetLatestSnapshotByReference(ctx, tt.gymSlug, tt.reference)
+			} else {
+				got, err = repo.GetLatestSnapshot(ctx, tt.gymSlug, tt.paymentID)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Payment.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got.Payment.Status, tt.wantStatus)
+			}
+			if !got.Payment.Amount.Equal(tt.wantAmount) {
+				t.Errorf("amount = %s %s, want %s %s", got.Payment.Amount, got.Payment.Amount.Currency,
+					tt.wantAmount, tt.wantAmount.Currency)
+			}
+			switch {
+			case tt.wantApproved && (got.Payment.DateApproved == nil || !got.Payment.DateApproved.Equal(approvedAt)):
+				t.Errorf("date_approved = %v, want %v", got.Payment.DateApproved, approvedAt)
+			case !tt.wantApproved && got.Payment.DateApproved != nil:
+				t.Errorf("date_approved = %v, want none", got.Payment.DateApproved)
+			}
+		})
+	}
+}
+
+func TestPaymentRepositoryHistory(t *testing.T) {
+	ctx := context.Background()
+	repo := NewPaymentRepository(openTestDB(t))
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	if err := repo.SavePreference(ctx, domain.PreferenceRecord{
+		GymSlug: "level-gym", ExternalReference: "ref-1", PreferenceID: "pref-1", Title: "Pack 10 clases",
+		Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS", CreatedAt: now,
+		Items: []domain.CheckoutItem{{Title: "Pack 10 clases", Quantity: 2, UnitPrice: domain.NewMoney(750000, "ARS")}},
+	}); err != nil {
+		t.Fatalf("SavePreference: %v", err)
+	}
+	changes := []domain.StatusChange{
+		{ToStatus: domain.PaymentPending},
+		{FromStatus: domain.PaymentPending, ToStatus: domain.PaymentApproved},
+		{FromStatus: domain.PaymentApproved, ToStatus: domain.PaymentPending, Rejected: true, Reason: "approved cannot move to pending"},
+	}
+	for i, c := range changes {
+		c.GymSlug, c.ExternalReference, c.PaymentID = "level-gym", "ref-1", "100"
+		c.ChangedAt = now.Add(time.Duration(i) * time.Minute)
+		if err := repo.RecordStatusChange(ctx, c); err != nil {
+			t.Fatalf("RecordStatusChange: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		reference   string
+		wantEmpty   bool
+		wantChanges []domain.StatusChange
+	}{
+		{name: "recorded reference", reference: "ref-1", wantChanges: changes},
+		{name: "unknown reference", reference: "ref-2", wantEmpty: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history, err := repo.GetHistory(ctx, "level-gym", tt.reference)
+			if err != nil {
+				t.Fatalf("GetHistory: %v", err)
+			}
+			if history.Empty() != tt.wantEmpty {
+				t.Fatalf("Empty() = %v, want %v", history.Empty(), tt.wantEmpty)
+			}
+			if tt.wantEmpty {
+				return
+			}
+
+			if len(history.Preferences) != 1 {
+				t.Fatalf("got %d preferences, want 1", len(history.Preferences))
+			}
+			pref := history.Preferences[0]
+			if len(pref.Items) != 1 || !pref.Items[0].UnitPrice.Equal(domain.NewMoney(750000, "ARS")) {
+				t.Errorf("items = %+v, want one item of 7500.00 ARS", pref.Items)
+			}
+			if len(history.StatusChanges) != len(tt.wantChanges) {
+				t.Fatalf("got %d status changes, want %d", len(history.StatusChanges), len(tt.wantChanges))
+			}
+			for i, want := range tt.wantChanges {
+				got := history.StatusChanges[i]
+				if got.FromStatus != want.FromStatus || got.ToStatus != want.ToStatus ||
+					got.Rejected != want.Rejected || got.Reason != want.Reason {
+					t.Errorf("status change %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentRepositoryLockPayment(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	repo := NewPaymentRepository(db)
+
+	if err := repo.LockPayment(ctx, "level-gym", "100"); !errors.Is(err, domain.ErrRepositoryError) {
+		t.Errorf("lock outside a transaction: err = %v, want ErrRepositoryError", err)
+	}
+
+	err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := repo.LockPayment(ctx, "level-gym", "100"); err != nil {
+			return err
+		}
+		// Taking it again within the same transaction does not block
+		return repo.LockPayment(ctx, "level-gym", "100")
+	})
+	if err != nil {
+		t.Errorf("lock within a transaction: %v", err)
+	}
+}
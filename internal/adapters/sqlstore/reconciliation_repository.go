@@ -0,0 +1,201 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// ReconciliationRepository implements ports.ReconciliationRepository.
+type ReconciliationRepository struct {
+	db *DB
+}
+
+// NewReconciliationRepository creates a new SQL-backed reconciliation store.
+func NewReconciliationRepository(db *DB) *ReconciliationRepository {
+	return &ReconciliationRepository{db: db}
+}
+
+// ClaimDueGyms returns gyms due for reconciliation and pushes their
+// next_run_at forward by interval so concurrent workers skip them. Gyms are
+// scheduled by scheduleGym when the ledger first records them.
+func (r *ReconciliationRepository) ClaimDueGyms(ctx context.Context, limit int, interval time.Duration) ([]string, error) {
+	var gyms []string
+
+	err := r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+
+		query := `
+			SELECT gym_slug
+			FROM reconciliation_gyms
+			WHERE next_run_at <= $1
+			ORDER BY next_run_at
+			LIMIT $2`
+		if r.db.driver == DriverPostgres {
+			query += ` FOR UPDATE SKIP LOCKED`
+		}
+		var err error
+		gyms, err = r.queryGyms(ctx, query, now, limit)
+		if err != nil {
+			return repositoryError("failed to query due gyms", err)
+		}
+
+		next := now.Add(interval)
+		for _, gym := range gyms {
+			if _, err := r.db.conn(ctx).ExecContext(ctx, `
+				UPDATE reconciliation_gyms SET next_run_at = $1 WHERE gym_slug = $2`,
+				next, gym); err != nil {
+				return repositoryError("failed to schedule gym reconciliation", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gyms, nil
+}
+
+// scheduleGym schedules a gym's first reconciliation, due immediately,
+// unless it is already scheduled.
+func scheduleGym(ctx context.Context, db *DB, gymSlug string) error {
+	if _, err := db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO reconciliation_gyms (gym_slug, next_run_at)
+		VALUES ($1, $2)
+		ON CONFLICT (gym_slug) DO NOTHING`, gymSlug, time.Now().UTC()); err != nil {
+		return repositoryError("failed to schedule gym reconciliation", err)
+	}
+	return nil
+}
+
+// queryGyms runs a query selecting a single gym_slug column.
+func (r *ReconciliationRepository) queryGyms(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gyms []string
+	for rows.Next() {
+		var gym string
+		if err := rows.Scan(&gym); err != nil {
+			return nil, err
+		}
+		gyms = append(gyms, gym)
+	}
+	return gyms, rows.Err()
+}
+
+// SaveReport stores a report and sets its ID.
+func (r *ReconciliationRepository) SaveReport(ctx context.Context, report *domain.ReconciliationReport) error {
+	discrepancies := report.Discrepancies
+	if discrepancies == nil {
+		discrepancies = []domain.Discrepancy{}
+	}
+	body, err := json.Marshal(discrepancies)
+	if err != nil {
+		return repositoryError("failed to marshal discrepancies", err)
+	}
+
+	err = r.db.conn(ctx).QueryRowContext(ctx, `
+		INSERT INTO reconciliation_reports
+			(gym_slug, window_from, window_to, checked, discrepancies, error, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		report.GymSlug, report.From.UTC(), report.To.UTC(), report.Checked, string(body), report.Error,
+		report.StartedAt.UTC(), report.FinishedAt.UTC()).Scan(&report.ID)
+	if err != nil {
+		return repositoryError("failed to save reconciliation report", err)
+	}
+	return nil
+}
+
+// ListReports returns reports matching the filter, newest first.
+func (r *ReconciliationRepository) ListReports(ctx context.Context, filter domain.ReconciliationFilter) ([]domain.ReconciliationReport, error) {
+	query := `SELECT ` + reportColumns + ` FROM reconciliation_reports`
+	args := []any{}
+
+	if filter.GymSlug != "" {
+		args = append(args, filter.GymSlug)
+		query += ` WHERE gym_slug = $1`
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.db.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, repositoryError("failed to list reconciliation reports", err)
+	}
+	defer rows.Close()
+
+	reports := []domain.ReconciliationReport{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, repositoryError("failed to scan reconciliation report", err)
+		}
+		reports = append(reports, *report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, repositoryError("failed to list reconciliation reports", err)
+	}
+	return reports, nil
+}
+
+// GetReport returns a report.
+func (r *ReconciliationRepository) GetReport(ctx context.Context, id int64) (*domain.ReconciliationReport, error) {
+	row := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT `+reportColumns+`
+		FROM reconciliation_reports
+		WHERE id = $1`, id)
+
+	report, err := scanReport(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrReportNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get reconciliation report", err)
+	}
+	return report, nil
+}
+
+// reportColumns is the column list read by scanReport.
+const reportColumns = `id, gym_slug, window_from, window_to, checked, discrepancies, error,
+	started_at, finished_at`
+
+// scanReport reads a reconciliation_reports row selected with reportColumns.
+func scanReport(row rowScanner) (*domain.ReconciliationReport, error) {
+	var (
+		report        domain.ReconciliationReport
+		discrepancies string
+	)
+	if err := row.Scan(&report.ID, &report.GymSlug, &report.From, &report.To, &report.Checked,
+		&discrepancies, &report.Error, &report.StartedAt, &report.FinishedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(discrepancies), &report.Discrepancies); err != nil {
+		return nil, err
+	}
+
+	// Amounts decode without currency; bind them back to each discrepancy's
+	for i := range report.Discrepancies {
+		d := &report.Discrepancies[i]
+		amount, err := d.Amount.WithCurrency(d.Currency)
+		if err != nil {
+			return nil, err
+		}
+		d.Amount = amount
+	}
+	return &report, nil
+}
@@ -0,0 +1,141 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+func TestReconciliationRepositoryClaimDueGyms(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	payments := NewPaymentRepository(db)
+	repo := NewReconciliationRepository(db)
+
+	if gyms, err := repo.ClaimDueGyms(ctx, 10, time.Hour); err != nil || len(gyms) != 0 {
+		t.Fatalf("ClaimDueGyms on an empty ledger = %v, %v; want none", gyms, err)
+	}
+
+	// A preference and a payment schedule their gyms, each only once
+	for range 2 {
+		if err := payments.SavePreference(ctx, domain.PreferenceRecord{
+			GymSlug: "level-gym", ExternalReference: "ref-1", PreferenceID: "pref-1",
+			Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS", CreatedAt: time.Now(),
+		}); err != nil {
+			t.Fatalf("SavePreference: %v", err)
+		}
+		if err := payments.SavePaymentSnapshot(ctx, domain.PaymentSnapshot{
+			GymSlug: "other-gym", FetchedAt: time.Now(), Payment: domain.PaymentInfo{
+				PaymentID: "100", Status: domain.PaymentPending, ExternalReference: "ref-2",
+				Amount: domain.NewMoney(15000, "CLP"), Currency: "CLP",
+			},
+		}); err != nil {
+			t.Fatalf("SavePaymentSnapshot: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		interval time.Duration
+		want     []string
+	}{
+		{name: "first due gym", limit: 1, interval: time.Hour, want: []string{"level-gym"}},
+		{name: "remaining due gym", limit: 10, interval: -time.Minute, want: []string{"other-gym"}},
+		{name: "rescheduled in the past", limit: 10, interval: time.Hour, want: []string{"other-gym"}},
+		{name: "none due", limit: 10, interval: time.Hour, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.ClaimDueGyms(ctx, tt.limit, tt.interval)
+			if err != nil {
+				t.Fatalf("ClaimDueGyms: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("claimed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconciliationRepositoryReports(t *testing.T) {
+	ctx := context.Background()
+	repo := NewReconciliationRepository(openTestDB(t))
+
+	from := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	reports := []*domain.ReconciliationReport{
+		{GymSlug: "level-gym", From: from, To: from.Add(24 * time.Hour), Checked: 2,
+			Discrepancies: []domain.Discrepancy{{
+				Kind: domain.DiscrepancyMissing, PaymentID: "100", ExternalReference: "ref-1",
+				MPStatus: domain.PaymentApproved, Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS",
+				Action: domain.ReconcileNotified, Detail: "queued payment.approved",
+			}},
+			StartedAt: from.Add(24 * time.Hour), FinishedAt: from.Add(24*time.Hour + time.Second)},
+		{GymSlug: "other-gym", From: from, To: from.Add(24 * time.Hour), Error: "MP unavailable",
+			StartedAt: from.Add(24 * time.Hour), FinishedAt: from.Add(24 * time.Hour)},
+		{GymSlug: "level-gym", From: from.Add(24 * time.Hour), To: from.Add(48 * time.Hour),
+			StartedAt: from.Add(48 * time.Hour), FinishedAt: from.Add(48 * time.Hour)},
+	}
+	for _, report := range reports {
+		if err := repo.SaveReport(ctx, report); err != nil {
+			t.Fatalf("SaveReport: %v", err)
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		got, err := repo.GetReport(ctx, reports[0].ID)
+		if err != nil {
+			t.Fatalf("GetReport: %v", err)
+		}
+		if !got.From.Equal(reports[0].From) || !got.To.Equal(reports[0].To) || got.Checked != 2 {
+			t.Errorf("report = %+v, want %+v", got, reports[0])
+		}
+		if len(got.Discrepancies) != 1 {
+			t.Fatalf("discrepancies = %+v, want 1", got.Discrepancies)
+		}
+		d := got.Discrepancies[0]
+		if d.Kind != domain.DiscrepancyMissing || d.Action != domain.ReconcileNotified ||
+			!d.Amount.Equal(domain.NewMoney(1500000, "ARS")) {
+			t.Errorf("discrepancy = %+v, want %+v", d, reports[0].Discrepancies[0])
+		}
+	})
+
+	t.Run("get unknown", func(t *testing.T) {
+		if _, err := repo.GetReport(ctx, 999); !errors.Is(err, domain.ErrReportNotFound) {
+			t.Errorf("err = %v, want ErrReportNotFound", err)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		filter domain.ReconciliationFilter
+		want   []int64
+	}{
+		{name: "all, newest first", want: []int64{reports[2].ID, reports[1].ID, reports[0].ID}},
+		{name: "by gym", filter: domain.ReconciliationFilter{GymSlug: "level-gym"},
+			want: []int64{reports[2].ID, reports[0].ID}},
+		{name: "limited", filter: domain.ReconciliationFilter{Limit: 1}, want: []int64{reports[2].ID}},
+		{name: "unknown gym", filter: domain.ReconciliationFilter{GymSlug: "no-gym"}, want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.ListReports(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("ListReports: %v", err)
+			}
+			ids := []int64{}
+			for _, report := range got {
+				ids = append(ids, report.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("report ids = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
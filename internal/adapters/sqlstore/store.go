@@ -0,0 +1,214 @@
+// Package sqlstore implements the persistence ports on top of database/sql.
+// SQLite is used for local development and Postgres in production.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// Register the database/sql drivers supported by Open.
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Supported driver names.
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "pgx"
+)
+
+// DB wraps a *sql.DB together with the dialect it speaks.
+type DB struct {
+	*sql.DB
+	driver string
+}
+
+// Open connects to the database and applies pending migrations.
+func Open(ctx context.Context, driver, dsn string) (*DB, error) {
+	if driver != DriverSQLite && driver != DriverPostgres {
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+
+	sqlDB, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	if driver == DriverSQLite {
+		// SQLite only allows one writer at a time.
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		sqlDB.SetMaxOpenConns(20)
+		sqlDB.SetConnMaxLifetime(30 * time.Minute)
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	db := &DB{DB: sqlDB, driver: driver}
+	if err := db.migrate(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Driver returns the database/sql driver name.
+func (db *DB) Driver() string {
+	return db.driver
+}
+
+// txKey is the context key for the transaction opened by WithinTransaction.
+type txKey struct{}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction bound to ctx, or the pool when there is none.
+// Repositories must always go through conn so they join open transactions.
+func (db *DB) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db.DB
+}
+
+// WithinTransaction runs fn in a single transaction. Repository calls made
+// with the ctx passed to fn join it. Nested calls reuse the outer transaction.
+func (db *DB) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return repositoryError("failed to begin transaction", err)
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return repositoryError("failed to commit transaction", err)
+	}
+	return nil
+}
+
+// lock serializes the transactions bound to ctx that lock the same key,
+// until the transaction ends. Postgres takes a transaction-level advisory
+// lock on the key's hash; SQLite needs nothing more, as its single
+// connection never runs two transactions at once.
+func (db *DB) lock(ctx context.Context, key string) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); !ok {
+		return repositoryError("failed to lock "+key, errors.New("not in a transaction"))
+	}
+	if db.driver != DriverPostgres {
+		return nil
+	}
+	if _, err := db.conn(ctx).ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key); err != nil {
+		return repositoryError("failed to lock "+key, err)
+	}
+	return nil
+}
+
+// migration is a versioned schema change with per-dialect statements.
+type migration struct {
+	version  int
+	name     string
+	sqlite   []string
+	postgres []string
+}
+
+// migrate applies every migration not recorded in schema_migrations yet.
+// It refuses to run when a recorded migration has another name in this
+// build, as the database's schema would not match what the code expects.
+func (db *DB) migrate(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if name, ok := applied[m.version]; ok {
+			// A database migrated by a build whose migrations differ must not
+			// silently skip the ones that replaced them
+			if name != m.name {
+				return fmt.Errorf("migration %d is %q in the database but %q in this build; recreate the database",
+					m.version, name, m.name)
+			}
+			continue
+		}
+
+		statements := m.sqlite
+		if db.driver == DriverPostgres {
+			statements = m.postgres
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+			m.version, m.name, time.Now().UTC()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// appliedMigrations returns the name of every applied migration by version.
+func (db *DB) appliedMigrations(ctx context.Context) (map[int]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, name FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema version: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]string{}
+	for rows.Next() {
+		var (
+			version int
+			name    string
+		)
+		if err := rows.Scan(&version, &name); err != nil {
+			return nil, fmt.Errorf("read schema version: %w", err)
+		}
+		applied[version] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read schema version: %w", err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,37 @@
+package sqlstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// openTestDB opens a migrated in-memory SQLite database private to the test.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := Open(context.Background(), DriverSQLite,
+		"file:"+name+"?mode=memory&cache=shared&_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestOpenIsIdempotent(t *testing.T) {
+	db := openTestDB(t)
+
+	// Running the migrations again on a migrated database is a no-op
+	if err := db.migrate(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	applied, err := db.appliedMigrations(context.Background())
+	if err != nil {
+		t.Fatalf("appliedMigrations: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+}
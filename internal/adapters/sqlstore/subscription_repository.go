@@ -0,0 +1,131 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// SubscriptionRepository implements ports.SubscriptionRepository.
+type SubscriptionRepository struct {
+	db *DB
+}
+
+// NewSubscriptionRepository creates a new SQL-backed subscription store.
+func NewSubscriptionRepository(db *DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+// LockSubscription serializes the transactions recording a subscription
+// until the one bound to ctx ends.
+func (r *SubscriptionRepository) LockSubscription(ctx context.Context, gymSlug, subscriptionID string) error {
+	return r.db.lock(ctx, "subscription:"+gymSlug+":"+subscriptionID)
+}
+
+// SaveSubscription inserts or updates a subscription record.
+func (r *SubscriptionRepository) SaveSubscription(ctx context.Context, record domain.SubscriptionRecord) error {
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO subscriptions
+			(gym_slug, subscription_id, plan_id, external_reference, status, payer_email,
+			 amount, amount_minor, currency, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (gym_slug, subscription_id) DO UPDATE SET
+			plan_id = excluded.plan_id,
+			external_reference = excluded.external_reference,
+			status = excluded.status,
+			payer_email = excluded.payer_email,
+			amount = excluded.amount,
+			amount_minor = excluded.amount_minor,
+			currency = excluded.currency,
+			updated_at = excluded.updated_at`,
+		record.GymSlug, record.SubscriptionID, record.PlanID, record.ExternalReference,
+		record.Status, record.PayerEmail, record.Amount.Float64(), record.Amount.Minor,
+		record.Amount.Currency, record.UpdatedAt.UTC())
+	if err != nil {
+		return repositoryError("failed to save subscription", err)
+	}
+	return nil
+}
+
+// GetSubscription returns a subscription record.
+func (r *SubscriptionRepository) GetSubscription(ctx context.Context, gymSlug, subscriptionID string) (*domain.SubscriptionRecord, error) {
+	var (
+		s           domain.SubscriptionRecord
+		amountMinor int64
+		currency    string
+	)
+	err := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT gym_slug, subscription_id, plan_id, external_reference, status, payer_email,
+			amount_minor, currency, updated_at
+		FROM subscriptions
+		WHERE gym_slug = $1 AND subscription_id = $2`, gymSlug, subscriptionID).
+		Scan(&s.GymSlug, &s.SubscriptionID, &s.PlanID, &s.ExternalReference,
+			&s.Status, &s.PayerEmail, &amountMinor, &currency, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get subscription", err)
+	}
+	s.Amount = domain.NewMoney(amountMinor, currency)
+	return &s, nil
+}
+
+// LockCharge serializes the transactions recording a subscription charge
+// until the one bound to ctx ends.
+func (r *SubscriptionRepository) LockCharge(ctx context.Context, gymSlug, chargeID string) error {
+	return r.db.lock(ctx, "charge:"+gymSlug+":"+chargeID)
+}
+
+// SaveCharge inserts or updates the last seen state of a subscription charge.
+func (r *SubscriptionRepository) SaveCharge(ctx context.Context, gymSlug string, charge domain.SubscriptionCharge) error {
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO subscription_charges
+			(gym_slug, charge_id, subscription_id, external_reference, status, payment_id,
+			 payment_status, amount_minor, currency, retry_attempt, debit_date, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (gym_slug, charge_id) DO UPDATE SET
+			subscription_id = excluded.subscription_id,
+			external_reference = excluded.external_reference,
+			status = excluded.status,
+			payment_id = excluded.payment_id,
+			payment_status = excluded.payment_status,
+			amount_minor = excluded.amount_minor,
+			currency = excluded.currency,
+			retry_attempt = excluded.retry_attempt,
+			debit_date = excluded.debit_date,
+			updated_at = excluded.updated_at`,
+		gymSlug, charge.ChargeID, charge.SubscriptionID, charge.ExternalReference, charge.Status,
+		charge.PaymentID, charge.PaymentStatus, charge.Amount.Minor, charge.Currency,
+		charge.RetryAttempt, charge.DebitDate.UTC(), time.Now().UTC())
+	if err != nil {
+		return repositoryError("failed to save subscription charge", err)
+	}
+	return nil
+}
+
+// GetCharge returns the last seen state of a subscription charge.
+func (r *SubscriptionRepository) GetCharge(ctx context.Context, gymSlug, chargeID string) (*domain.SubscriptionCharge, error) {
+	var (
+		c           domain.SubscriptionCharge
+		amountMinor int64
+	)
+	err := r.db.conn(ctx).QueryRowContext(ctx, `
+		SELECT charge_id, subscription_id, external_reference, status, payment_id, payment_status,
+			amount_minor, currency, retry_attempt, debit_date
+		FROM subscription_charges
+		WHERE gym_slug = $1 AND charge_id = $2`, gymSlug, chargeID).
+		Scan(&c.ChargeID, &c.SubscriptionID, &c.ExternalReference, &c.Status, &c.PaymentID,
+			&c.PaymentStatus, &amountMinor, &c.Currency, &c.RetryAttempt, &c.DebitDate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrChargeNotFound
+	}
+	if err != nil {
+		return nil, repositoryError("failed to get subscription charge", err)
+	}
+	c.Amount = domain.NewMoney(amountMinor, c.Currency)
+	return &c, nil
+}
@@ -0,0 +1,80 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+)
+
+// Webhook event states.
+const (
+	eventProcessing = "processing"
+	eventProcessed  = "processed"
+)
+
+// processingEventTTL is how long an in-progress claim blocks redeliveries
+// before it is considered abandoned and can be claimed again.
+const processingEventTTL = 5 * time.Minute
+
+// WebhookEventRepository implements ports.WebhookEventRepository.
+type WebhookEventRepository struct {
+	db *DB
+}
+
+// NewWebhookEventRepository creates a new SQL-backed webhook dedup store.
+func NewWebhookEventRepository(db *DB) *WebhookEventRepository {
+	return &WebhookEventRepository{db: db}
+}
+
+// ClaimEvent marks an event as being processed.
+func (r *WebhookEventRepository) ClaimEvent(ctx context.Context, gymSlug, eventKey string) (bool, error) {
+	now := time.Now().UTC()
+
+	res, err := r.db.conn(ctx).ExecContext(ctx, `
+		INSERT INTO webhook_events (gym_slug, event_key, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (gym_slug, event_key) DO NOTHING`,
+		gymSlug, eventKey, eventProcessing, now)
+	if err != nil {
+		return false, repositoryError("failed to claim webhook event", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return true, nil
+	}
+
+	// Take over an abandoned claim
+	res, err = r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE webhook_events
+		SET updated_at = $1
+		WHERE gym_slug = $2 AND event_key = $3 AND status = $4 AND updated_at < $5`,
+		now, gymSlug, eventKey, eventProcessing, now.Add(-processingEventTTL))
+	if err != nil {
+		return false, repositoryError("failed to claim webhook event", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// CompleteEvent marks a claimed event as processed.
+func (r *WebhookEventRepository) CompleteEvent(ctx context.Context, gymSlug, eventKey string) error {
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		UPDATE webhook_events
+		SET status = $1, updated_at = $2
+		WHERE gym_slug = $3 AND event_key = $4`,
+		eventProcessed, time.Now().UTC(), gymSlug, eventKey)
+	if err != nil {
+		return repositoryError("failed to complete webhook event", err)
+	}
+	return nil
+}
+
+// ReleaseEvent drops an in-progress claim so a redelivery can be processed.
+func (r *WebhookEventRepository) ReleaseEvent(ctx context.Context, gymSlug, eventKey string) error {
+	_, err := r.db.conn(ctx).ExecContext(ctx, `
+		DELETE FROM webhook_events
+		WHERE gym_slug = $1 AND event_key = $2 AND status = $3`,
+		gymSlug, eventKey, eventProcessing)
+	if err != nil {
+		return repositoryError("failed to release webhook event", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sqlstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWebhookEventRepositoryClaimEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup handles the event before the redelivery under test claims it
+		setup     func(t *testing.T, repo *WebhookEventRepository)
+		gymSlug   string
+		wantClaim bool
+	}{
+		{
+			name:      "first delivery",
+			gymSlug:   "level-gym",
+			wantClaim: true,
+		},
+		{
+			name: "redelivery while processing",
+			setup: func(t *testing.T, repo *WebhookEventRepository) {
+				claim(t, repo)
+			},
+			gymSlug: "level-gym",
+		},
+		{
+			name: "redelivery of a processed event",
+			setup: func(t *testing.T, repo *WebhookEventRepository) {
+				claim(t, repo)
+				if err := repo.CompleteEvent(context.Background(), "level-gym", "payment:100"); err != nil {
+					t.Fatalf("CompleteEvent: %v", err)
+				}
+			},
+			gymSlug: "level-gym",
+		},
+		{
+			name: "redelivery after a released claim",
+			setup: func(t *testing.T, repo *WebhookEventRepository) {
+				claim(t, repo)
+				if err := repo.ReleaseEvent(context.Background(), "level-gym", "payment:100"); err != nil {
+					t.Fatalf("ReleaseEvent: %v", err)
+				}
+			},
+			gymSlug:   "level-gym",
+			wantClaim: true,
+		},
+		{
+			name: "redelivery after an abandoned claim",
+			setup: func(t *testing.T, repo *WebhookEventRepository) {
+				claim(t, repo)
+				ageEvent(t, repo, processingEventTTL+time.Minute)
+			},
+			gymSlug:   "level-gym",
+			wantClaim: true,
+		},
+		{
+			name: "processed event is never taken over",
+			setup: func(t *testing.T, repo *WebhookEventRepository) {
+				claim(t, repo)
+				if err := repo.CompleteEvent(context.Background(), "level-gym", "payment:100"); err != nil {
+					t.Fatalf("CompleteEvent: %v", err)
+				}
+				ageEvent(t, repo, processingEventTTL+time.Minute)
+			},
+			gymSlug: "level-gym",
+		},
+		{
+			name: "same event for another gym",
+			setup: func(t *testing.T, repo *WebhookEventRepository) {
+				claim(t, repo)
+			},
+			gymSlug:   "other-gym",
+			wantClaim: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewWebhookEventRepository(openTestDB(t))
+			if tt.setup != nil {
+				tt.setup(t, repo)
+			}
+
+			claimed, err := repo.ClaimEvent(context.Background(), tt.gymSlug, "payment:100")
+			if err != nil {
+				t.Fatalf("ClaimEvent: %v", err)
+			}
+			if claimed != tt.wantClaim {
+				t.Errorf("claimed = %v, want %v", claimed, tt.wantClaim)
+			}
+		})
+	}
+}
+
+// claim claims level-gym's payment:100 event.
+func claim(t *testing.T, repo *WebhookEventRepository) {
+	t.Helper()
+	claimed, err := repo.ClaimEvent(context.Background(), "level-gym", "payment:100")
+	if err != nil || !claimed {
+		t.Fatalf("ClaimEvent = %v, %v; want claimed", claimed, err)
+	}
+}
+
+// ageEvent moves the event's last update back by d.
+func ageEvent(t *testing.T, repo *WebhookEventRepository, d time.Duration) {
+	t.Helper()
+	if _, err := repo.db.ExecContext(context.Background(),
+		`UPDATE webhook_events SET updated_at = $1 WHERE event_key = $2`,
+		time.Now().UTC().Add(-d), "payment:100"); err != nil {
+		t.Fatalf("age event: %v", err)
+	}
+}
@@ -2,35 +2,139 @@
 // This is the innermost layer - no external dependencies.
 package domain
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // PaymentRequest represents an incoming checkout request from Django.
-// Note: mp_access_token is passed in-body (server-to-server communication).
+// MPAccessToken is deprecated: the service looks the token up itself and
+// only accepts it in-body while ALLOW_INBODY_ACCESS_TOKEN is enabled.
+//
+// A checkout is either a single item described by Title and Amount, or a
+// list of Items. With Items, Title is an optional summary and Amount, when
+// sent, must match the items total. Amounts are in Currency (DefaultCurrency
+// when empty).
 type PaymentRequest struct {
-	GymSlug           string  `json:"gym_slug" binding:"required"`
-	Amount            float64 `json:"amount" binding:"required,gt=0"`
-	Title             string  `json:"title" binding:"required"`
-	Description       string  `json:"description"`
-	PayerEmail        string  `json:"payer_email" binding:"required,email"`
-	ExternalReference string  `json:"external_reference" binding:"required"`
-	MPAccessToken     string  `json:"mp_access_token" binding:"required"`
+	GymSlug           string         `json:"gym_slug" binding:"required"`
+	Amount            Money          `json:"amount"`
+	Currency          string         `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	Title             string         `json:"title"`
+	Items             []CheckoutItem `json:"items,omitempty" binding:"omitempty,max=50,dive"`
+	Description       string         `json:"description"`
+	PayerEmail        string         `json:"payer_email" binding:"required,email"`
+	ExternalReference string         `json:"external_reference" binding:"required"`
+	MPAccessToken     string         `json:"mp_access_token"`
 	// Optional: Redirect URLs
 	SuccessURL string `json:"success_url"`
 	FailureURL string `json:"failure_url"`
 	PendingURL string `json:"pending_url"`
+	// Optional: Minutes the checkout link stays valid (0 = never expires)
+	ExpiresInMinutes int `json:"expires_in_minutes" binding:"omitempty,gt=0"`
+}
+
+// MaxItemQuantity is the largest quantity of a checkout item.
+const MaxItemQuantity = 1000
+
+// CheckoutItem is one line of a multi-item checkout.
+type CheckoutItem struct {
+	ID          string `json:"id"`
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	CategoryID  string `json:"category_id"`
+	Quantity    int    `json:"quantity" binding:"required,gt=0,lte=1000"`
+	UnitPrice   Money  `json:"unit_price"`
+	PictureURL  string `json:"picture_url" binding:"omitempty,url"`
+}
+
+// CheckoutCurrency returns the currency of the checkout.
+func (r PaymentRequest) CheckoutCurrency() string {
+	if r.Currency != "" {
+		return r.Currency
+	}
+	return DefaultCurrency
+}
+
+// CheckoutItems returns the items to charge: Items when set, otherwise a
+// single item built from Title, Description and Amount. Prices are in the
+// checkout currency; one with more decimals than it allows is an error.
+func (r PaymentRequest) CheckoutItems() ([]CheckoutItem, error) {
+	currency := r.CheckoutCurrency()
+	if len(r.Items) > 0 {
+		items := make([]CheckoutItem, len(r.Items))
+		for i, item := range r.Items {
+			price, err := item.UnitPrice.WithCurrency(currency)
+			if err != nil {
+				return nil, fmt.Errorf("items[%d]: %w", i, err)
+			}
+			item.UnitPrice = price
+			items[i] = item
+		}
+		return items, nil
+	}
+	amount, err := r.Amount.WithCurrency(currency)
+	if err != nil {
+		return nil, fmt.Errorf("amount: %w", err)
+	}
+	return []CheckoutItem{{
+		Title:       r.Title,
+		Description: r.Description,
+		Quantity:    1,
+		UnitPrice:   amount,
+	}}, nil
+}
+
+// TotalAmount returns the sum of all items, or an error when a price does
+// not fit the checkout currency or the total is out of range.
+func (r PaymentRequest) TotalAmount() (Money, error) {
+	items, err := r.CheckoutItems()
+	if err != nil {
+		return Money{}, err
+	}
+	total := NewMoney(0, r.CheckoutCurrency())
+	for i, item := range items {
+		line, err := item.UnitPrice.Mul(item.Quantity)
+		if err == nil {
+			total, err = total.Add(line)
+		}
+		if err != nil {
+			return Money{}, fmt.Errorf("items[%d]: %w", i, err)
+		}
+	}
+	return total, nil
+}
+
+// Summary returns a one-line description of the checkout for the ledger:
+// Title when set, otherwise the item titles.
+func (r PaymentRequest) Summary() string {
+	if r.Title != "" {
+		return r.Title
+	}
+	titles := make([]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		titles = append(titles, item.Title)
+	}
+	return strings.Join(titles, ", ")
 }
 
 // PaymentResponse represents the response after creating a payment preference.
 type PaymentResponse struct {
-	Success          bool   `json:"success"`
-	PreferenceID     string `json:"preference_id,omitempty"`
-	InitPoint        string `json:"init_point,omitempty"`
-	SandboxInitPoint string `json:"sandbox_init_point,omitempty"`
-	Error            string `json:"error,omitempty"`
-	ErrorCode        string `json:"error_code,omitempty"`
+	Success          bool       `json:"success"`
+	PreferenceID     string     `json:"preference_id,omitempty"`
+	InitPoint        string     `json:"init_point,omitempty"`
+	SandboxInitPoint string     `json:"sandbox_init_point,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	ErrorCode        string     `json:"error_code,omitempty"`
 }
 
 // WebhookNotification represents the IPN notification from Mercado Pago.
+//
+// Webhooks carry Type and Data.ID; the classic topic-style IPN carries Topic
+// and Resource (an ID or a resource URL) instead, in the body or the query
+// string. Normalize maps both onto Type and Data.ID.
 type WebhookNotification struct {
 	ID          int64  `json:"id"`
 	LiveMode    bool   `json:"live_mode"`
@@ -42,38 +146,713 @@ type WebhookNotification struct {
 	Data        struct {
 		ID string `json:"id"`
 	} `json:"data"`
+	Topic    string `json:"topic,omitempty"`
+	Resource string `json:"resource,omitempty"`
+}
+
+// Notification types handled by the service. Topic-style IPN topics use the
+// same names.
+const (
+	NotificationPayment                       = "payment"
+	NotificationMerchantOrder                 = "merchant_order"
+	NotificationMerchantOrderWebhook          = "topic_merchant_order_wh"
+	NotificationSubscriptionPreapproval       = "subscription_preapproval"
+	NotificationSubscriptionAuthorizedPayment = "subscription_authorized_payment"
+	NotificationChargebacks                   = "chargebacks"
+)
+
+// IsTopicStyle reports whether this is a classic topic-style IPN.
+func (n WebhookNotification) IsTopicStyle() bool {
+	return n.Topic != ""
+}
+
+// Normalize fills Type from Topic and Data.ID from Resource, so topic-style
+// IPN is processed like a webhook.
+func (n WebhookNotification) Normalize() WebhookNotification {
+	if n.Type == "" {
+		n.Type = n.Topic
+	}
+	if n.Data.ID == "" && n.Resource != "" {
+		resource := strings.TrimRight(n.Resource, "/")
+		n.Data.ID = resource[strings.LastIndex(resource, "/")+1:]
+	}
+	return n
+}
+
+// EventKey returns the key that identifies a distinct notification, used to
+// deduplicate MP redeliveries. The notification ID is preferred, falling back
+// to x-request-id. Returns "" when there is neither (topic-style IPN): such a
+// notification cannot be told apart from a later one about the same resource.
+func (n WebhookNotification) EventKey(xRequestID string) string {
+	if n.ID != 0 {
+		return "id:" + strconv.FormatInt(n.ID, 10)
+	}
+	if xRequestID != "" {
+		return "req:" + xRequestID
+	}
+	return ""
 }
 
 // PaymentInfo contains the details of a confirmed payment.
 type PaymentInfo struct {
+	PaymentID         string `json:"payment_id"`
+	Status            string `json:"status"`
+	StatusDetail      string `json:"status_detail"`
+	ExternalReference string `json:"external_reference"`
+	Amount            Money  `json:"amount"`
+	Currency          string `json:"currency"`
+	PaymentMethod     string `json:"payment_method"`
+	PaymentType       string `json:"payment_type"`
+	PayerEmail        string `json:"payer_email"`
+	// DateApproved is nil until Mercado Pago approves the payment
+	DateApproved    *time.Time `json:"date_approved,omitempty"`
+	DateLastUpdated time.Time  `json:"date_last_updated"`
+}
+
+// MerchantOrder is a Mercado Pago order: the payments made against one
+// preference, of which there can be several (e.g. split across two cards).
+type MerchantOrder struct {
+	OrderID           string   `json:"order_id"`
+	PreferenceID      string   `json:"preference_id"`
+	ExternalReference string   `json:"external_reference"`
+	Status            string   `json:"status"`
+	OrderStatus       string   `json:"order_status"`
+	TotalAmount       Money    `json:"total_amount"`
+	PaidAmount        Money    `json:"paid_amount"`
+	Currency          string   `json:"currency"`
+	PaymentIDs        []string `json:"payment_ids"`
+}
+
+// Chargeback states.
+const (
+	ChargebackOpen     = "open"
+	ChargebackResolved = "resolved"
+)
+
+// Chargeback is a dispute a member opened with their card issuer over a
+// payment. The gym can contest it by sending documentation to Mercado Pago
+// before DocumentationDeadline. It is resolved once MP decides on coverage:
+// with CoverageApplied the gym keeps the money, otherwise it is debited.
+type Chargeback struct {
+	ChargebackID          string     `json:"chargeback_id"`
+	GymSlug               string     `json:"gym_slug"`
+	PaymentID             string     `json:"payment_id"`
+	ExternalReference     string     `json:"external_reference"`
+	Amount                Money      `json:"amount"`
+	Currency              string     `json:"currency"`
+	Status                string     `json:"status"`
+	CoverageApplied       bool       `json:"coverage_applied"`
+	CoverageEligible      bool       `json:"coverage_eligible"`
+	DocumentationRequired bool       `json:"documentation_required"`
+	DocumentationStatus   string     `json:"documentation_status"`
+	DocumentationDeadline *time.Time `json:"documentation_deadline,omitempty"`
+	DateCreated           time.Time  `json:"date_created"`
+	DateLastUpdated       time.Time  `json:"date_last_updated"`
+}
+
+// DjangoWebhookPayload is sent to Django when a payment is confirmed.
+// Chargeback events also carry the chargeback.
+type DjangoWebhookPayload struct {
+	Event             string      `json:"event"`
+	GymSlug           string      `json:"gym_slug"`
+	ExternalReference string      `json:"external_reference"`
+	PaymentID         string      `json:"payment_id"`
+	PaymentStatus     string      `json:"payment_status"`
+	PaymentType       string      `json:"payment_type"`
+	Amount            Money       `json:"amount"`
+	Currency          string      `json:"currency"`
+	PayerEmail        string      `json:"payer_email"`
+	Timestamp         string      `json:"timestamp"`
+	Chargeback        *Chargeback `json:"chargeback,omitempty"`
+}
+
+// GymCredentials holds the secrets needed for a gym.
+type GymCredentials struct {
+	GymSlug        string         `json:"gym_slug"`
+	WebhookSecrets WebhookSecrets `json:"webhook_secrets"`
+	AccessToken    string         `json:"access_token,omitempty"`
+}
+
+// WebhookSecrets holds the secrets a gym's notifications may be signed with.
+// While the secret is being rotated in Mercado Pago, the previous one stays
+// valid until PreviousExpiresAt; without an expiry it is not accepted.
+type WebhookSecrets struct {
+	Current           string    `json:"current"`
+	Previous          string    `json:"previous,omitempty"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+}
+
+// Active returns the secrets valid at now, current first.
+func (s WebhookSecrets) Active(now time.Time) []string {
+	var secrets []string
+	if s.Current != "" {
+		secrets = append(secrets, s.Current)
+	}
+	if s.InGracePeriod(now) {
+		secrets = append(secrets, s.Previous)
+	}
+	return secrets
+}
+
+// InGracePeriod reports whether the previous secret is still accepted at now.
+func (s WebhookSecrets) InGracePeriod(now time.Time) bool {
+	return s.Previous != "" && now.Before(s.PreviousExpiresAt)
+}
+
+// PreferenceRecord is the ledger entry for a created Checkout Pro preference.
+// Amount is the total of Items.
+type PreferenceRecord struct {
+	GymSlug           string         `json:"gym_slug"`
+	ExternalReference string         `json:"external_reference"`
+	PreferenceID      string         `json:"preference_id"`
+	Title             string         `json:"title"`
+	Amount            Money          `json:"amount"`
+	Currency          string         `json:"currency"`
+	Items             []CheckoutItem `json:"items"`
+	PayerEmail        string         `json:"payer_email"`
+	InitPoint         string         `json:"init_point"`
+	CreatedAt         time.Time      `json:"created_at"`
+}
+
+// PaymentSnapshot is a PaymentInfo as fetched from Mercado Pago at a point in time.
+type PaymentSnapshot struct {
+	GymSlug   string      `json:"gym_slug"`
+	Payment   PaymentInfo `json:"payment"`
+	FetchedAt time.Time   `json:"fetched_at"`
+}
+
+// StatusChange records a payment moving from one MP status to another.
+// FromStatus is empty for the first status seen for a payment. Rejected
+// changes broke the payment state machine and were not applied; Reason
+// says why.
+type StatusChange struct {
+	GymSlug           string    `json:"gym_slug"`
+	ExternalReference string    `json:"external_reference"`
+	PaymentID         string    `json:"payment_id"`
+	FromStatus        string    `json:"from_status"`
+	ToStatus          string    `json:"to_status"`
+	Rejected          bool      `json:"rejected"`
+	Reason            string    `json:"reason,omitempty"`
+	ChangedAt         time.Time `json:"changed_at"`
+}
+
+// PaymentStatusEvent is a payment status transition, pushed live to pages
+// waiting for a checkout to be confirmed. FromStatus is empty for the first
+// status seen for a payment, and for the current state sent on subscribing.
+type PaymentStatusEvent struct {
+	Event             string    `json:"event"`
+	GymSlug           string    `json:"gym_slug"`
+	ExternalReference string    `json:"external_reference"`
 	PaymentID         string    `json:"payment_id"`
+	FromStatus        string    `json:"from_status"`
 	Status            string    `json:"status"`
 	StatusDetail      string    `json:"status_detail"`
-	ExternalReference string    `json:"external_reference"`
-	Amount            float64   `json:"amount"`
+	Amount            Money     `json:"amount"`
 	Currency          string    `json:"currency"`
-	PaymentMethod     string    `json:"payment_method"`
-	PaymentType       string    `json:"payment_type"`
+	OccurredAt        time.Time `json:"occurred_at"`
+}
+
+// PaymentHistory is everything the ledger knows about an external reference.
+type PaymentHistory struct {
+	GymSlug           string             `json:"gym_slug"`
+	ExternalReference string             `json:"external_reference"`
+	Preferences       []PreferenceRecord `json:"preferences"`
+	Snapshots         []PaymentSnapshot  `json:"snapshots"`
+	StatusChanges     []StatusChange     `json:"status_changes"`
+	Chargebacks       []Chargeback       `json:"chargebacks"`
+}
+
+// Empty reports whether the ledger has no entries for the reference.
+func (h PaymentHistory) Empty() bool {
+	return len(h.Preferences) == 0 && len(h.Snapshots) == 0 &&
+		len(h.StatusChanges) == 0 && len(h.Chargebacks) == 0
+}
+
+// PaymentStatusResponse represents the response to a payment status query.
+// FetchedAt is when Payment was fetched from Mercado Pago; Refreshed tells
+// whether it was fetched for this query.
+type PaymentStatusResponse struct {
+	Success   bool         `json:"success"`
+	Payment   *PaymentInfo `json:"payment,omitempty"`
+	FetchedAt *time.Time   `json:"fetched_at,omitempty"`
+	Refreshed bool         `json:"refreshed"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode string       `json:"error_code,omitempty"`
+}
+
+// PaymentHistoryResponse represents the response to a payment history query.
+type PaymentHistoryResponse struct {
+	Success   bool            `json:"success"`
+	History   *PaymentHistory `json:"history,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode string          `json:"error_code,omitempty"`
+}
+
+// Idempotency record states.
+const (
+	IdempotencyPending   = "pending"
+	IdempotencyCompleted = "completed"
+)
+
+// IdempotencyRecord tracks a checkout request by its idempotency key.
+// RequestHash identifies the request body so a reused key with a different
+// body can be rejected.
+type IdempotencyRecord struct {
+	Key         string          `json:"key"`
+	GymSlug     string          `json:"gym_slug"`
+	RequestHash string          `json:"request_hash"`
+	Status      string          `json:"status"`
+	Response    PaymentResponse `json:"response"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Outbox message states.
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+// Outbox message kinds select the Django callback a message is delivered to.
+const (
+	OutboxKindPayment      = "payment"
+	OutboxKindSubscription = "subscription"
+)
+
+// OutboxMessage is a Django notification persisted before delivery.
+// Payment messages carry Payload, subscription messages carry Subscription.
+// Dead messages exhausted their attempts and need manual attention.
+type OutboxMessage struct {
+	ID             int64                      `json:"id"`
+	GymSlug        string                     `json:"gym_slug"`
+	Kind           string                     `json:"kind"`
+	Payload        *DjangoWebhookPayload      `json:"payload,omitempty"`
+	Subscription   *DjangoSubscriptionPayload `json:"subscription,omitempty"`
+	Status         string                     `json:"status"`
+	Attempts       int                        `json:"attempts"`
+	LastError      string                     `json:"last_error,omitempty"`
+	LastHTTPStatus int                        `json:"last_http_status,omitempty"`
+	NextAttemptAt  time.Time                  `json:"next_attempt_at"`
+	CreatedAt      time.Time                  `json:"created_at"`
+	UpdatedAt      time.Time                  `json:"updated_at"`
+}
+
+// Delivery filter statuses (in addition to the outbox states).
+const (
+	// DeliveryFailed matches dead messages and pending ones with failed attempts.
+	DeliveryFailed = "failed"
+	// DeliveryRetrying matches pending messages with failed attempts.
+	DeliveryRetrying = "retrying"
+)
+
+// DeliveryFilter selects outbox messages for inspection.
+type DeliveryFilter struct {
+	Status  string
+	GymSlug string
+	Limit   int
+}
+
+// RedeliveryResult reports what happened to each requested redelivery.
+type RedeliveryResult struct {
+	Requeued         []int64 `json:"requeued"`
+	AlreadyDelivered []int64 `json:"already_delivered"`
+	// Pending deliveries are being attempted or waiting for their next
+	// attempt, and were left alone.
+	Pending  []int64 `json:"pending"`
+	NotFound []int64 `json:"not_found"`
+}
+
+// RefundRequest represents a refund request from Django.
+// A nil Amount refunds the full payment; it is in the payment's currency.
+type RefundRequest struct {
+	GymSlug       string `json:"gym_slug" binding:"required"`
+	Amount        *Money `json:"amount"`
+	MPAccessToken string `json:"mp_access_token"`
+}
+
+// RefundInfo contains the details of a Mercado Pago refund.
+type RefundInfo struct {
+	RefundID    string    `json:"refund_id"`
+	PaymentID   string    `json:"payment_id"`
+	Amount      Money     `json:"amount"`
+	Status      string    `json:"status"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// RefundResponse represents the response after requesting a refund.
+type RefundResponse struct {
+	Success   bool        `json:"success"`
+	Refund    *RefundInfo `json:"refund,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ErrorCode string      `json:"error_code,omitempty"`
+}
+
+// CancelRequest represents a request from Django to cancel a pending payment.
+type CancelRequest struct {
+	GymSlug       string `json:"gym_slug" binding:"required"`
+	MPAccessToken string `json:"mp_access_token"`
+}
+
+// CancelResponse represents the response after cancelling a payment.
+type CancelResponse struct {
+	Success   bool         `json:"success"`
+	Payment   *PaymentInfo `json:"payment,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode string       `json:"error_code,omitempty"`
+}
+
+// Payment search date fields.
+const (
+	PaymentSearchCreated = "date_created"
+	PaymentSearchUpdated = "date_last_updated"
+)
+
+// PaymentSearch selects a page of a gym's payments whose Field (date_created
+// or date_last_updated) falls between From and To, oldest first.
+type PaymentSearch struct {
+	Field  string
+	From   time.Time
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+// PaymentPage is one page of a payment search. Total counts every match.
+type PaymentPage struct {
+	Payments []PaymentInfo
+	Total    int
+}
+
+// SubscriptionPlanRequest represents a request from Django to create a
+// recurring plan (preapproval plan) that members can subscribe to.
+type SubscriptionPlanRequest struct {
+	GymSlug       string `json:"gym_slug" binding:"required"`
+	Reason        string `json:"reason" binding:"required"`
+	Amount        Money  `json:"amount"`
+	Currency      string `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	Frequency     int    `json:"frequency" binding:"required,gt=0"`
+	FrequencyType string `json:"frequency_type" binding:"required,oneof=days months"`
+	BackURL       string `json:"back_url"`
+	MPAccessToken string `json:"mp_access_token"`
+}
+
+// SubscriptionPlan contains the details of a Mercado Pago preapproval plan.
+type SubscriptionPlan struct {
+	PlanID        string `json:"plan_id"`
+	Reason        string `json:"reason"`
+	Status        string `json:"status"`
+	Amount        Money  `json:"amount"`
+	Currency      string `json:"currency"`
+	Frequency     int    `json:"frequency"`
+	FrequencyType string `json:"frequency_type"`
+	InitPoint     string `json:"init_point"`
+}
+
+// SubscriptionPlanResponse represents the response after creating a plan.
+type SubscriptionPlanResponse struct {
+	Success   bool              `json:"success"`
+	Plan      *SubscriptionPlan `json:"plan,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	ErrorCode string            `json:"error_code,omitempty"`
+}
+
+// SubscriptionRequest represents a request from Django to subscribe a member.
+// Either PlanID or the recurrence fields (Reason, Amount, Frequency,
+// FrequencyType) must be set. MP requires CardTokenID when subscribing to a plan.
+type SubscriptionRequest struct {
+	GymSlug           string `json:"gym_slug" binding:"required"`
+	PlanID            string `json:"plan_id"`
+	CardTokenID       string `json:"card_token_id"`
+	Reason            string `json:"reason"`
+	Amount            Money  `json:"amount"`
+	Currency          string `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	Frequency         int    `json:"frequency" binding:"omitempty,gt=0"`
+	FrequencyType     string `json:"frequency_type" binding:"omitempty,oneof=days months"`
+	PayerEmail        string `json:"payer_email" binding:"required,email"`
+	ExternalReference string `json:"external_reference" binding:"required"`
+	BackURL           string `json:"back_url"`
+	MPAccessToken     string `json:"mp_access_token"`
+}
+
+// Subscription statuses as reported by Mercado Pago.
+const (
+	SubscriptionPending    = "pending"
+	SubscriptionAuthorized = "authorized"
+	SubscriptionPaused     = "paused"
+	SubscriptionCancelled  = "cancelled"
+)
+
+// SubscriptionInfo contains the details of a Mercado Pago preapproval.
+type SubscriptionInfo struct {
+	SubscriptionID    string     `json:"subscription_id"`
+	PlanID            string     `json:"plan_id,omitempty"`
+	Status            string     `json:"status"`
+	ExternalReference string     `json:"external_reference"`
+	PayerEmail        string     `json:"payer_email"`
+	Reason            string     `json:"reason"`
+	Amount            Money      `json:"amount"`
+	Currency          string     `json:"currency"`
+	Frequency         int        `json:"frequency"`
+	FrequencyType     string     `json:"frequency_type"`
+	InitPoint         string     `json:"init_point,omitempty"`
+	NextPaymentDate   *time.Time `json:"next_payment_date,omitempty"`
+}
+
+// SubscriptionResponse represents the response after creating or updating a subscription.
+type SubscriptionResponse struct {
+	Success      bool              `json:"success"`
+	Subscription *SubscriptionInfo `json:"subscription,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	ErrorCode    string            `json:"error_code,omitempty"`
+}
+
+// SubscriptionActionRequest represents a pause, resume or cancel request from Django.
+type SubscriptionActionRequest struct {
+	GymSlug       string `json:"gym_slug" binding:"required"`
+	MPAccessToken string `json:"mp_access_token"`
+}
+
+// SubscriptionRecord is the ledger entry for a subscription, holding the
+// last status seen so lifecycle transitions can be detected.
+type SubscriptionRecord struct {
+	GymSlug           string    `json:"gym_slug"`
+	SubscriptionID    string    `json:"subscription_id"`
+	PlanID            string    `json:"plan_id"`
+	ExternalReference string    `json:"external_reference"`
+	Status            string    `json:"status"`
 	PayerEmail        string    `json:"payer_email"`
-	DateApproved      time.Time `json:"date_approved"`
+	Amount            Money     `json:"amount"`
+	UpdatedAt         time.Time `json:"updated_at"`
 }
 
-// DjangoWebhookPayload is sent to Django when a payment is confirmed.
-type DjangoWebhookPayload struct {
-	Event             string  `json:"event"`
-	GymSlug           string  `json:"gym_slug"`
-	ExternalReference string  `json:"external_reference"`
-	PaymentID         string  `json:"payment_id"`
-	PaymentStatus     string  `json:"payment_status"`
-	PaymentType       string  `json:"payment_type"`
-	Amount            float64 `json:"amount"`
-	PayerEmail        string  `json:"payer_email"`
-	Timestamp         string  `json:"timestamp"`
+// SubscriptionCharge contains the details of a recurring charge
+// (MP authorized payment) of a subscription.
+type SubscriptionCharge struct {
+	ChargeID          string    `json:"charge_id"`
+	SubscriptionID    string    `json:"subscription_id"`
+	ExternalReference string    `json:"external_reference"`
+	Status            string    `json:"status"`
+	PaymentID         string    `json:"payment_id,omitempty"`
+	PaymentStatus     string    `json:"payment_status,omitempty"`
+	Amount            Money     `json:"amount"`
+	Currency          string    `json:"currency"`
+	RetryAttempt      int       `json:"retry_attempt"`
+	DebitDate         time.Time `json:"debit_date"`
 }
 
-// GymCredentials holds the secrets needed for a gym.
-type GymCredentials struct {
-	GymSlug       string `json:"gym_slug"`
-	WebhookSecret string `json:"webhook_secret"`
-	AccessToken   string `json:"access_token,omitempty"`
+// DjangoSubscriptionPayload is sent to Django on subscription lifecycle events.
+type DjangoSubscriptionPayload struct {
+	Event              string `json:"event"`
+	GymSlug            string `json:"gym_slug"`
+	SubscriptionID     string `json:"subscription_id"`
+	PlanID             string `json:"plan_id,omitempty"`
+	ExternalReference  string `json:"external_reference"`
+	SubscriptionStatus string `json:"subscription_status"`
+	PayerEmail         string `json:"payer_email,omitempty"`
+	Amount             Money  `json:"amount"`
+	Currency           string `json:"currency"`
+	ChargeID           string `json:"charge_id,omitempty"`
+	PaymentID          string `json:"payment_id,omitempty"`
+	PaymentStatus      string `json:"payment_status,omitempty"`
+	Timestamp          string `json:"timestamp"`
+}
+
+// GymSettings holds the per-gym checkout configuration: the Mercado Pago
+// site (country) and currency, locale, default back URLs, notification URL
+// base and the descriptor shown on card statements. Empty fields fall back
+// to GymDefaults.
+type GymSettings struct {
+	GymSlug             string `json:"gym_slug"`
+	SiteID              string `json:"site_id"`
+	Currency            string `json:"currency"`
+	Locale              string `json:"locale"`
+	SuccessURL          string `json:"success_url"`
+	FailureURL          string `json:"failure_url"`
+	PendingURL          string `json:"pending_url"`
+	SubscriptionURL     string `json:"subscription_url"`
+	NotificationBaseURL string `json:"notification_base_url"`
+	StatementDescriptor string `json:"statement_descriptor"`
+
+	// NotificationToken is the signed tenant token added to the
+	// notification URL. Set by the service, never by Django.
+	NotificationToken string `json:"-"`
+}
+
+// GymDefaults are the service-wide settings used where a gym has none.
+type GymDefaults struct {
+	SiteID              string
+	FrontendURL         string
+	NotificationBaseURL string
+}
+
+// mpSite describes a Mercado Pago site (country).
+type mpSite struct {
+	currency string
+	locale   string
+}
+
+// mpSites maps MP site IDs to their currency and locale.
+var mpSites = map[string]mpSite{
+	"MLA": {currency: "ARS", locale: "es-AR"},
+	"MLB": {currency: "BRL", locale: "pt-BR"},
+	"MLC": {currency: "CLP", locale: "es-CL"},
+	"MCO": {currency: "COP", locale: "es-CO"},
+	"MLM": {currency: "MXN", locale: "es-MX"},
+	"MPE": {currency: "PEN", locale: "es-PE"},
+	"MLU": {currency: "UYU", locale: "es-UY"},
+}
+
+// WithDefaults fills empty settings: site from defaults, currency and
+// locale from the site, and back URLs under the defaults' frontend URL.
+func (s GymSettings) WithDefaults(d GymDefaults) GymSettings {
+	if s.SiteID == "" {
+		s.SiteID = d.SiteID
+	}
+	site, known := mpSites[s.SiteID]
+	if s.Currency == "" {
+		s.Currency = site.currency
+		if !known {
+			s.Currency = DefaultCurrency
+		}
+	}
+	if s.Locale == "" {
+		s.Locale = site.locale
+	}
+
+	base := strings.TrimRight(d.FrontendURL, "/") + "/gym/" + s.GymSlug
+	if s.SuccessURL == "" {
+		s.SuccessURL = base + "/payment/success"
+	}
+	if s.FailureURL == "" {
+		s.FailureURL = base + "/payment/failure"
+	}
+	if s.PendingURL == "" {
+		s.PendingURL = base + "/payment/pending"
+	}
+	if s.SubscriptionURL == "" {
+		s.SubscriptionURL = base + "/subscription"
+	}
+	if s.NotificationBaseURL == "" {
+		s.NotificationBaseURL = d.NotificationBaseURL
+	}
+	return s
+}
+
+// OAuthToken holds the Mercado Pago credentials a gym granted through the
+// OAuth authorization-code flow.
+type OAuthToken struct {
+	GymSlug      string    `json:"gym_slug"`
+	AccessToken  string    `json:"-"`
+	RefreshToken string    `json:"-"`
+	PublicKey    string    `json:"public_key"`
+	Scope        string    `json:"scope"`
+	LiveMode     bool      `json:"live_mode"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Expired reports whether the access token is expired at now.
+func (t OAuthToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// OAuthAuthorization is the response of the authorize endpoint.
+type OAuthAuthorization struct {
+	Success          bool       `json:"success"`
+	GymSlug          string     `json:"gym_slug,omitempty"`
+	AuthorizationURL string     `json:"authorization_url,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	ErrorCode        string     `json:"error_code,omitempty"`
+}
+
+// OAuthStatus is the response of the connection status endpoint.
+type OAuthStatus struct {
+	Success   bool        `json:"success"`
+	GymSlug   string      `json:"gym_slug,omitempty"`
+	Connected bool        `json:"connected"`
+	Token     *OAuthToken `json:"token,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ErrorCode string      `json:"error_code,omitempty"`
+}
+
+// BackfillRequest selects the payments a backfill imports into the ledger:
+// those created between From and To. With Replay, each imported payment is
+// queued for Django as a payment.imported event. A DryRun changes nothing.
+type BackfillRequest struct {
+	GymSlug string
+	From    time.Time
+	To      time.Time
+	Replay  bool
+	DryRun  bool
+}
+
+// BackfillResult counts what a backfill did, or would do in a dry run.
+// Payments already in the ledger are left alone and never replayed, and
+// those without an external reference are skipped.
+type BackfillResult struct {
+	Found           int `json:"found"`
+	Imported        int `json:"imported"`
+	AlreadyRecorded int `json:"already_recorded"`
+	Skipped         int `json:"skipped"`
+	Replayed        int `json:"replayed"`
+}
+
+// Reconciliation discrepancy kinds.
+const (
+	// DiscrepancyMissing is a payment MP has and the ledger never recorded.
+	DiscrepancyMissing = "missing"
+	// DiscrepancyStatusMismatch is a payment MP reports in a later status than the ledger.
+	DiscrepancyStatusMismatch = "status_mismatch"
+	// DiscrepancyConflict is a payment MP reports in a status the recorded one cannot move to.
+	DiscrepancyConflict = "conflict"
+	// DiscrepancyUndelivered is a payment whose last Django notification was dead-lettered.
+	DiscrepancyUndelivered = "undelivered"
+)
+
+// Reconciliation actions taken on a discrepancy.
+const (
+	// ReconcileNotified means the payment was recorded and Django notified.
+	ReconcileNotified = "notified"
+	// ReconcileRequeued means the dead notification was queued again.
+	ReconcileRequeued = "requeued"
+	// ReconcileFlagged means nothing was changed; someone has to look at it.
+	ReconcileFlagged = "flagged"
+)
+
+// Discrepancy is a difference between Mercado Pago and the ledger found
+// while reconciling, and what was done about it.
+type Discrepancy struct {
+	Kind              string `json:"kind"`
+	PaymentID         string `json:"payment_id"`
+	ExternalReference string `json:"external_reference"`
+	MPStatus          string `json:"mp_status"`
+	RecordedStatus    string `json:"recorded_status,omitempty"`
+	Amount            Money  `json:"amount"`
+	Currency          string `json:"currency"`
+	Action            string `json:"action"`
+	Detail            string `json:"detail,omitempty"`
+}
+
+// ReconciliationReport is the outcome of comparing a gym's Mercado Pago
+// payments updated between From and To with the ledger. Error is set when
+// the run stopped early; the discrepancies found until then are kept.
+type ReconciliationReport struct {
+	ID            int64         `json:"id"`
+	GymSlug       string        `json:"gym_slug"`
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	Checked       int           `json:"checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	Error         string        `json:"error,omitempty"`
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+}
+
+// ReconciliationFilter selects reconciliation reports, newest first.
+type ReconciliationFilter struct {
+	GymSlug string
+	Limit   int
 }
@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPaymentRequestTotalAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     PaymentRequest
+		want    Money
+		wantErr bool
+	}{
+		{
+			name: "single amount",
+			req:  PaymentRequest{Amount: Money{Minor: 1500000}},
+			want: NewMoney(1500000, "ARS"),
+		},
+		{
+			name: "items with quantities",
+			req: PaymentRequest{Currency: "ARS", Items: []CheckoutItem{
+				{Title: "Pack 10 clases", Quantity: 2, UnitPrice: Money{Minor: 750000}},
+				{Title: "Toalla", Quantity: 1, UnitPrice: Money{Minor: 250050}},
+			}},
+			want: NewMoney(1750050, "ARS"),
+		},
+		{
+			name: "CLP amount",
+			req:  PaymentRequest{Currency: "CLP", Amount: Money{Minor: 1500000}},
+			want: NewMoney(15000, "CLP"),
+		},
+		{
+			name:    "CLP amount with decimals",
+			req:     PaymentRequest{Currency: "CLP", Amount: Money{Minor: 1500050}},
+			wantErr: true,
+		},
+		{
+			name: "line overflow",
+			req: PaymentRequest{Items: []CheckoutItem{
+				{Title: "Pack", Quantity: MaxItemQuantity, UnitPrice: Money{Minor: math.MaxInt64 / 100}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "total overflow",
+			req: PaymentRequest{Items: []CheckoutItem{
+				{Title: "Pack", Quantity: 1, UnitPrice: Money{Minor: math.MaxInt64}},
+				{Title: "Toalla", Quantity: 1, UnitPrice: Money{Minor: 1}},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.TotalAmount()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("err = %v, want ErrInvalidAmount", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s %s, want %s %s", got, got.Currency, tt.want, tt.want.Currency)
+			}
+		})
+	}
+}
+
+func TestWebhookSecretsActive(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		secrets   WebhookSecrets
+		want      []string
+		wantGrace bool
+	}{
+		{name: "current only", secrets: WebhookSecrets{Current: "new"}, want: []string{"new"}},
+		{
+			name:      "previous in its grace period",
+			secrets:   WebhookSecrets{Current: "new", Previous: "old", PreviousExpiresAt: now.Add(time.Hour)},
+			want:      []string{"new", "old"},
+			wantGrace: true,
+		},
+		{
+			name:    "previous expired",
+			secrets: WebhookSecrets{Current: "new", Previous: "old", PreviousExpiresAt: now},
+			want:    []string{"new"},
+		},
+		{
+			name:    "previous without expiry",
+			secrets: WebhookSecrets{Current: "new", Previous: "old"},
+			want:    []string{"new"},
+		},
+		{name: "none configured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.secrets.Active(now); !slices.Equal(got, tt.want) {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+			if got := tt.secrets.InGracePeriod(now); got != tt.wantGrace {
+				t.Errorf("InGracePeriod() = %t, want %t", got, tt.wantGrace)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 // Package domain contains the core business entities for the payment service.
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Domain errors - represent business rule violations.
 var (
@@ -19,6 +22,46 @@ var (
 
 	// ErrDjangoCallbackFailed is returned when Django notification fails.
 	ErrDjangoCallbackFailed = errors.New("failed to notify Django backend")
+
+	// ErrDjangoUnavailable is returned when Django cannot be reached or fails.
+	ErrDjangoUnavailable = errors.New("Django backend unavailable")
+
+	// ErrPaymentNotFound is returned when the ledger has no record of a payment.
+	ErrPaymentNotFound = errors.New("payment not found")
+
+	// ErrChargebackNotFound is returned when the ledger has no record of a chargeback.
+	ErrChargebackNotFound = errors.New("chargeback not found")
+
+	// ErrSubscriptionNotFound is returned when a subscription does not exist.
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+
+	// ErrChargeNotFound is returned when a subscription charge was never recorded.
+	ErrChargeNotFound = errors.New("subscription charge not found")
+
+	// ErrDeliveryNotFound is returned when an outbox message does not exist.
+	ErrDeliveryNotFound = errors.New("delivery not found")
+
+	// ErrDeliveryPending is returned when requeuing an outbox message that is
+	// being delivered or waiting for its next attempt.
+	ErrDeliveryPending = errors.New("delivery is still pending")
+
+	// ErrReportNotFound is returned when a reconciliation report does not exist.
+	ErrReportNotFound = errors.New("reconciliation report not found")
+
+	// ErrOAuthTokenNotFound is returned when a gym has not connected Mercado Pago through OAuth.
+	ErrOAuthTokenNotFound = errors.New("OAuth token not found")
+
+	// ErrOAuthStateInvalid is returned for a forged, expired or reused OAuth state.
+	ErrOAuthStateInvalid = errors.New("invalid OAuth state")
+
+	// ErrIllegalTransition is returned when a payment status cannot follow the recorded one.
+	ErrIllegalTransition = errors.New("illegal payment status transition")
+
+	// ErrInvalidAmount is returned for amounts that cannot be parsed exactly.
+	ErrInvalidAmount = errors.New("invalid amount")
+
+	// ErrRepositoryError is returned when the payment ledger fails.
+	ErrRepositoryError = errors.New("payment repository error")
 )
 
 // ServiceError wraps errors with additional context.
@@ -43,3 +86,17 @@ func (e *ServiceError) Unwrap() error {
 func NewServiceError(err error, message, code string) *ServiceError {
 	return &ServiceError{Err: err, Message: message, Code: code}
 }
+
+// CallbackError is returned when Django answers a callback with a non-2xx status.
+type CallbackError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *CallbackError) Error() string {
+	return fmt.Sprintf("Django returned status %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *CallbackError) Unwrap() error {
+	return ErrDjangoCallbackFailed
+}
@@ -0,0 +1,261 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used when a request does not specify a currency.
+const DefaultCurrency = "ARS"
+
+// RoundingMode decides how amounts with more decimals than a currency's
+// minor unit are rounded.
+type RoundingMode int
+
+// Supported rounding modes.
+const (
+	// RoundHalfUp rounds ties away from zero (commercial rounding).
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds ties to the nearest even digit (banker's rounding).
+	RoundHalfEven
+)
+
+// currencySpec describes a currency's minor unit and rounding rule.
+type currencySpec struct {
+	exponent int
+	rounding RoundingMode
+}
+
+// currencySpecs lists the currencies Mercado Pago operates in.
+// Unknown currencies fall back to unboundSpec.
+var currencySpecs = map[string]currencySpec{
+	"ARS": {exponent: 2, rounding: RoundHalfUp},
+	"BRL": {exponent: 2, rounding: RoundHalfUp},
+	"MXN": {exponent: 2, rounding: RoundHalfUp},
+	"UYU": {exponent: 2, rounding: RoundHalfUp},
+	"PEN": {exponent: 2, rounding: RoundHalfUp},
+	"COP": {exponent: 2, rounding: RoundHalfUp},
+	"USD": {exponent: 2, rounding: RoundHalfEven},
+	"CLP": {exponent: 0, rounding: RoundHalfUp},
+}
+
+// unboundSpec applies to amounts without a currency, i.e. as decoded from
+// JSON before the request currency is known.
+var unboundSpec = currencySpec{exponent: 2, rounding: RoundHalfUp}
+
+// Money is an exact amount in integer minor units of an ISO 4217 currency
+// (e.g. centavos for ARS, pesos for CLP).
+//
+// In JSON, Money is a plain decimal number ("amount": 15000.00), so the wire
+// format is unchanged. Decoded amounts have no currency and at most two
+// decimals until they are bound to one with WithCurrency.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// NewMoney returns an amount of minor units in currency.
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// ParseMoney parses a decimal string into currency, rounding to its minor
+// unit with the currency's rounding rule.
+func ParseMoney(s, currency string) (Money, error) {
+	spec := specFor(currency)
+	minor, err := parseMinor(s, spec, false)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// MoneyFromFloat converts a float amount (as returned by the Mercado Pago
+// API) into currency. The float's shortest decimal representation is
+// rounded, so 14999.999999 becomes 15000.00. NaN, infinities and amounts
+// out of range are rejected with ErrInvalidAmount.
+func MoneyFromFloat(f float64, currency string) (Money, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Money{}, fmt.Errorf("%w: %v", ErrInvalidAmount, f)
+	}
+	return ParseMoney(strconv.FormatFloat(f, 'f', -1, 64), currency)
+}
+
+// WithCurrency binds an amount decoded without currency to currency.
+// Amounts with more decimals than its minor unit, such as 1500.50 CLP, are
+// rejected with ErrInvalidAmount rather than rounded. Amounts that already
+// have a currency are returned unchanged.
+func (m Money) WithCurrency(currency string) (Money, error) {
+	if m.Currency != "" {
+		return m, nil
+	}
+	spec := specFor(currency)
+	if spec.exponent == unboundSpec.exponent {
+		return Money{Minor: m.Minor, Currency: currency}, nil
+	}
+	minor, err := parseMinor(m.String(), spec, true)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %s has more decimals than %s allows", ErrInvalidAmount, m, currency)
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// Add returns m + other. Both amounts must be in the same currency.
+// A sum out of range is rejected with ErrInvalidAmount.
+func (m Money) Add(other Money) (Money, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = other.Currency
+	}
+	sum := m.Minor + other.Minor
+	if (other.Minor > 0 && sum < m.Minor) || (other.Minor < 0 && sum > m.Minor) {
+		return Money{}, fmt.Errorf("%w: %s + %s is out of range", ErrInvalidAmount, m, other)
+	}
+	return Money{Minor: sum, Currency: currency}, nil
+}
+
+// Mul returns m multiplied by a quantity. A product out of range is
+// rejected with ErrInvalidAmount.
+func (m Money) Mul(quantity int) (Money, error) {
+	q := int64(quantity)
+	product := m.Minor * q
+	if q != 0 && (product/q != m.Minor || (q == -1 && m.Minor == math.MinInt64)) {
+		return Money{}, fmt.Errorf("%w: %s x %d is out of range", ErrInvalidAmount, m, quantity)
+	}
+	return Money{Minor: product, Currency: m.Currency}, nil
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// IsPositive reports whether the amount is greater than zero.
+func (m Money) IsPositive() bool {
+	return m.Minor > 0
+}
+
+// Equal reports whether both amounts are the same value in the same currency.
+func (m Money) Equal(other Money) bool {
+	return m.Minor == other.Minor && m.Currency == other.Currency
+}
+
+// Float64 returns the amount in major units, for APIs that only take floats.
+func (m Money) Float64() float64 {
+	f, _ := strconv.ParseFloat(m.String(), 64)
+	return f
+}
+
+// String formats the amount as a decimal with the currency's minor digits.
+func (m Money) String() string {
+	exponent := specFor(m.Currency).exponent
+
+	sign := ""
+	minor := m.Minor
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	digits := strconv.FormatInt(minor, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+// MarshalJSON encodes the amount as a decimal number.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a decimal number or string into an amount without
+// currency. More than two decimals is rejected rather than silently rounded.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*m = Money{}
+		return nil
+	}
+	minor, err := parseMinor(s, unboundSpec, true)
+	if err != nil {
+		return err
+	}
+	*m = Money{Minor: minor}
+	return nil
+}
+
+// specFor returns the minor unit and rounding rule of a currency.
+func specFor(currency string) currencySpec {
+	if spec, ok := currencySpecs[currency]; ok {
+		return spec
+	}
+	return unboundSpec
+}
+
+// parseMinor parses a plain decimal ("-1234.5678") into minor units.
+// Extra decimals are rounded with spec.rounding, or rejected when exact is set.
+func parseMinor(s string, spec currencySpec, exact bool) (int64, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	var dropped string
+	if len(fracPart) > spec.exponent {
+		dropped = fracPart[spec.exponent:]
+		fracPart = fracPart[:spec.exponent]
+	}
+	fracPart += strings.Repeat("0", spec.exponent-len(fracPart))
+	if exact && strings.Trim(dropped, "0") != "" {
+		return 0, fmt.Errorf("%w: %q has more than %d decimals", ErrInvalidAmount, s, spec.exponent)
+	}
+
+	minor, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+	}
+	if roundsUp(dropped, minor, spec.rounding) {
+		if minor == math.MaxInt64 {
+			return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+		}
+		minor++
+	}
+	if negative {
+		minor = -minor
+	}
+	return minor, nil
+}
+
+// roundsUp reports whether the dropped decimals round the kept magnitude up.
+func roundsUp(dropped string, kept int64, mode RoundingMode) bool {
+	if dropped == "" || dropped[0] < '5' {
+		return false
+	}
+	if dropped[0] > '5' || strings.Trim(dropped[1:], "0") != "" {
+		return true
+	}
+	// Exactly half
+	if mode == RoundHalfEven {
+		return kept%2 == 1
+	}
+	return true
+}
+
+// isDigits reports whether s only contains ASCII digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
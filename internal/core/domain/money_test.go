@@ -0,0 +1,232 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input    string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{input: "15000", currency: "ARS", want: 1500000},
+		{input: "15000.5", currency: "ARS", want: 1500050},
+		{input: "0.005", currency: "ARS", want: 1},
+		{input: "0.004", currency: "ARS", want: 0},
+		{input: "-0.005", currency: "ARS", want: -1},
+		{input: "0.125", currency: "USD", want: 12},
+		{input: "0.135", currency: "USD", want: 14},
+		{input: "0.1251", currency: "USD", want: 13},
+		{input: "1500.5", currency: "CLP", want: 1501},
+		{input: "1500.4", currency: "CLP", want: 1500},
+		{input: "12.34", currency: "XYZ", want: 1234},
+		{input: "92233720368547758.07", currency: "ARS", want: math.MaxInt64},
+		{input: "92233720368547758.075", currency: "ARS", wantErr: true},
+		{input: "92233720368547758.08", currency: "ARS", wantErr: true},
+		{input: "", currency: "ARS", wantErr: true},
+		{input: ".5", currency: "ARS", wantErr: true},
+		{input: "1e3", currency: "ARS", wantErr: true},
+		{input: "12,50", currency: "ARS", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.input, tt.currency)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("err = %v, want ErrInvalidAmount", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Minor != tt.want || got.Currency != tt.currency {
+				t.Errorf("got %d %s, want %d %s", got.Minor, got.Currency, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    float64
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{name: "exact", input: 15000, currency: "ARS", want: 1500000},
+		{name: "float noise", input: 14999.999999, currency: "ARS", want: 1500000},
+		{name: "binary fraction", input: 0.1 + 0.2, currency: "ARS", want: 30},
+		{name: "no minor unit", input: 15000, currency: "CLP", want: 15000},
+		{name: "NaN", input: math.NaN(), currency: "ARS", wantErr: true},
+		{name: "infinity", input: math.Inf(1), currency: "ARS", wantErr: true},
+		{name: "out of range", input: 1e20, currency: "ARS", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MoneyFromFloat(tt.input, tt.currency)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("err = %v, want ErrInvalidAmount", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Minor != tt.want {
+				t.Errorf("got %d minor units, want %d", got.Minor, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyWithCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Money
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{name: "two decimals", amount: Money{Minor: 150050}, currency: "ARS", want: NewMoney(150050, "ARS")},
+		{name: "whole CLP", amount: Money{Minor: 150000}, currency: "CLP", want: NewMoney(1500, "CLP")},
+		{name: "CLP with decimals", amount: Money{Minor: 150050}, currency: "CLP", wantErr: true},
+		{name: "already bound", amount: NewMoney(1500, "CLP"), currency: "ARS", want: NewMoney(1500, "CLP")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.WithCurrency(tt.currency)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("err = %v, want ErrInvalidAmount", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s %s, want %s %s", got, got.Currency, tt.want, tt.want.Currency)
+			}
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func() (Money, error)
+		want    Money
+		wantErr bool
+	}{
+		{name: "add", op: func() (Money, error) { return NewMoney(150, "ARS").Add(NewMoney(250, "ARS")) },
+			want: NewMoney(400, "ARS")},
+		{name: "add to unbound", op: func() (Money, error) { return Money{}.Add(NewMoney(250, "ARS")) },
+			want: NewMoney(250, "ARS")},
+		{name: "add overflow", op: func() (Money, error) { return NewMoney(math.MaxInt64, "ARS").Add(NewMoney(1, "ARS")) },
+			wantErr: true},
+		{name: "add underflow", op: func() (Money, error) { return NewMoney(math.MinInt64, "ARS").Add(NewMoney(-1, "ARS")) },
+			wantErr: true},
+		{name: "mul", op: func() (Money, error) { return NewMoney(750000, "ARS").Mul(3) },
+			want: NewMoney(2250000, "ARS")},
+		{name: "mul by zero", op: func() (Money, error) { return NewMoney(750000, "ARS").Mul(0) },
+			want: NewMoney(0, "ARS")},
+		{name: "mul overflow", op: func() (Money, error) { return NewMoney(math.MaxInt64/2+1, "ARS").Mul(2) },
+			wantErr: true},
+		{name: "mul negative overflow", op: func() (Money, error) { return NewMoney(math.MinInt64, "ARS").Mul(-1) },
+			wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("err = %v, want ErrInvalidAmount", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %d %s, want %d %s", got.Minor, got.Currency, tt.want.Minor, tt.want.Currency)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		amount Money
+		want   string
+	}{
+		{amount: NewMoney(1500000, "ARS"), want: "15000.00"},
+		{amount: NewMoney(5, "ARS"), want: "0.05"},
+		{amount: NewMoney(-5, "USD"), want: "-0.05"},
+		{amount: NewMoney(15000, "CLP"), want: "15000"},
+		{amount: Money{Minor: 150}, want: "1.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.amount.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: `15000`, want: 1500000},
+		{input: `15000.50`, want: 1500050},
+		{input: `"15000.50"`, want: 1500050},
+		{input: `null`, want: 0},
+		{input: `15000.505`, wantErr: true},
+		{input: `"abc"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got struct {
+				Amount Money `json:"amount"`
+			}
+			err := json.Unmarshal([]byte(`{"amount":`+tt.input+`}`), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decoded %s as %s, want an error", tt.input, got.Amount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Amount.Minor != tt.want || got.Amount.Currency != "" {
+				t.Errorf("decoded %+v, want %d minor units without currency", got.Amount, tt.want)
+			}
+
+			encoded, err := json.Marshal(got.Amount)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if decoded := string(encoded); decoded != got.Amount.String() {
+				t.Errorf("encoded %s, want %s", decoded, got.Amount.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package domain
+
+import "fmt"
+
+// Payment statuses as reported by Mercado Pago.
+const (
+	PaymentPending     = "pending"
+	PaymentInProcess   = "in_process"
+	PaymentAuthorized  = "authorized"
+	PaymentApproved    = "approved"
+	PaymentInMediation = "in_mediation"
+	PaymentRejected    = "rejected"
+	PaymentCancelled   = "cancelled"
+	PaymentRefunded    = "refunded"
+	PaymentChargedBack = "charged_back"
+)
+
+// paymentTransitions is the payment state machine: the statuses each status
+// may move to. Statuses listed without successors are final.
+var paymentTransitions = map[string][]string{
+	PaymentPending:     {PaymentInProcess, PaymentAuthorized, PaymentApproved, PaymentRejected, PaymentCancelled},
+	PaymentInProcess:   {PaymentAuthorized, PaymentApproved, PaymentRejected, PaymentCancelled},
+	PaymentAuthorized:  {PaymentApproved, PaymentRejected, PaymentCancelled},
+	PaymentApproved:    {PaymentInMediation, PaymentRefunded, PaymentChargedBack},
+	PaymentInMediation: {PaymentApproved, PaymentRefunded, PaymentChargedBack},
+	PaymentRejected:    nil,
+	PaymentCancelled:   nil,
+	PaymentRefunded:    nil,
+	PaymentChargedBack: nil,
+}
+
+// CheckPaymentTransition returns an error wrapping ErrIllegalTransition when
+// a payment may not move from one status to another, typically because a
+// notification arrived out of order. The first status of a payment (from is
+// empty) and statuses the state machine does not know are always allowed.
+func CheckPaymentTransition(from, to string) error {
+	if from == "" || from == to {
+		return nil
+	}
+	next, known := paymentTransitions[from]
+	if !known {
+		return nil
+	}
+	if _, known := paymentTransitions[to]; !known {
+		return nil
+	}
+	if len(next) == 0 {
+		return fmt.Errorf("%w: %s is final, cannot move to %s", ErrIllegalTransition, from, to)
+	}
+	for _, status := range next {
+		if status == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s cannot move to %s", ErrIllegalTransition, from, to)
+}
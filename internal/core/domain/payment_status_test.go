@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPaymentTransition(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		wantErr bool
+	}{
+		// First status and redeliveries
+		{from: "", to: PaymentApproved},
+		{from: "", to: PaymentRefunded},
+		{from: PaymentApproved, to: PaymentApproved},
+		{from: PaymentRejected, to: PaymentRejected},
+
+		// Forward moves
+		{from: PaymentPending, to: PaymentInProcess},
+		{from: PaymentPending, to: PaymentApproved},
+		{from: PaymentPending, to: PaymentCancelled},
+		{from: PaymentInProcess, to: PaymentRejected},
+		{from: PaymentAuthorized, to: PaymentApproved},
+		{from: PaymentApproved, to: PaymentRefunded},
+		{from: PaymentApproved, to: PaymentInMediation},
+		{from: PaymentInMediation, to: PaymentApproved},
+		{from: PaymentInMediation, to: PaymentChargedBack},
+
+		// Out-of-order notifications
+		{from: PaymentApproved, to: PaymentPending, wantErr: true},
+		{from: PaymentInProcess, to: PaymentPending, wantErr: true},
+		{from: PaymentApproved, to: PaymentCancelled, wantErr: true},
+		{from: PaymentPending, to: PaymentRefunded, wantErr: true},
+
+		// Final statuses
+		{from: PaymentRejected, to: PaymentApproved, wantErr: true},
+		{from: PaymentCancelled, to: PaymentPending, wantErr: true},
+		{from: PaymentRefunded, to: PaymentApproved, wantErr: true},
+		{from: PaymentChargedBack, to: PaymentRefunded, wantErr: true},
+
+		// Statuses the state machine does not know
+		{from: "partially_refunded", to: PaymentApproved},
+		{from: PaymentApproved, to: "partially_refunded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			err := CheckPaymentTransition(tt.from, tt.to)
+			if tt.wantErr {
+				if !errors.Is(err, ErrIllegalTransition) {
+					t.Fatalf("err = %v, want ErrIllegalTransition", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPaymentTransitionsAreClosed(t *testing.T) {
+	// Every successor must itself be a known status
+	for from, next := range paymentTransitions {
+		for _, to := range next {
+			if _, known := paymentTransitions[to]; !known {
+				t.Errorf("%s moves to unknown status %s", from, to)
+			}
+		}
+	}
+}
@@ -4,38 +4,308 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/fitstack/fitstack-payments/internal/core/domain"
 )
 
 // PaymentGateway defines the interface for interacting with Mercado Pago.
 type PaymentGateway interface {
-	// CreatePreference creates a Checkout Pro preference.
+	// CreatePreference creates a Checkout Pro preference using the gym's settings.
 	// Returns the preference ID and init_point URLs.
-	CreatePreference(ctx context.Context, accessToken string, req domain.PaymentRequest) (*domain.PaymentResponse, error)
+	CreatePreference(ctx context.Context, accessToken string, req domain.PaymentRequest, settings domain.GymSettings) (*domain.PaymentResponse, error)
 
 	// GetPaymentInfo retrieves payment details by ID.
 	GetPaymentInfo(ctx context.Context, accessToken string, paymentID string) (*domain.PaymentInfo, error)
+
+	// RefundPayment refunds a payment. A nil amount refunds it in full.
+	RefundPayment(ctx context.Context, accessToken string, paymentID string, amount *domain.Money) (*domain.RefundInfo, error)
+
+	// CancelPayment cancels a pending or in-process payment and returns its updated details.
+	CancelPayment(ctx context.Context, accessToken string, paymentID string) (*domain.PaymentInfo, error)
+
+	// GetMerchantOrder retrieves a merchant order and the IDs of its payments.
+	GetMerchantOrder(ctx context.Context, accessToken string, orderID string) (*domain.MerchantOrder, error)
+
+	// GetChargeback retrieves a chargeback opened against one of the gym's payments.
+	GetChargeback(ctx context.Context, accessToken string, chargebackID string) (*domain.Chargeback, error)
+
+	// SearchPayments returns a page of the gym's payments in a date range.
+	SearchPayments(ctx context.Context, accessToken string, search domain.PaymentSearch) (*domain.PaymentPage, error)
+}
+
+// SubscriptionGateway defines the interface for Mercado Pago subscriptions
+// (preapproval plans, preapprovals and their authorized payments).
+type SubscriptionGateway interface {
+	// CreatePlan creates a preapproval plan members can subscribe to.
+	CreatePlan(ctx context.Context, accessToken string, req domain.SubscriptionPlanRequest, settings domain.GymSettings) (*domain.SubscriptionPlan, error)
+
+	// CreateSubscription creates a preapproval for a member.
+	CreateSubscription(ctx context.Context, accessToken string, req domain.SubscriptionRequest, settings domain.GymSettings) (*domain.SubscriptionInfo, error)
+
+	// GetSubscription retrieves a preapproval by ID.
+	GetSubscription(ctx context.Context, accessToken string, subscriptionID string) (*domain.SubscriptionInfo, error)
+
+	// UpdateSubscriptionStatus sets a preapproval to authorized, paused or cancelled.
+	UpdateSubscriptionStatus(ctx context.Context, accessToken string, subscriptionID string, status string) (*domain.SubscriptionInfo, error)
+
+	// GetSubscriptionCharge retrieves an authorized payment by ID.
+	GetSubscriptionCharge(ctx context.Context, accessToken string, chargeID string) (*domain.SubscriptionCharge, error)
 }
 
 // GymCredentialProvider retrieves gym credentials for webhook validation.
 // In production, this will call Django. For now, it's an interface.
 type GymCredentialProvider interface {
-	// GetWebhookSecret retrieves the webhook secret for a gym.
-	GetWebhookSecret(ctx context.Context, gymSlug string) (string, error)
+	// GetWebhookSecrets retrieves the current webhook secret for a gym, and
+	// the previous one while it is being rotated.
+	GetWebhookSecrets(ctx context.Context, gymSlug string) (domain.WebhookSecrets, error)
 
 	// GetAccessToken retrieves the access token for a gym (optional, for webhook processing).
 	GetAccessToken(ctx context.Context, gymSlug string) (string, error)
+
+	// GetCredentials retrieves the webhook secrets and access token of a gym
+	// in one lookup.
+	GetCredentials(ctx context.Context, gymSlug string) (domain.GymCredentials, error)
+}
+
+// CredentialInvalidator drops cached gym credentials, e.g. after the gym
+// reconnects its Mercado Pago account. Caches are per process: other
+// replicas keep serving what they cached until it expires.
+type CredentialInvalidator interface {
+	// InvalidateGym drops every cached credential of a gym.
+	InvalidateGym(gymSlug string)
+}
+
+// OAuthGateway runs the Mercado Pago OAuth authorization-code flow on
+// behalf of the platform application.
+type OAuthGateway interface {
+	// Configured reports whether the application credentials are set.
+	Configured() bool
+
+	// AuthorizationURL returns the URL a gym admin is sent to to grant access.
+	AuthorizationURL(state string) string
+
+	// ExchangeCode trades an authorization code for the gym's tokens.
+	ExchangeCode(ctx context.Context, code string) (*domain.OAuthToken, error)
+
+	// RefreshToken renews a gym's tokens before they expire.
+	RefreshToken(ctx context.Context, refreshToken string) (*domain.OAuthToken, error)
+}
+
+// OAuthTokenRepository persists the tokens gyms granted through OAuth.
+type OAuthTokenRepository interface {
+	// SaveToken inserts or replaces a gym's token.
+	SaveToken(ctx context.Context, token domain.OAuthToken) error
+
+	// GetToken returns a gym's token.
+	// Returns domain.ErrOAuthTokenNotFound if the gym never connected.
+	GetToken(ctx context.Context, gymSlug string) (*domain.OAuthToken, error)
+
+	// ClaimExpiring returns up to limit tokens expiring before the given
+	// time, hiding them from other refreshers for the lease duration.
+	ClaimExpiring(ctx context.Context, before time.Time, limit int, lease time.Duration) ([]domain.OAuthToken, error)
+}
+
+// GymSettingsProvider retrieves per-gym checkout settings.
+type GymSettingsProvider interface {
+	// GetGymSettings retrieves the settings a gym overrides.
+	// Returns domain.ErrGymNotFound if the gym does not exist.
+	GetGymSettings(ctx context.Context, gymSlug string) (*domain.GymSettings, error)
+}
+
+// TenantTokenSigner signs and verifies the tenant token embedded in
+// webhook notification URLs.
+type TenantTokenSigner interface {
+	// Sign returns the token for a gym, or "" when tokens are disabled.
+	Sign(gymSlug string) string
+
+	// Verify reports whether token was signed for gymSlug.
+	Verify(gymSlug, token string) bool
+}
+
+// NonceStore remembers the nonces of signed requests to reject replays.
+type NonceStore interface {
+	// UseNonce records a nonce until expiresAt.
+	// Returns false if it was already used.
+	UseNonce(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
 }
 
 // DjangoNotifier sends payment confirmations to Django backend.
 type DjangoNotifier interface {
 	// NotifyPaymentConfirmed sends payment confirmation to Django.
 	NotifyPaymentConfirmed(ctx context.Context, payload domain.DjangoWebhookPayload) error
+
+	// NotifySubscriptionEvent sends a subscription lifecycle event to Django.
+	NotifySubscriptionEvent(ctx context.Context, payload domain.DjangoSubscriptionPayload) error
 }
 
 // WebhookValidator validates Mercado Pago webhook signatures.
 type WebhookValidator interface {
-	// ValidateSignature validates the x-signature header from Mercado Pago.
-	ValidateSignature(xSignature, xRequestID, dataID, secret string) bool
+	// ValidateSignature validates the x-signature header from Mercado Pago
+	// against each of secrets. Returns the index of the one that matched.
+	ValidateSignature(xSignature, xRequestID, dataID string, secrets []string) (int, bool)
+}
+
+// PaymentRepository persists the payment ledger.
+// Entries are keyed by gym slug and external reference.
+type PaymentRepository interface {
+	// SavePreference records a created Checkout Pro preference.
+	SavePreference(ctx context.Context, record domain.PreferenceRecord) error
+
+	// SavePaymentSnapshot records a PaymentInfo fetched from Mercado Pago.
+	SavePaymentSnapshot(ctx context.Context, snapshot domain.PaymentSnapshot) error
+
+	// LockPayment serializes the transactions recording a payment: the
+	// caller holds it until its transaction ends. Take it before reading
+	// the payment's latest snapshot to decide what to record.
+	LockPayment(ctx context.Context, gymSlug, paymentID string) error
+
+	// GetLatestSnapshot returns the most recent snapshot of a payment.
+	// Returns domain.ErrPaymentNotFound if the payment was never recorded.
+	GetLatestSnapshot(ctx context.Context, gymSlug, paymentID string) (*domain.PaymentSnapshot, error)
+
+	// GetLatestSnapshotByReference returns the most recent snapshot of any
+	// payment made for an external reference.
+	// Returns domain.ErrPaymentNotFound if none was recorded.
+	GetLatestSnapshotByReference(ctx context.Context, gymSlug, externalReference string) (*domain.PaymentSnapshot, error)
+
+	// RecordStatusChange records a payment status transition, applied or rejected.
+	RecordStatusChange(ctx context.Context, change domain.StatusChange) error
+
+	// LockChargeback serializes the transactions recording a chargeback
+	// until the caller's transaction ends.
+	LockChargeback(ctx context.Context, gymSlug, chargebackID string) error
+
+	// SaveChargeback inserts or updates a chargeback.
+	SaveChargeback(ctx context.Context, chargeback domain.Chargeback) error
+
+	// GetChargeback returns a recorded chargeback.
+	// Returns domain.ErrChargebackNotFound if it was never recorded.
+	GetChargeback(ctx context.Context, gymSlug, chargebackID string) (*domain.Chargeback, error)
+
+	// GetHistory returns all ledger entries for an external reference.
+	GetHistory(ctx context.Context, gymSlug, externalReference string) (*domain.PaymentHistory, error)
+}
+
+// SubscriptionRepository persists the last known state of each subscription.
+type SubscriptionRepository interface {
+	// LockSubscription serializes the transactions recording a subscription
+	// until the caller's transaction ends.
+	LockSubscription(ctx context.Context, gymSlug, subscriptionID string) error
+
+	// SaveSubscription inserts or updates a subscription record.
+	SaveSubscription(ctx context.Context, record domain.SubscriptionRecord) error
+
+	// GetSubscription returns a subscription record.
+	// Returns domain.ErrSubscriptionNotFound if it was never recorded.
+	GetSubscription(ctx context.Context, gymSlug, subscriptionID string) (*domain.SubscriptionRecord, error)
+
+	// LockCharge serializes the transactions recording a subscription
+	// charge until the caller's transaction ends.
+	LockCharge(ctx context.Context, gymSlug, chargeID string) error
+
+	// SaveCharge inserts or updates the last seen state of a subscription charge.
+	SaveCharge(ctx context.Context, gymSlug string, charge domain.SubscriptionCharge) error
+
+	// GetCharge returns the last seen state of a subscription charge.
+	// Returns domain.ErrChargeNotFound if it was never recorded.
+	GetCharge(ctx context.Context, gymSlug, chargeID string) (*domain.SubscriptionCharge, error)
+}
+
+// IdempotencyRepository stores checkout idempotency keys.
+type IdempotencyRepository interface {
+	// ReserveKey claims the record's key for a new request.
+	// If the key is already taken, the existing record is returned and reserved is false.
+	ReserveKey(ctx context.Context, record domain.IdempotencyRecord) (existing *domain.IdempotencyRecord, reserved bool, err error)
+
+	// CompleteKey stores the response for a reserved key.
+	CompleteKey(ctx context.Context, key string, response domain.PaymentResponse) error
+
+	// ReleaseKey drops a reserved key so the request can be retried.
+	ReleaseKey(ctx context.Context, key string) error
+}
+
+// WebhookEventRepository deduplicates Mercado Pago notifications.
+type WebhookEventRepository interface {
+	// ClaimEvent marks an event as being processed.
+	// Returns false if the event was already processed or is in progress.
+	ClaimEvent(ctx context.Context, gymSlug, eventKey string) (bool, error)
+
+	// CompleteEvent marks a claimed event as processed.
+	CompleteEvent(ctx context.Context, gymSlug, eventKey string) error
+
+	// ReleaseEvent drops a claim so a redelivery can be processed.
+	ReleaseEvent(ctx context.Context, gymSlug, eventKey string) error
+}
+
+// Transactor runs a function within a single storage transaction.
+// Repository calls made with the ctx passed to fn join the transaction.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// OutboxRepository persists Django notifications until they are delivered.
+type OutboxRepository interface {
+	// Enqueue stores a new pending message.
+	Enqueue(ctx context.Context, message domain.OutboxMessage) error
+
+	// ClaimDue returns up to limit pending messages whose next attempt is due,
+	// hiding them from other dispatchers for the lease duration.
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxMessage, error)
+
+	// MarkDelivered records a successful delivery attempt.
+	MarkDelivered(ctx context.Context, id int64) error
+
+	// MarkRetry records a failed attempt and schedules the next one.
+	// httpStatus is the status Django answered with, or 0 if it was not reached.
+	MarkRetry(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string, httpStatus int) error
+
+	// MarkDead records a failed attempt and moves the message to the dead-letter state.
+	MarkDead(ctx context.Context, id int64, lastError string, httpStatus int) error
+
+	// List returns messages matching the filter, newest first.
+	List(ctx context.Context, filter domain.DeliveryFilter) ([]domain.OutboxMessage, error)
+
+	// Requeue resets a dead message, or a retrying one whose next attempt is
+	// due, to pending with a fresh attempt budget, due immediately.
+	// Returns domain.ErrDeliveryNotFound if the message does not exist,
+	// domain.ErrDeliveryPending if it is pending otherwise (being delivered
+	// or waiting for its next attempt) and false if it was already delivered.
+	Requeue(ctx context.Context, id int64) (bool, error)
+
+	// LatestPaymentDelivery returns the newest message queued for a payment.
+	// Returns domain.ErrDeliveryNotFound if Django was never notified of it.
+	LatestPaymentDelivery(ctx context.Context, gymSlug, paymentID string) (*domain.OutboxMessage, error)
+}
+
+// ReconciliationRepository schedules reconciliation runs and keeps their reports.
+type ReconciliationRepository interface {
+	// ClaimDueGyms returns up to limit gyms due for reconciliation, among
+	// those with preferences or payments in the ledger, and schedules their
+	// next run after interval so other instances skip them.
+	ClaimDueGyms(ctx context.Context, limit int, interval time.Duration) ([]string, error)
+
+	// SaveReport stores a report and sets its ID.
+	SaveReport(ctx context.Context, report *domain.ReconciliationReport) error
+
+	// ListReports returns reports matching the filter, newest first.
+	ListReports(ctx context.Context, filter domain.ReconciliationFilter) ([]domain.ReconciliationReport, error)
+
+	// GetReport returns a report.
+	// Returns domain.ErrReportNotFound if it does not exist.
+	GetReport(ctx context.Context, id int64) (*domain.ReconciliationReport, error)
+}
+
+// PaymentEventBus delivers payment status events to live subscribers, such
+// as checkout pages waiting for confirmation. Delivery is best effort: a
+// subscriber that falls behind misses events. The in-process hub only
+// reaches subscribers of the same instance; a shared broker can implement
+// it when the service runs on several.
+type PaymentEventBus interface {
+	// Publish sends an event to the subscribers of its gym and external reference.
+	Publish(ctx context.Context, event domain.PaymentStatusEvent) error
+
+	// Subscribe returns the events of an external reference until
+	// unsubscribe is called or ctx ends; the channel is closed then.
+	Subscribe(ctx context.Context, gymSlug, externalReference string) (events <-chan domain.PaymentStatusEvent, unsubscribe func(), err error)
 }
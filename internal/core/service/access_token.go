@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// AccessTokenResolver picks the Mercado Pago access token for an API call.
+//
+// The token is looked up server-side through the credential provider, so it
+// never travels in request bodies. The deprecated in-body mp_access_token is
+// only honoured while allowInBody is set.
+type AccessTokenResolver struct {
+	credProvider ports.GymCredentialProvider
+	allowInBody  bool
+}
+
+// NewAccessTokenResolver creates a new access token resolver.
+func NewAccessTokenResolver(credProvider ports.GymCredentialProvider, allowInBody bool) *AccessTokenResolver {
+	return &AccessTokenResolver{
+		credProvider: credProvider,
+		allowInBody:  allowInBody,
+	}
+}
+
+// Resolve returns the access token to call Mercado Pago with for a gym.
+// inBody is the token sent in the request, if any. Errors are
+// *domain.ServiceError carrying the API error code.
+func (r *AccessTokenResolver) Resolve(ctx context.Context, gymSlug, inBody string) (string, error) {
+	if inBody != "" {
+		if !r.allowInBody {
+			return "", domain.NewServiceError(domain.ErrInvalidRequest,
+				"mp_access_token in the request body is no longer accepted", "VALIDATION_ERROR")
+		}
+		log.Printf("Deprecated: gym %s sent mp_access_token in the request body", gymSlug)
+		return inBody, nil
+	}
+
+	token, err := r.credProvider.GetAccessToken(ctx, gymSlug)
+	if err != nil {
+		log.Printf("Failed to get access token for gym %s: %v", gymSlug, err)
+		if errors.Is(err, domain.ErrGymNotFound) {
+			return "", domain.NewServiceError(domain.ErrGymNotFound,
+				"gym not found: "+gymSlug, "GYM_NOT_FOUND")
+		}
+		return "", domain.NewServiceError(err,
+			"failed to get gym credentials", "CREDENTIALS_UNAVAILABLE")
+	}
+	if token == "" {
+		return "", domain.NewServiceError(domain.ErrInvalidRequest,
+			"gym has no Mercado Pago access token configured", "GYM_NOT_CONFIGURED")
+	}
+	return token, nil
+}
+
+// tokenError returns the response message and error code of a Resolve error.
+func tokenError(err error) (string, string) {
+	var svcErr *domain.ServiceError
+	if errors.As(err, &svcErr) && svcErr.Code != "" {
+		return svcErr.Message, svcErr.Code
+	}
+	return "failed to get gym credentials", "CREDENTIALS_UNAVAILABLE"
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// tokenCredentials is a ports.GymCredentialProvider answering every gym
+// with token or err.
+type tokenCredentials struct {
+	ports.GymCredentialProvider
+	token string
+	err   error
+}
+
+func (p tokenCredentials) GetAccessToken(context.Context, string) (string, error) {
+	return p.token, p.err
+}
+
+func TestAccessTokenResolverResolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials tokenCredentials
+		allowInBody bool
+		inBody      string
+		want        string
+		wantCode    string
+	}{
+		{name: "looked up", credentials: tokenCredentials{token: "APP_USR-gym"}, want: "APP_USR-gym"},
+		{name: "in body when allowed", credentials: tokenCredentials{token: "APP_USR-gym"}, allowInBody: true,
+			inBody: "APP_USR-body", want: "APP_USR-body"},
+		{name: "in body when not allowed", credentials: tokenCredentials{token: "APP_USR-gym"},
+			inBody: "APP_USR-body", wantCode: "VALIDATION_ERROR"},
+		{name: "unknown gym", credentials: tokenCredentials{err: domain.ErrGymNotFound}, wantCode: "GYM_NOT_FOUND"},
+		{name: "gym without a token", credentials: tokenCredentials{}, wantCode: "GYM_NOT_CONFIGURED"},
+		{name: "credentials unavailable",
+			credentials: tokenCredentials{err: domain.NewServiceError(domain.ErrDjangoUnavailable, "timeout", "HTTP_ERROR")},
+			wantCode:    "CREDENTIALS_UNAVAILABLE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewAccessTokenResolver(tt.credentials, tt.allowInBody)
+
+			got, err := r.Resolve(context.Background(), "level-gym", tt.inBody)
+			if tt.wantCode == "" {
+				if err != nil || got != tt.want {
+					t.Fatalf("Resolve() = %q, %v, want %q", got, err, tt.want)
+				}
+				return
+			}
+			var svcErr *domain.ServiceError
+			if !errors.As(err, &svcErr) {
+				t.Fatalf("Resolve() error = %v, want a service error", err)
+			}
+			if _, code := tokenError(err); code != tt.wantCode {
+				t.Errorf("error code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// importedEvent is the Django event of a backfilled payment.
+const importedEvent = "payment.imported"
+
+// BackfillService imports a gym's existing Mercado Pago payments into the
+// ledger, typically when the gym joins FitStack.
+type BackfillService struct {
+	gateway      ports.PaymentGateway
+	credProvider ports.GymCredentialProvider
+	repo         ports.PaymentRepository
+	tx           ports.Transactor
+	outbox       ports.OutboxRepository
+	pageSize     int
+}
+
+// NewBackfillService creates a new backfill service that searches payments
+// pageSize at a time.
+func NewBackfillService(
+	gateway ports.PaymentGateway,
+	credProvider ports.GymCredentialProvider,
+	repo ports.PaymentRepository,
+	tx ports.Transactor,
+	outbox ports.OutboxRepository,
+	pageSize int,
+) *BackfillService {
+	return &BackfillService{
+		gateway:      gateway,
+		credProvider: credProvider,
+		repo:         repo,
+		tx:           tx,
+		outbox:       outbox,
+		pageSize:     pageSize,
+	}
+}
+
+// Backfill pages through the gym's payments created in the requested range
+// and records those the ledger does not know yet. With Replay, each one's
+// payment.imported event is queued in the outbox in the same transaction,
+// for the server's dispatcher to deliver. The result counts what was done
+// before an error stopped the run.
+func (s *BackfillService) Backfill(ctx context.Context, req domain.BackfillRequest) (*domain.BackfillResult, error) {
+	result := &domain.BackfillResult{}
+
+	if req.GymSlug == "" {
+		return result, domain.NewServiceError(domain.ErrInvalidRequest,
+			"gym_slug is required", "VALIDATION_ERROR")
+	}
+	if !req.From.Before(req.To) {
+		return result, domain.NewServiceError(domain.ErrInvalidRequest,
+			"from must be before to", "VALIDATION_ERROR")
+	}
+
+	accessToken, err := s.credProvider.GetAccessToken(ctx, req.GymSlug)
+	if err != nil {
+		return result, err
+	}
+
+	for offset := 0; ; {
+		page, err := s.gateway.SearchPayments(ctx, accessToken, domain.PaymentSearch{
+			Field:  domain.PaymentSearchCreated,
+			From:   req.From,
+			To:     req.To,
+			Offset: offset,
+			Limit:  s.pageSize,
+		})
+		if err != nil {
+			return result, err
+		}
+
+		for i := range page.Payments {
+			result.Found++
+			if err := s.importPayment(ctx, req, &page.Payments[i], result); err != nil {
+				return result, err
+			}
+		}
+
+		offset += len(page.Payments)
+		log.Printf("Backfill of gym %s: %d of %d payments processed", req.GymSlug, offset, page.Total)
+		if len(page.Payments) == 0 || offset >= page.Total {
+			return result, nil
+		}
+	}
+}
+
+// importPayment records a payment unless the ledger already has it or it
+// was not made through a FitStack checkout, queueing its replay to Django
+// when requested. The payment is locked while it is checked and recorded,
+// so a webhook recording it at the same time cannot record it twice.
+func (s *BackfillService) importPayment(ctx context.Context, req domain.BackfillRequest, info *domain.PaymentInfo, result *domain.BackfillResult) error {
+	// Payments without an external reference are none of Django's business
+	if info.ExternalReference == "" {
+		result.Skipped++
+		return nil
+	}
+
+	imported := false
+	now := time.Now()
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.LockPayment(ctx, req.GymSlug, info.PaymentID); err != nil {
+			return err
+		}
+		_, err := s.repo.GetLatestSnapshot(ctx, req.GymSlug, info.PaymentID)
+		switch {
+		case err == nil:
+			return nil
+		case !errors.Is(err, domain.ErrPaymentNotFound):
+			return err
+		}
+
+		imported = true
+		if req.DryRun {
+			log.Printf("Backfill (dry run): would import payment %s (%s, %s %s, reference %q)",
+				info.PaymentID, info.Status, info.Amount, info.Currency, info.ExternalReference)
+			return nil
+		}
+
+		if err := s.repo.SavePaymentSnapshot(ctx, domain.PaymentSnapshot{
+			GymSlug:   req.GymSlug,
+			Payment:   *info,
+			FetchedAt: now,
+		}); err != nil {
+			return err
+		}
+		if err := s.repo.RecordStatusChange(ctx, domain.StatusChange{
+			GymSlug:           req.GymSlug,
+			ExternalReference: info.ExternalReference,
+			PaymentID:         info.PaymentID,
+			ToStatus:          info.Status,
+			ChangedAt:         now,
+		}); err != nil {
+			return err
+		}
+		if !req.Replay {
+			return nil
+		}
+
+		payload := domain.DjangoWebhookPayload{
+			Event:             importedEvent,
+			GymSlug:           req.GymSlug,
+			ExternalReference: info.ExternalReference,
+			PaymentID:         info.PaymentID,
+			PaymentStatus:     info.Status,
+			PaymentType:       info.PaymentType,
+			Amount:            info.Amount,
+			Currency:          info.Currency,
+			PayerEmail:        info.PayerEmail,
+			Timestamp:         now.Format(time.RFC3339),
+		}
+		return s.outbox.Enqueue(ctx, domain.OutboxMessage{GymSlug: req.GymSlug, Kind: domain.OutboxKindPayment, Payload: &payload})
+	})
+	if err != nil {
+		return err
+	}
+
+	if !imported {
+		result.AlreadyRecorded++
+		return nil
+	}
+	result.Imported++
+	if req.Replay {
+		result.Replayed++
+	}
+	return nil
+}
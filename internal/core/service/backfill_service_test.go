@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// backfillPayments are a gym's payments in Mercado Pago: 1 and 3 to 5 came
+// from FitStack checkouts, 2 did not.
+func backfillPayments() []domain.PaymentInfo {
+	payment := func(id, reference string) domain.PaymentInfo {
+		return domain.PaymentInfo{PaymentID: id, Status: domain.PaymentApproved, ExternalReference: reference,
+			Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+	}
+	return []domain.PaymentInfo{
+		payment("1", "ref-1"),
+		payment("2", ""),
+		payment("3", "ref-3"),
+		payment("4", "ref-4"),
+		payment("5", "ref-5"),
+	}
+}
+
+func TestBackfillServiceBackfill(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name       string
+		req        domain.BackfillRequest
+		want       domain.BackfillResult
+		wantLedger int
+		wantQueued int
+	}{
+		{
+			name:       "import",
+			req:        domain.BackfillRequest{GymSlug: "level-gym", From: from, To: to},
+			want:       domain.BackfillResult{Found: 5, Imported: 3, AlreadyRecorded: 1, Skipped: 1},
+			wantLedger: 4,
+		},
+		{
+			name:       "import and replay",
+			req:        domain.BackfillRequest{GymSlug: "level-gym", From: from, To: to, Replay: true},
+			want:       domain.BackfillResult{Found: 5, Imported: 3, AlreadyRecorded: 1, Skipped: 1, Replayed: 3},
+			wantLedger: 4,
+			wantQueued: 3,
+		},
+		{
+			name:       "dry run",
+			req:        domain.BackfillRequest{GymSlug: "level-gym", From: from, To: to, Replay: true, DryRun: true},
+			want:       domain.BackfillResult{Found: 5, Imported: 3, AlreadyRecorded: 1, Skipped: 1, Replayed: 3},
+			wantLedger: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newMemoryLedger()
+			// Payment 4 came through a webhook before the backfill
+			ledger.snapshots["4"] = domain.PaymentSnapshot{GymSlug: "level-gym", Payment: backfillPayments()[3]}
+			outbox := &memoryOutbox{}
+			s := NewBackfillService(&fakeGateway{searched: backfillPayments()}, staticCredentials{}, ledger, &memoryTx{}, outbox, 2)
+
+			result, err := s.Backfill(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Backfill: %v", err)
+			}
+			if *result != tt.want {
+				t.Errorf("result = %+v, want %+v", *result, tt.want)
+			}
+			if len(ledger.snapshots) != tt.wantLedger {
+				t.Errorf("ledger has %d payments, want %d", len(ledger.snapshots), tt.wantLedger)
+			}
+			if len(outbox.messages) != tt.wantQueued {
+				t.Fatalf("queued %d messages, want %d", len(outbox.messages), tt.wantQueued)
+			}
+			for _, m := range outbox.messages {
+				if m.Payload.Event != importedEvent || m.Payload.ExternalReference == "" {
+					t.Errorf("queued %+v, want a payment.imported event with its reference", m.Payload)
+				}
+			}
+		})
+	}
+}
+
+func TestBackfillServicePaging(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	req := domain.BackfillRequest{GymSlug: "level-gym", From: from, To: from.AddDate(0, 1, 0)}
+
+	tests := []struct {
+		name     string
+		payments int
+		pageSize int
+		want     int
+	}{
+		{name: "no payments", payments: 0, pageSize: 2, want: 1},
+		{name: "one page", payments: 2, pageSize: 5, want: 1},
+		{name: "last page full", payments: 4, pageSize: 2, want: 2},
+		{name: "last page partial", payments: 5, pageSize: 2, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &fakeGateway{searched: backfillPayments()[:tt.payments]}
+			s := NewBackfillService(gateway, staticCredentials{}, newMemoryLedger(), &memoryTx{}, &memoryOutbox{}, tt.pageSize)
+
+			result, err := s.Backfill(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Backfill: %v", err)
+			}
+			if gateway.searches != tt.want {
+				t.Errorf("searched %d pages, want %d", gateway.searches, tt.want)
+			}
+			if result.Found != tt.payments {
+				t.Errorf("found %d payments, want %d", result.Found, tt.payments)
+			}
+		})
+	}
+}
+
+func TestBackfillServiceStops(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	errSearch := errors.New("search failed")
+
+	tests := []struct {
+		name    string
+		req     domain.BackfillRequest
+		wantErr error
+		want    domain.BackfillResult
+	}{
+		{name: "no gym", req: domain.BackfillRequest{From: from, To: to}, wantErr: domain.ErrInvalidRequest},
+		{name: "empty range", req: domain.BackfillRequest{GymSlug: "level-gym", From: to, To: to},
+			wantErr: domain.ErrInvalidRequest},
+		{name: "search fails on the second page", req: domain.BackfillRequest{GymSlug: "level-gym", From: from, To: to},
+			wantErr: errSearch, want: domain.BackfillResult{Found: 2, Imported: 1, Skipped: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &fakeGateway{searched: backfillPayments()}
+			gateway.beforeSearch = func(search int) {
+				if search == 1 {
+					gateway.searchErr = errSearch
+				}
+			}
+			s := NewBackfillService(gateway, staticCredentials{}, newMemoryLedger(), &memoryTx{}, &memoryOutbox{}, 2)
+
+			result, err := s.Backfill(context.Background(), tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Backfill() error = %v, want %v", err, tt.wantErr)
+			}
+			// What was done before the error is still counted
+			if *result != tt.want {
+				t.Errorf("result = %+v, want %+v", *result, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// DeliveryService lets support inspect and redeliver Django callbacks.
+type DeliveryService struct {
+	outbox ports.OutboxRepository
+}
+
+// NewDeliveryService creates a new delivery service.
+func NewDeliveryService(outbox ports.OutboxRepository) *DeliveryService {
+	return &DeliveryService{outbox: outbox}
+}
+
+// ListDeliveries returns outbox messages matching the filter.
+// An empty status lists failed deliveries (dead or retrying).
+func (s *DeliveryService) ListDeliveries(ctx context.Context, filter domain.DeliveryFilter) ([]domain.OutboxMessage, error) {
+	switch filter.Status {
+	case "", domain.DeliveryFailed, domain.DeliveryRetrying,
+		domain.OutboxPending, domain.OutboxDelivered, domain.OutboxDead:
+	default:
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest,
+			"unknown status: "+filter.Status, "VALIDATION_ERROR")
+	}
+
+	return s.outbox.List(ctx, filter)
+}
+
+// Redeliver requeues the given deliveries with a fresh attempt budget.
+// The outbox dispatcher picks them up on its next poll. Deliveries still
+// pending are left to the dispatcher.
+func (s *DeliveryService) Redeliver(ctx context.Context, ids []int64) (*domain.RedeliveryResult, error) {
+	result := &domain.RedeliveryResult{
+		Requeued:         []int64{},
+		AlreadyDelivered: []int64{},
+		Pending:          []int64{},
+		NotFound:         []int64{},
+	}
+
+	for _, id := range ids {
+		requeued, err := s.outbox.Requeue(ctx, id)
+		switch {
+		case errors.Is(err, domain.ErrDeliveryNotFound):
+			result.NotFound = append(result.NotFound, id)
+		case errors.Is(err, domain.ErrDeliveryPending):
+			result.Pending = append(result.Pending, id)
+		case err != nil:
+			return nil, err
+		case requeued:
+			result.Requeued = append(result.Requeued, id)
+		default:
+			result.AlreadyDelivered = append(result.AlreadyDelivered, id)
+		}
+	}
+
+	log.Printf("Redelivery requested for %d deliveries: %d requeued, %d already delivered, %d pending, %d not found",
+		len(ids), len(result.Requeued), len(result.AlreadyDelivered), len(result.Pending), len(result.NotFound))
+
+	return result, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// GymSettingsResolver resolves a gym's checkout settings, filling whatever
+// the gym does not override with the service-wide defaults, and signs the
+// tenant token of its notification URL.
+//
+// Settings are cached for ttl. A gym Django does not know, or a Django that
+// cannot be reached, gets the defaults alone so checkouts keep working; only
+// the former is cached, so settings come back as soon as Django does.
+type GymSettingsResolver struct {
+	provider     ports.GymSettingsProvider
+	defaults     domain.GymDefaults
+	tokens       ports.TenantTokenSigner
+	requireToken bool
+	ttl          time.Duration
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSettings
+}
+
+// cachedSettings are a gym's settings as Django returned them.
+type cachedSettings struct {
+	settings domain.GymSettings
+	expires  time.Time
+}
+
+// NewGymSettingsResolver creates a new gym settings resolver.
+// With requireToken set, webhooks without a tenant token are rejected.
+// A zero ttl disables caching.
+func NewGymSettingsResolver(
+	provider ports.GymSettingsProvider,
+	defaults domain.GymDefaults,
+	tokens ports.TenantTokenSigner,
+	requireToken bool,
+	ttl time.Duration,
+) *GymSettingsResolver {
+	return &GymSettingsResolver{
+		provider:     provider,
+		defaults:     defaults,
+		tokens:       tokens,
+		requireToken: requireToken,
+		ttl:          ttl,
+		now:          time.Now,
+		cache:        make(map[string]cachedSettings),
+	}
+}
+
+// Resolve returns the effective settings of a gym.
+func (r *GymSettingsResolver) Resolve(ctx context.Context, gymSlug string) (domain.GymSettings, error) {
+	settings, err := r.lookup(ctx, gymSlug)
+	if err != nil {
+		return domain.GymSettings{}, err
+	}
+	settings.GymSlug = gymSlug
+	settings.NotificationToken = r.tokens.Sign(gymSlug)
+	return settings.WithDefaults(r.defaults), nil
+}
+
+// lookup returns the gym's own settings, from cache when fresh, or none
+// when Django does not know the gym or cannot be reached.
+func (r *GymSettingsResolver) lookup(ctx context.Context, gymSlug string) (domain.GymSettings, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[gymSlug]
+	r.mu.Unlock()
+	if ok && r.now().Before(cached.expires) {
+		return cached.settings, nil
+	}
+
+	var settings domain.GymSettings
+	found, err := r.provider.GetGymSettings(ctx, gymSlug)
+	switch {
+	case err == nil:
+		settings = *found
+	case errors.Is(err, domain.ErrGymNotFound):
+		log.Printf("Gym settings: gym %s not found in Django, using defaults", gymSlug)
+	case errors.Is(err, domain.ErrDjangoUnavailable):
+		log.Printf("Gym settings: failed to fetch settings of gym %s, using defaults: %v", gymSlug, err)
+		return domain.GymSettings{}, nil
+	default:
+		return domain.GymSettings{}, err
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[gymSlug] = cachedSettings{settings: settings, expires: r.now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return settings, nil
+}
+
+// VerifyNotificationToken checks the tenant token a webhook arrived with.
+// A missing token is accepted unless tokens are required, so preferences
+// created before tokens were enabled keep notifying.
+func (r *GymSettingsResolver) VerifyNotificationToken(gymSlug, token string) bool {
+	if token == "" {
+		return !r.requireToken
+	}
+	return r.tokens.Verify(gymSlug, token)
+}
+
+// settingsErrorCode maps a settings lookup failure to an API error code.
+func settingsErrorCode(err error) string {
+	if errors.Is(err, domain.ErrGymNotFound) {
+		return "GYM_NOT_FOUND"
+	}
+	return "SETTINGS_UNAVAILABLE"
+}
+
+// validateCurrency checks a requested currency against the gym's.
+// Returns an error message, or "" when valid.
+func validateCurrency(requested string, settings domain.GymSettings) string {
+	if requested != "" && requested != settings.Currency {
+		return fmt.Sprintf("currency %s does not match gym currency %s", requested, settings.Currency)
+	}
+	return ""
+}
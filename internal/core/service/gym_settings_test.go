@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// countingSettings is a ports.GymSettingsProvider answering with settings or
+// err and counting its calls.
+type countingSettings struct {
+	settings *domain.GymSettings
+	err      error
+	calls    int
+}
+
+func (p *countingSettings) GetGymSettings(context.Context, string) (*domain.GymSettings, error) {
+	p.calls++
+	return p.settings, p.err
+}
+
+// prefixSigner is a ports.TenantTokenSigner signing a gym as "token-<slug>".
+type prefixSigner struct{}
+
+func (prefixSigner) Sign(gymSlug string) string { return "token-" + gymSlug }
+
+func (prefixSigner) Verify(gymSlug, token string) bool { return token == "token-"+gymSlug }
+
+var testGymDefaults = domain.GymDefaults{
+	SiteID:              "MLA",
+	FrontendURL:         "https://app.example.com",
+	NotificationBaseURL: "https://payments.example.com",
+}
+
+func TestGymSettingsResolverResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings *domain.GymSettings
+		err      error
+		wantErr  error
+		wantSite string
+	}{
+		{
+			name:     "gym settings",
+			settings: &domain.GymSettings{SiteID: "MLU"},
+			wantSite: "MLU",
+		},
+		{
+			name:     "unknown gym falls back to defaults",
+			err:      domain.ErrGymNotFound,
+			wantSite: "MLA",
+		},
+		{
+			name:     "unreachable Django falls back to defaults",
+			err:      domain.NewServiceError(domain.ErrDjangoUnavailable, "request failed", "HTTP_ERROR"),
+			wantSite: "MLA",
+		},
+		{
+			name:    "cancelled lookup fails",
+			err:     context.Canceled,
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &countingSettings{settings: tt.settings, err: tt.err}
+			r := NewGymSettingsResolver(provider, testGymDefaults, prefixSigner{}, false, time.Minute)
+
+			got, err := r.Resolve(context.Background(), "level-gym")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.SiteID != tt.wantSite || got.Currency == "" {
+				t.Errorf("site %q currency %q, want site %q with its currency", got.SiteID, got.Currency, tt.wantSite)
+			}
+			if got.GymSlug != "level-gym" || got.NotificationToken != "token-level-gym" {
+				t.Errorf("gym %q token %q, want level-gym with its token", got.GymSlug, got.NotificationToken)
+			}
+			if got.SuccessURL == "" || got.NotificationBaseURL != testGymDefaults.NotificationBaseURL {
+				t.Errorf("defaults not applied: %+v", got)
+			}
+		})
+	}
+}
+
+func TestGymSettingsResolverCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  *domain.GymSettings
+		err       error
+		wantCalls int
+	}{
+		{name: "settings are cached", settings: &domain.GymSettings{SiteID: "MLU"}, wantCalls: 1},
+		{name: "unknown gym is cached", err: domain.ErrGymNotFound, wantCalls: 1},
+		{
+			name:      "unreachable Django is retried",
+			err:       domain.NewServiceError(domain.ErrDjangoUnavailable, "request failed", "HTTP_ERROR"),
+			wantCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &countingSettings{settings: tt.settings, err: tt.err}
+			r := NewGymSettingsResolver(provider, testGymDefaults, prefixSigner{}, false, time.Minute)
+			now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			r.now = func() time.Time { return now }
+
+			for range 2 {
+				if _, err := r.Resolve(context.Background(), "level-gym"); err != nil {
+					t.Fatalf("Resolve() error = %v", err)
+				}
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", provider.calls, tt.wantCalls)
+			}
+
+			now = now.Add(time.Minute)
+			if _, err := r.Resolve(context.Background(), "level-gym"); err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if provider.calls != tt.wantCalls+1 {
+				t.Errorf("expired entry: provider called %d times, want %d", provider.calls, tt.wantCalls+1)
+			}
+		})
+	}
+}
+
+func TestGymSettingsResolverVerifyNotificationToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		requireToken bool
+		token        string
+		want         bool
+	}{
+		{name: "own token", token: "token-level-gym", want: true},
+		{name: "another gym's token", token: "token-other-gym"},
+		{name: "missing token", want: true},
+		{name: "own token when required", requireToken: true, token: "token-level-gym", want: true},
+		{name: "missing token when required", requireToken: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewGymSettingsResolver(&countingSettings{}, testGymDefaults, prefixSigner{}, tt.requireToken, time.Minute)
+			if got := r.VerifyNotificationToken("level-gym", tt.token); got != tt.want {
+				t.Errorf("VerifyNotificationToken(%q) = %t, want %t", tt.token, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// OAuthCredentialProvider implements ports.GymCredentialProvider by serving
+// the tokens gyms granted through OAuth, and falling back to another
+// provider (Django) for gyms that still configure credentials by hand.
+type OAuthCredentialProvider struct {
+	tokens         ports.OAuthTokenRepository
+	fallback       ports.GymCredentialProvider
+	webhookSecrets domain.WebhookSecrets
+	now            func() time.Time
+}
+
+// NewOAuthCredentialProvider creates a new OAuth-aware credential provider.
+// webhookSecrets are the platform application's webhook secrets, which sign
+// the notifications of OAuth-connected gyms; empty keeps using fallback's.
+func NewOAuthCredentialProvider(
+	tokens ports.OAuthTokenRepository,
+	fallback ports.GymCredentialProvider,
+	webhookSecrets domain.WebhookSecrets,
+) *OAuthCredentialProvider {
+	return &OAuthCredentialProvider{
+		tokens:         tokens,
+		fallback:       fallback,
+		webhookSecrets: webhookSecrets,
+		now:            time.Now,
+	}
+}
+
+// GetWebhookSecrets returns the platform secrets for OAuth-connected gyms
+// and the fallback's secrets otherwise.
+func (p *OAuthCredentialProvider) GetWebhookSecrets(ctx context.Context, gymSlug string) (domain.WebhookSecrets, error) {
+	if p.webhookSecrets.Current != "" {
+		if _, err := p.tokens.GetToken(ctx, gymSlug); err == nil {
+			return p.webhookSecrets, nil
+		}
+	}
+	return p.fallback.GetWebhookSecrets(ctx, gymSlug)
+}
+
+// GetAccessToken returns the gym's OAuth access token. Gyms that never
+// connected, or whose token expired without being refreshed, fall back.
+func (p *OAuthCredentialProvider) GetAccessToken(ctx context.Context, gymSlug string) (string, error) {
+	token, err := p.tokens.GetToken(ctx, gymSlug)
+	switch {
+	case errors.Is(err, domain.ErrOAuthTokenNotFound):
+		return p.fallback.GetAccessToken(ctx, gymSlug)
+	case err != nil:
+		return "", err
+	case token.Expired(p.now()):
+		log.Printf("OAuth token of gym %s expired at %s, falling back to configured credentials",
+			gymSlug, token.ExpiresAt.Format(time.RFC3339))
+		return p.fallback.GetAccessToken(ctx, gymSlug)
+	}
+	return token.AccessToken, nil
+}
+
+// GetCredentials returns both credentials as GetWebhookSecrets and
+// GetAccessToken would, asking the fallback only for what OAuth does not
+// provide.
+func (p *OAuthCredentialProvider) GetCredentials(ctx context.Context, gymSlug string) (domain.GymCredentials, error) {
+	token, err := p.tokens.GetToken(ctx, gymSlug)
+	connected := err == nil
+	if err != nil && !errors.Is(err, domain.ErrOAuthTokenNotFound) {
+		return domain.GymCredentials{}, err
+	}
+	platformSecrets := connected && p.webhookSecrets.Current != ""
+	if connected && token.Expired(p.now()) {
+		log.Printf("OAuth token of gym %s expired at %s, falling back to configured credentials",
+			gymSlug, token.ExpiresAt.Format(time.RFC3339))
+		connected = false
+	}
+
+	if connected && platformSecrets {
+		return domain.GymCredentials{
+			GymSlug:        gymSlug,
+			WebhookSecrets: p.webhookSecrets,
+			AccessToken:    token.AccessToken,
+		}, nil
+	}
+
+	creds, err := p.fallback.GetCredentials(ctx, gymSlug)
+	if err != nil {
+		return domain.GymCredentials{}, err
+	}
+	if connected {
+		creds.AccessToken = token.AccessToken
+	}
+	if platformSecrets {
+		creds.WebhookSecrets = p.webhookSecrets
+	}
+	return creds, nil
+}
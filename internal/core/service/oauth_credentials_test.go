@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// unknownGymCredentials is a ports.GymCredentialProvider knowing no gym.
+type unknownGymCredentials struct {
+	ports.GymCredentialProvider
+}
+
+func (unknownGymCredentials) GetCredentials(context.Context, string) (domain.GymCredentials, error) {
+	return domain.GymCredentials{}, domain.ErrGymNotFound
+}
+
+func TestOAuthCredentialProviderGetCredentials(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	platform := domain.WebhookSecrets{Current: "platform-secret"}
+	connected := domain.OAuthToken{GymSlug: "level-gym", AccessToken: "APP_USR-oauth", ExpiresAt: now.Add(time.Hour)}
+	expired := domain.OAuthToken{GymSlug: "level-gym", AccessToken: "APP_USR-oauth", ExpiresAt: now.Add(-time.Hour)}
+
+	tests := []struct {
+		name       string
+		token      *domain.OAuthToken
+		platform   domain.WebhookSecrets
+		fallback   ports.GymCredentialProvider
+		wantToken  string
+		wantSecret string
+	}{
+		{name: "never connected", platform: platform, fallback: staticCredentials{},
+			wantToken: "APP_USR-123", wantSecret: "secret"},
+		{name: "connected without asking the fallback", token: &connected, platform: platform,
+			fallback: unknownGymCredentials{}, wantToken: "APP_USR-oauth", wantSecret: "platform-secret"},
+		{name: "connected without platform secrets", token: &connected, fallback: staticCredentials{},
+			wantToken: "APP_USR-oauth", wantSecret: "secret"},
+		{name: "expired token", token: &expired, platform: platform, fallback: staticCredentials{},
+			wantToken: "APP_USR-123", wantSecret: "platform-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := memoryOAuthTokens{}
+			if tt.token != nil {
+				tokens[tt.token.GymSlug] = *tt.token
+			}
+			p := NewOAuthCredentialProvider(tokens, tt.fallback, tt.platform)
+			p.now = func() time.Time { return now }
+
+			got, err := p.GetCredentials(context.Background(), "level-gym")
+			if err != nil {
+				t.Fatalf("GetCredentials() error = %v", err)
+			}
+			if got.AccessToken != tt.wantToken || got.WebhookSecrets.Current != tt.wantSecret {
+				t.Errorf("GetCredentials() = token %q secret %q, want %q %q",
+					got.AccessToken, got.WebhookSecrets.Current, tt.wantToken, tt.wantSecret)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// OAuthRefresher renews gyms' OAuth tokens in the background before they expire.
+type OAuthRefresher struct {
+	service   *OAuthService
+	interval  time.Duration
+	window    time.Duration
+	batchSize int
+}
+
+// NewOAuthRefresher creates a new OAuth token refresher. Tokens expiring
+// within window are renewed, checking every interval.
+func NewOAuthRefresher(svc *OAuthService, interval, window time.Duration, batchSize int) *OAuthRefresher {
+	return &OAuthRefresher{
+		service:   svc,
+		interval:  interval,
+		window:    window,
+		batchSize: batchSize,
+	}
+}
+
+// Run refreshes expiring tokens until ctx is cancelled.
+func (r *OAuthRefresher) Run(ctx context.Context) {
+	log.Printf("OAuth refresher started (every %s, renewing %s before expiry)", r.interval, r.window)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.refreshDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("OAuth refresher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshDue renews expiring tokens batch by batch until none are left.
+func (r *OAuthRefresher) refreshDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		refreshed, err := r.service.RefreshExpiring(ctx, r.window, r.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("OAuth refresher: failed to claim expiring tokens: %v", err)
+			}
+			return
+		}
+		if refreshed < r.batchSize {
+			return
+		}
+	}
+}
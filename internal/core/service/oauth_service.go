@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+// OAuthService connects gyms' Mercado Pago accounts through the OAuth
+// authorization-code flow and keeps their tokens fresh.
+//
+// The state sent to MP is signed, expires after stateTTL and is single use,
+// so a callback can only store tokens for the gym the flow was started for.
+type OAuthService struct {
+	gateway     ports.OAuthGateway
+	tokens      ports.OAuthTokenRepository
+	nonces      ports.NonceStore
+	invalidator ports.CredentialInvalidator
+	stateSecret []byte
+	stateTTL    time.Duration
+	now         func() time.Time
+}
+
+// NewOAuthService creates a new OAuth onboarding service.
+func NewOAuthService(
+	gateway ports.OAuthGateway,
+	tokens ports.OAuthTokenRepository,
+	nonces ports.NonceStore,
+	invalidator ports.CredentialInvalidator,
+	stateSecret string,
+	stateTTL time.Duration,
+) *OAuthService {
+	return &OAuthService{
+		gateway:     gateway,
+		tokens:      tokens,
+		nonces:      nonces,
+		invalidator: invalidator,
+		stateSecret: []byte(stateSecret),
+		stateTTL:    stateTTL,
+		now:         time.Now,
+	}
+}
+
+// Authorize returns the URL a gym admin must visit to connect the gym's
+// Mercado Pago account.
+func (s *OAuthService) Authorize(ctx context.Context, gymSlug string) (*domain.OAuthAuthorization, error) {
+	if !s.gateway.Configured() {
+		return &domain.OAuthAuthorization{
+			Success:   false,
+			Error:     "Mercado Pago OAuth is not configured",
+			ErrorCode: "OAUTH_NOT_CONFIGURED",
+		}, nil
+	}
+	if gymSlug == "" {
+		return &domain.OAuthAuthorization{
+			Success:   false,
+			Error:     "gym_slug is required",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	expiresAt := s.now().Add(s.stateTTL).UTC().Truncate(time.Second)
+	state := s.signState(gymSlug, expiresAt, uuid.New().String())
+
+	log.Printf("OAuth: started authorization for gym %s", gymSlug)
+	return &domain.OAuthAuthorization{
+		Success:          true,
+		GymSlug:          gymSlug,
+		AuthorizationURL: s.gateway.AuthorizationURL(state),
+		ExpiresAt:        &expiresAt,
+	}, nil
+}
+
+// HandleCallback completes the flow: it checks the state, exchanges the
+// code and stores the gym's tokens. The gym slug is returned whenever the
+// state is valid, even if a later step fails, so the caller can send the
+// admin back to the right gym. Errors are *domain.ServiceError carrying the
+// API error code.
+func (s *OAuthService) HandleCallback(ctx context.Context, code, state string) (string, error) {
+	if !s.gateway.Configured() {
+		return "", domain.NewServiceError(domain.ErrInvalidRequest,
+			"Mercado Pago OAuth is not configured", "OAUTH_NOT_CONFIGURED")
+	}
+
+	gymSlug, err := s.verifyState(ctx, state)
+	if err != nil {
+		return "", err
+	}
+	if code == "" {
+		log.Printf("OAuth: gym %s did not grant access", gymSlug)
+		return gymSlug, domain.NewServiceError(domain.ErrInvalidRequest,
+			"authorization was not granted", "OAUTH_DENIED")
+	}
+
+	token, err := s.gateway.ExchangeCode(ctx, code)
+	if err != nil {
+		log.Printf("OAuth: failed to exchange code for gym %s: %v", gymSlug, err)
+		return gymSlug, domain.NewServiceError(err,
+			"failed to exchange authorization code", "OAUTH_EXCHANGE_FAILED")
+	}
+	token.GymSlug = gymSlug
+
+	if err := s.store(ctx, *token); err != nil {
+		return gymSlug, domain.NewServiceError(err,
+			"failed to store Mercado Pago credentials", "REPOSITORY_ERROR")
+	}
+	log.Printf("OAuth: connected gym %s (live mode %t, expires %s)",
+		gymSlug, token.LiveMode, token.ExpiresAt.Format(time.RFC3339))
+	return gymSlug, nil
+}
+
+// Status reports whether a gym is connected through OAuth.
+func (s *OAuthService) Status(ctx context.Context, gymSlug string) (*domain.OAuthStatus, error) {
+	if !s.gateway.Configured() {
+		return &domain.OAuthStatus{
+			Success:   false,
+			Error:     "Mercado Pago OAuth is not configured",
+			ErrorCode: "OAUTH_NOT_CONFIGURED",
+		}, nil
+	}
+
+	token, err := s.tokens.GetToken(ctx, gymSlug)
+	if errors.Is(err, domain.ErrOAuthTokenNotFound) {
+		return &domain.OAuthStatus{
+			Success:   true,
+			GymSlug:   gymSlug,
+			Connected: false,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &domain.OAuthStatus{
+		Success:   true,
+		GymSlug:   gymSlug,
+		Connected: !token.Expired(s.now()),
+		Token:     token,
+	}, nil
+}
+
+// RefreshExpiring renews up to limit tokens expiring within window.
+// Returns how many were renewed.
+func (s *OAuthService) RefreshExpiring(ctx context.Context, window time.Duration, limit int) (int, error) {
+	// Lease long enough to cover the MP calls of a whole batch
+	lease := 5 * time.Minute
+
+	tokens, err := s.tokens.ClaimExpiring(ctx, s.now().Add(window), limit, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	refreshed := 0
+	for _, t := range tokens {
+		if ctx.Err() != nil {
+			break
+		}
+		renewed, err := s.gateway.RefreshToken(ctx, t.RefreshToken)
+		if err != nil {
+			// Left leased: retried once the lease expires, until the token does
+			log.Printf("OAuth: failed to refresh token of gym %s (expires %s): %v",
+				t.GymSlug, t.ExpiresAt.Format(time.RFC3339), err)
+			continue
+		}
+		renewed.GymSlug = t.GymSlug
+		if renewed.RefreshToken == "" {
+			renewed.RefreshToken = t.RefreshToken
+		}
+		if err := s.store(ctx, *renewed); err != nil {
+			log.Printf("OAuth: refreshed token of gym %s but failed to store it: %v", t.GymSlug, err)
+			continue
+		}
+		log.Printf("OAuth: refreshed token of gym %s, now expires %s",
+			t.GymSlug, renewed.ExpiresAt.Format(time.RFC3339))
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// store saves a token and drops the gym's cached credentials.
+func (s *OAuthService) store(ctx context.Context, token domain.OAuthToken) error {
+	if err := s.tokens.SaveToken(ctx, token); err != nil {
+		return err
+	}
+	s.invalidator.InvalidateGym(token.GymSlug)
+	return nil
+}
+
+// signState encodes the gym, expiry and nonce of a flow with their HMAC:
+// base64url("<gym>\n<unix expiry>\n<nonce>") + "." + base64url(hmac).
+func (s *OAuthService) signState(gymSlug string, expiresAt time.Time, nonce string) string {
+	payload := gymSlug + "\n" + strconv.FormatInt(expiresAt.Unix(), 10) + "\n" + nonce
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + s.stateMAC(payload)
+}
+
+// verifyState checks a state's signature and expiry and consumes its nonce.
+// Returns the gym the flow was started for.
+func (s *OAuthService) verifyState(ctx context.Context, state string) (string, error) {
+	invalid := domain.NewServiceError(domain.ErrOAuthStateInvalid,
+		"invalid or expired OAuth state", "OAUTH_STATE_INVALID")
+
+	encoded, mac, ok := strings.Cut(state, ".")
+	if !ok {
+		return "", invalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", invalid
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(mac), []byte(s.stateMAC(payload))) {
+		return "", invalid
+	}
+
+	parts := strings.Split(payload, "\n")
+	if len(parts) != 3 {
+		return "", invalid
+	}
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", invalid
+	}
+	expiresAt := time.Unix(unix, 0)
+	if !s.now().Before(expiresAt) {
+		return "", invalid
+	}
+
+	fresh, err := s.nonces.UseNonce(ctx, "oauth:"+parts[2], expiresAt)
+	if err != nil {
+		return "", domain.NewServiceError(err, "failed to check OAuth state", "REPOSITORY_ERROR")
+	}
+	if !fresh {
+		log.Printf("OAuth: rejected reused state for gym %s", parts[0])
+		return "", invalid
+	}
+	return parts[0], nil
+}
+
+// stateMAC returns the base64url HMAC of a state payload.
+func (s *OAuthService) stateMAC(payload string) string {
+	mac := hmac.New(sha256.New, s.stateSecret)
+	mac.Write([]byte("oauth-state:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
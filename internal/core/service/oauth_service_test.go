@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+)
+
+// fakeOAuthGateway is a ports.OAuthGateway whose authorization URL is the state itself.
+type fakeOAuthGateway struct {
+	exchangeErr error
+}
+
+func (g *fakeOAuthGateway) Configured() bool { return true }
+
+func (g *fakeOAuthGateway) AuthorizationURL(state string) string { return state }
+
+func (g *fakeOAuthGateway) ExchangeCode(_ context.Context, code string) (*domain.OAuthToken, error) {
+	if g.exchangeErr != nil {
+		return nil, g.exchangeErr
+	}
+	return &domain.OAuthToken{AccessToken: "APP_USR-" + code, RefreshToken: "TG-" + code,
+		ExpiresAt: time.Now().Add(180 * 24 * time.Hour)}, nil
+}
+
+func (g *fakeOAuthGateway) RefreshToken(_ context.Context, refreshToken string) (*domain.OAuthToken, error) {
+	return nil, errors.New("not implemented")
+}
+
+// memoryOAuthTokens is an in-memory ports.OAuthTokenRepository.
+type memoryOAuthTokens map[string]domain.OAuthToken
+
+func (m memoryOAuthTokens) SaveToken(_ context.Context, token domain.OAuthToken) error {
+	m[token.GymSlug] = token
+	return nil
+}
+
+func (m memoryOAuthTokens) GetToken(_ context.Context, gymSlug string) (*domain.OAuthToken, error) {
+	token, ok := m[gymSlug]
+	if !ok {
+		return nil, domain.ErrOAuthTokenNotFound
+	}
+	return &token, nil
+}
+
+func (m memoryOAuthTokens) ClaimExpiring(context.Context, time.Time, int, time.Duration) ([]domain.OAuthToken, error) {
+	return nil, nil
+}
+
+// memoryNonces is an in-memory ports.NonceStore.
+type memoryNonces map[string]bool
+
+func (m memoryNonces) UseNonce(_ context.Context, nonce string, _ time.Time) (bool, error) {
+	if m[nonce] {
+		return false, nil
+	}
+	m[nonce] = true
+	return true, nil
+}
+
+// recordingInvalidator is a ports.CredentialInvalidator remembering the gyms it invalidated.
+type recordingInvalidator []string
+
+func (r *recordingInvalidator) InvalidateGym(gymSlug string) { *r = append(*r, gymSlug) }
+
+func TestOAuthServiceHandleCallback(t *testing.T) {
+	// forge swaps the gym in a state, keeping its MAC
+	forge := func(state string) string {
+		encoded, mac, _ := strings.Cut(state, ".")
+		raw, _ := base64.RawURLEncoding.DecodeString(encoded)
+		_, rest, _ := strings.Cut(string(raw), "\n")
+		return base64.RawURLEncoding.EncodeToString([]byte("other-gym\n"+rest)) + "." + mac
+	}
+
+	tests := []struct {
+		name        string
+		code        string
+		exchangeErr error
+		// callback turns the issued state into the one MP sends back
+		callback  func(t *testing.T, s *OAuthService, state string) string
+		wantGym   string
+		wantCode  string
+		wantSaved bool
+	}{
+		{
+			name:      "valid",
+			code:      "abc",
+			wantGym:   "level-gym",
+			wantSaved: true,
+		},
+		{
+			name: "reused state",
+			code: "abc",
+			callback: func(t *testing.T, s *OAuthService, state string) string {
+				if _, err := s.HandleCallback(context.Background(), "abc", state); err != nil {
+					t.Fatalf("first callback: %v", err)
+				}
+				return state
+			},
+			wantCode: "OAUTH_STATE_INVALID",
+		},
+		{
+			name: "expired state",
+			code: "abc",
+			callback: func(t *testing.T, s *OAuthService, state string) string {
+				now := s.now().Add(11 * time.Minute)
+				s.now = func() time.Time { return now }
+				return state
+			},
+			wantCode: "OAUTH_STATE_INVALID",
+		},
+		{
+			name:     "state for another gym",
+			code:     "abc",
+			callback: func(_ *testing.T, _ *OAuthService, state string) string { return forge(state) },
+			wantCode: "OAUTH_STATE_INVALID",
+		},
+		{
+			name: "state signed with another secret",
+			code: "abc",
+			callback: func(_ *testing.T, s *OAuthService, _ string) string {
+				other := *s
+				other.stateSecret = []byte("other-secret")
+				return other.signState("level-gym", s.now().Add(time.Minute), "nonce")
+			},
+			wantCode: "OAUTH_STATE_INVALID",
+		},
+		{
+			name:     "malformed state",
+			code:     "abc",
+			callback: func(_ *testing.T, _ *OAuthService, _ string) string { return "not-a-state" },
+			wantCode: "OAUTH_STATE_INVALID",
+		},
+		{
+			name:     "access denied",
+			wantGym:  "level-gym",
+			wantCode: "OAUTH_DENIED",
+		},
+		{
+			name:        "code exchange failed",
+			code:        "abc",
+			exchangeErr: errors.New("invalid_grant"),
+			wantGym:     "level-gym",
+			wantCode:    "OAUTH_EXCHANGE_FAILED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := memoryOAuthTokens{}
+			invalidated := &recordingInvalidator{}
+			s := NewOAuthService(&fakeOAuthGateway{exchangeErr: tt.exchangeErr}, tokens, memoryNonces{},
+				invalidated, "state-secret", 10*time.Minute)
+			now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+			s.now = func() time.Time { return now }
+
+			auth, err := s.Authorize(context.Background(), "level-gym")
+			if err != nil || !auth.Success {
+				t.Fatalf("Authorize = %+v, %v", auth, err)
+			}
+			state := auth.AuthorizationURL
+			if tt.callback != nil {
+				state = tt.callback(t, s, state)
+				// Forget what the setup stored
+				delete(tokens, "level-gym")
+				*invalidated = nil
+			}
+
+			gym, err := s.HandleCallback(context.Background(), tt.code, state)
+			if gym != tt.wantGym {
+				t.Errorf("gym = %q, want %q", gym, tt.wantGym)
+			}
+			var svcErr *domain.ServiceError
+			switch {
+			case tt.wantCode == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantCode != "" && (!errors.As(err, &svcErr) || svcErr.Code != tt.wantCode):
+				t.Fatalf("err = %v, want code %s", err, tt.wantCode)
+			}
+
+			token, saved := tokens["level-gym"]
+			if saved != tt.wantSaved {
+				t.Fatalf("token saved = %v, want %v", saved, tt.wantSaved)
+			}
+			if saved && (token.AccessToken != "APP_USR-"+tt.code || len(*invalidated) != 1) {
+				t.Errorf("saved %+v and invalidated %v, want the exchanged token and level-gym invalidated",
+					token, *invalidated)
+			}
+		})
+	}
+}
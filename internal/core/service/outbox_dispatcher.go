@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// RetryPolicy controls how failed Django deliveries are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Backoff returns the delay before the next attempt after the given number
+// of failed attempts: exponential from BaseDelay, capped at MaxDelay, with
+// jitter over the upper half so retries from a burst spread out.
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half+1)
+}
+
+// leaseMargin is added to the longest a batch can take to deliver when
+// leasing it, for the outcomes to be recorded.
+const leaseMargin = 30 * time.Second
+
+// OutboxDispatcher delivers outbox messages to Django in the background.
+type OutboxDispatcher struct {
+	outbox          ports.OutboxRepository
+	notifier        ports.DjangoNotifier
+	policy          RetryPolicy
+	pollInterval    time.Duration
+	batchSize       int
+	deliveryTimeout time.Duration
+}
+
+// NewOutboxDispatcher creates a new outbox dispatcher. Each delivery
+// attempt is given up after deliveryTimeout.
+func NewOutboxDispatcher(
+	outbox ports.OutboxRepository,
+	notifier ports.DjangoNotifier,
+	policy RetryPolicy,
+	pollInterval time.Duration,
+	batchSize int,
+	deliveryTimeout time.Duration,
+) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		outbox:          outbox,
+		notifier:        notifier,
+		policy:          policy,
+		pollInterval:    pollInterval,
+		batchSize:       batchSize,
+		deliveryTimeout: deliveryTimeout,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	log.Printf("Outbox dispatcher started (poll %s, max attempts %d)", d.pollInterval, d.policy.MaxAttempts)
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchDue delivers one batch of due messages. Messages are delivered
+// one after another, so the batch is leased for as long as every attempt
+// timing out would take: no other dispatcher claims the last ones while
+// they wait their turn.
+func (d *OutboxDispatcher) dispatchDue(ctx context.Context) {
+	lease := time.Duration(d.batchSize)*d.deliveryTimeout + leaseMargin
+
+	messages, err := d.outbox.ClaimDue(ctx, d.batchSize, lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Outbox: failed to claim due messages: %v", err)
+		}
+		return
+	}
+
+	for _, m := range messages {
+		if ctx.Err() != nil {
+			return
+		}
+		d.deliver(ctx, m)
+	}
+}
+
+// deliver sends one message and records the outcome.
+func (d *OutboxDispatcher) deliver(ctx context.Context, m domain.OutboxMessage) {
+	sendCtx, cancel := context.WithTimeout(ctx, d.deliveryTimeout)
+	err := d.send(sendCtx, m)
+	cancel()
+	if err == nil {
+		if err := d.outbox.MarkDelivered(ctx, m.ID); err != nil {
+			log.Printf("Outbox: delivered %s but failed to mark it: %v", outboxLabel(m), err)
+			return
+		}
+		log.Printf("Outbox: delivered %s after %d attempt(s)", outboxLabel(m), m.Attempts+1)
+		return
+	}
+
+	// Shutting down: leave the message leased, it is retried once the lease expires
+	if ctx.Err() != nil {
+		return
+	}
+
+	httpStatus := 0
+	var callbackErr *domain.CallbackError
+	if errors.As(err, &callbackErr) {
+		httpStatus = callbackErr.StatusCode
+	}
+
+	attempts := m.Attempts + 1
+	if attempts >= d.policy.MaxAttempts {
+		log.Printf("Outbox: giving up on %s after %d attempts: %v", outboxLabel(m), attempts, err)
+		if markErr := d.outbox.MarkDead(ctx, m.ID, err.Error(), httpStatus); markErr != nil {
+			log.Printf("Outbox: failed to dead-letter %s: %v", outboxLabel(m), markErr)
+		}
+		return
+	}
+
+	delay := d.policy.Backoff(attempts)
+	log.Printf("Outbox: attempt %d for %s failed, retrying in %s: %v", attempts, outboxLabel(m), delay, err)
+	if markErr := d.outbox.MarkRetry(ctx, m.ID, time.Now().Add(delay), err.Error(), httpStatus); markErr != nil {
+		log.Printf("Outbox: failed to schedule retry for %s: %v", outboxLabel(m), markErr)
+	}
+}
+
+// send delivers a message through the Django callback for its kind.
+func (d *OutboxDispatcher) send(ctx context.Context, m domain.OutboxMessage) error {
+	switch {
+	case m.Kind == domain.OutboxKindSubscription && m.Subscription != nil:
+		return d.notifier.NotifySubscriptionEvent(ctx, *m.Subscription)
+	case m.Payload != nil:
+		return d.notifier.NotifyPaymentConfirmed(ctx, *m.Payload)
+	default:
+		return fmt.Errorf("outbox message #%d has no %s payload", m.ID, m.Kind)
+	}
+}
+
+// outboxLabel identifies a message in logs.
+func outboxLabel(m domain.OutboxMessage) string {
+	switch {
+	case m.Subscription != nil:
+		return fmt.Sprintf("#%d (%s, subscription %s, gym %s)", m.ID, m.Subscription.Event, m.Subscription.SubscriptionID, m.GymSlug)
+	case m.Payload != nil:
+		return fmt.Sprintf("#%d (%s, payment %s, gym %s)", m.ID, m.Payload.Event, m.Payload.PaymentID, m.GymSlug)
+	default:
+		return fmt.Sprintf("#%d (gym %s)", m.ID, m.GymSlug)
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// leasingOutbox is a ports.OutboxRepository handing out its due messages
+// once and recording what became of them.
+type leasingOutbox struct {
+	ports.OutboxRepository
+	due      []domain.OutboxMessage
+	lease    time.Duration
+	outcomes map[int64]string
+}
+
+func (o *leasingOutbox) ClaimDue(_ context.Context, limit int, lease time.Duration) ([]domain.OutboxMessage, error) {
+	o.lease = lease
+	claimed := o.due[:min(limit, len(o.due))]
+	o.due = o.due[len(claimed):]
+	return claimed, nil
+}
+
+func (o *leasingOutbox) MarkDelivered(_ context.Context, id int64) error {
+	o.outcomes[id] = "delivered"
+	return nil
+}
+
+func (o *leasingOutbox) MarkRetry(_ context.Context, id int64, _ time.Time, _ string, _ int) error {
+	o.outcomes[id] = "retry"
+	return nil
+}
+
+func (o *leasingOutbox) MarkDead(_ context.Context, id int64, _ string, _ int) error {
+	o.outcomes[id] = "dead"
+	return nil
+}
+
+// fakeNotifier is a ports.DjangoNotifier answering each payment event with
+// its error, or hanging until the request is given up for "hang".
+type fakeNotifier struct {
+	errs map[string]error
+}
+
+func (n *fakeNotifier) NotifyPaymentConfirmed(ctx context.Context, payload domain.DjangoWebhookPayload) error {
+	if payload.Event == "hang" {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return n.errs[payload.Event]
+}
+
+func (n *fakeNotifier) NotifySubscriptionEvent(context.Context, domain.DjangoSubscriptionPayload) error {
+	return nil
+}
+
+func TestOutboxDispatcherDispatchDue(t *testing.T) {
+	message := func(id int64, event string, attempts int) domain.OutboxMessage {
+		return domain.OutboxMessage{ID: id, GymSlug: "level-gym", Kind: domain.OutboxKindPayment, Attempts: attempts,
+			Payload: &domain.DjangoWebhookPayload{Event: event, PaymentID: "100"}}
+	}
+	outbox := &leasingOutbox{
+		due: []domain.OutboxMessage{
+			message(1, "payment.approved", 0),
+			message(2, "payment.rejected", 0),
+			message(3, "payment.rejected", 2),
+			message(4, "hang", 0),
+			{ID: 5, GymSlug: "level-gym", Kind: domain.OutboxKindSubscription},
+			message(6, "payment.approved", 0),
+		},
+		outcomes: map[int64]string{},
+	}
+	notifier := &fakeNotifier{errs: map[string]error{
+		"payment.rejected": &domain.CallbackError{StatusCode: 500, Body: "internal server error"},
+	}}
+	d := NewOutboxDispatcher(outbox, notifier, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute},
+		time.Second, 5, 10*time.Millisecond)
+
+	d.dispatchDue(context.Background())
+
+	// Every attempt of the batch may time out before the last one starts
+	if want := 5 * 10 * time.Millisecond; outbox.lease < want {
+		t.Errorf("lease = %s, want at least %s", outbox.lease, want)
+	}
+	want := map[int64]string{1: "delivered", 2: "retry", 3: "dead", 4: "retry", 5: "retry"}
+	for id, outcome := range want {
+		if outbox.outcomes[id] != outcome {
+			t.Errorf("message %d: outcome %q, want %q", id, outbox.outcomes[id], outcome)
+		}
+	}
+	if _, ok := outbox.outcomes[6]; ok {
+		t.Error("message 6 beyond the batch size was dispatched")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	tests := []struct {
+		attempts int
+		max      time.Duration
+	}{
+		{attempts: 1, max: time.Second},
+		{attempts: 2, max: 2 * time.Second},
+		{attempts: 4, max: 8 * time.Second},
+		{attempts: 9, max: time.Minute},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			if got := policy.Backoff(tt.attempts); got < tt.max/2 || got > tt.max {
+				t.Errorf("Backoff(%d) = %s, want between %s and %s", tt.attempts, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
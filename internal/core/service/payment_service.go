@@ -3,6 +3,11 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
@@ -12,51 +17,138 @@ import (
 
 // PaymentService orchestrates payment operations.
 type PaymentService struct {
-	gateway         ports.PaymentGateway
-	credProvider    ports.GymCredentialProvider
-	djangoNotifier  ports.DjangoNotifier
+	gateway          ports.PaymentGateway
+	credProvider     ports.GymCredentialProvider
+	tokens           *AccessTokenResolver
 	webhookValidator ports.WebhookValidator
+	repo             ports.PaymentRepository
+	idempotency      ports.IdempotencyRepository
+	webhookEvents    ports.WebhookEventRepository
+	outbox           ports.OutboxRepository
+	tx               ports.Transactor
+	settings         *GymSettingsResolver
+	subscriptions    *SubscriptionService
+	events           ports.PaymentEventBus
+	// allowUnsignedIPN accepts topic-style IPN without x-signature
+	allowUnsignedIPN bool
 }
 
 // NewPaymentService creates a new payment service.
 func NewPaymentService(
 	gateway ports.PaymentGateway,
 	credProvider ports.GymCredentialProvider,
-	djangoNotifier ports.DjangoNotifier,
+	tokens *AccessTokenResolver,
 	webhookValidator ports.WebhookValidator,
+	repo ports.PaymentRepository,
+	idempotency ports.IdempotencyRepository,
+	webhookEvents ports.WebhookEventRepository,
+	outbox ports.OutboxRepository,
+	tx ports.Transactor,
+	settings *GymSettingsResolver,
+	subscriptions *SubscriptionService,
+	events ports.PaymentEventBus,
+	allowUnsignedIPN bool,
 ) *PaymentService {
 	return &PaymentService{
-		gateway:         gateway,
-		credProvider:    credProvider,
-		djangoNotifier:  djangoNotifier,
+		gateway:          gateway,
+		credProvider:     credProvider,
+		tokens:           tokens,
 		webhookValidator: webhookValidator,
+		repo:             repo,
+		idempotency:      idempotency,
+		webhookEvents:    webhookEvents,
+		outbox:           outbox,
+		tx:               tx,
+		settings:         settings,
+		subscriptions:    subscriptions,
+		events:           events,
+		allowUnsignedIPN: allowUnsignedIPN,
 	}
 }
 
 // CreateCheckout creates a payment preference in Mercado Pago.
-// The access token is provided in the request (stateless).
-func (s *PaymentService) CreateCheckout(ctx context.Context, req domain.PaymentRequest) (*domain.PaymentResponse, error) {
+// The access token is looked up server-side; currency, back URLs and
+// statement descriptor come from the gym's settings.
+//
+// Requests are idempotent: idempotencyKey (or gym_slug + external_reference
+// when empty) identifies the checkout, a repeated identical request returns
+// the original response and a different body under the same key is rejected
+// with IDEMPOTENCY_CONFLICT. Keys are forgotten after a day or once the
+// preference they created expired.
+func (s *PaymentService) CreateCheckout(ctx context.Context, req domain.PaymentRequest, idempotencyKey string) (*domain.PaymentResponse, error) {
 	// Validate required fields
-	if req.MPAccessToken == "" {
+	if msg := validateCheckout(req); msg != "" {
 		return &domain.PaymentResponse{
 			Success:   false,
-			Error:     "mp_access_token is required",
+			Error:     msg,
 			ErrorCode: "VALIDATION_ERROR",
 		}, nil
 	}
 
-	if req.GymSlug == "" || req.Amount <= 0 || req.Title == "" {
+	// Claim the idempotency key before talking to Mercado Pago
+	key := checkoutIdempotencyKey(req, idempotencyKey)
+	requestHash, err := hashCheckoutRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the gym's currency and checkout URLs
+	settings, err := s.settings.Resolve(ctx, req.GymSlug)
+	if err != nil {
+		log.Printf("Failed to resolve settings for gym %s: %v", req.GymSlug, err)
+		return &domain.PaymentResponse{
+			Success:   false,
+			Error:     "Failed to resolve gym settings",
+			ErrorCode: settingsErrorCode(err),
+		}, nil
+	}
+	if msg := validateCurrency(req.Currency, settings); msg != "" {
 		return &domain.PaymentResponse{
 			Success:   false,
-			Error:     "gym_slug, amount, and title are required",
+			Error:     msg,
 			ErrorCode: "VALIDATION_ERROR",
 		}, nil
 	}
+	req.Currency = settings.Currency
+	items, total, msg := checkoutAmounts(req)
+	if msg != "" {
+		return &domain.PaymentResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	accessToken, err := s.tokens.Resolve(ctx, req.GymSlug, req.MPAccessToken)
+	if err != nil {
+		msg, code := tokenError(err)
+		return &domain.PaymentResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	existing, reserved, err := s.idempotency.ReserveKey(ctx, domain.IdempotencyRecord{
+		Key:         key,
+		GymSlug:     req.GymSlug,
+		RequestHash: requestHash,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		return replayCheckout(existing, requestHash), nil
+	}
 
 	// Create preference using the provided token
-	response, err := s.gateway.CreatePreference(ctx, req.MPAccessToken, req)
+	response, err := s.gateway.CreatePreference(ctx, accessToken, req, settings)
 	if err != nil {
 		log.Printf("Failed to create preference for gym %s: %v", req.GymSlug, err)
+		if relErr := s.idempotency.ReleaseKey(ctx, key); relErr != nil {
+			log.Printf("Failed to release idempotency key %s: %v", key, relErr)
+		}
 		return &domain.PaymentResponse{
 			Success:   false,
 			Error:     "Failed to create payment preference",
@@ -64,95 +156,943 @@ func (s *PaymentService) CreateCheckout(ctx context.Context, req domain.PaymentR
 		}, nil
 	}
 
-	log.Printf("Created preference %s for gym %s, amount: %.2f", 
-		response.PreferenceID, req.GymSlug, req.Amount)
+	if err := s.idempotency.CompleteKey(ctx, key, *response); err != nil {
+		log.Printf("Failed to store idempotent response for key %s: %v", key, err)
+	}
+
+	log.Printf("Created preference %s for gym %s, amount: %s %s (%d items)",
+		response.PreferenceID, req.GymSlug, total, total.Currency, len(items))
+
+	// Record the preference in the ledger (best-effort: MP already has it)
+	record := domain.PreferenceRecord{
+		GymSlug:           req.GymSlug,
+		ExternalReference: req.ExternalReference,
+		PreferenceID:      response.PreferenceID,
+		Title:             req.Summary(),
+		Amount:            total,
+		Currency:          total.Currency,
+		Items:             items,
+		PayerEmail:        req.PayerEmail,
+		InitPoint:         response.InitPoint,
+		CreatedAt:         time.Now(),
+	}
+	if err := s.repo.SavePreference(ctx, record); err != nil {
+		log.Printf("Failed to record preference %s for gym %s: %v",
+			response.PreferenceID, req.GymSlug, err)
+	}
 
 	return response, nil
 }
 
-// ProcessWebhook handles incoming Mercado Pago webhook notifications.
+// validateCheckout checks the checkout shape: either title and amount or a
+// list of valid items. Returns an error message, or "" when valid.
+func validateCheckout(req domain.PaymentRequest) string {
+	if req.GymSlug == "" {
+		return "gym_slug is required"
+	}
+
+	if len(req.Items) == 0 {
+		if !req.Amount.IsPositive() || req.Title == "" {
+			return "either items or amount and title are required"
+		}
+		return ""
+	}
+
+	for i, item := range req.Items {
+		if item.Title == "" || item.Quantity <= 0 || !item.UnitPrice.IsPositive() {
+			return fmt.Sprintf("items[%d]: title, quantity and unit_price are required", i)
+		}
+		if item.Quantity > domain.MaxItemQuantity {
+			return fmt.Sprintf("items[%d]: quantity must not exceed %d", i, domain.MaxItemQuantity)
+		}
+	}
+	return ""
+}
+
+// checkoutAmounts returns the items and total of a checkout in its
+// currency. Returns an error message when a price has more decimals than
+// the currency allows, the total is out of range or a sent amount does not
+// match the items total.
+func checkoutAmounts(req domain.PaymentRequest) ([]domain.CheckoutItem, domain.Money, string) {
+	items, err := req.CheckoutItems()
+	if err != nil {
+		return nil, domain.Money{}, err.Error()
+	}
+	total, err := req.TotalAmount()
+	if err != nil {
+		return nil, domain.Money{}, err.Error()
+	}
+
+	// A sent amount must agree with the items so Django and MP never disagree
+	amount, err := req.Amount.WithCurrency(total.Currency)
+	if err != nil {
+		return nil, domain.Money{}, "amount: " + err.Error()
+	}
+	if !amount.IsZero() && !amount.Equal(total) {
+		return nil, domain.Money{}, fmt.Sprintf("amount %s does not match items total %s", amount, total)
+	}
+	return items, total, ""
+}
+
+// checkoutIdempotencyKey scopes the client key to the gym, falling back to
+// the external reference when Django sends no Idempotency-Key header.
+func checkoutIdempotencyKey(req domain.PaymentRequest, idempotencyKey string) string {
+	if idempotencyKey != "" {
+		return "key:" + req.GymSlug + ":" + idempotencyKey
+	}
+	return "ref:" + req.GymSlug + ":" + req.ExternalReference
+}
+
+// hashCheckoutRequest fingerprints a checkout body. The access token is left
+// out so it is never persisted and a rotated token does not count as a change.
+func hashCheckoutRequest(req domain.PaymentRequest) (string, error) {
+	req.MPAccessToken = ""
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// replayCheckout builds the response for a request whose key was already used.
+func replayCheckout(existing *domain.IdempotencyRecord, requestHash string) *domain.PaymentResponse {
+	if existing.RequestHash != requestHash {
+		return &domain.PaymentResponse{
+			Success:   false,
+			Error:     "Idempotency key was already used with a different request body",
+			ErrorCode: "IDEMPOTENCY_CONFLICT",
+		}
+	}
+
+	if existing.Status != domain.IdempotencyCompleted {
+		return &domain.PaymentResponse{
+			Success:   false,
+			Error:     "A request with this idempotency key is still being processed",
+			ErrorCode: "IDEMPOTENCY_IN_PROGRESS",
+		}
+	}
+
+	log.Printf("Replaying checkout for idempotency key %s (preference %s)",
+		existing.Key, existing.Response.PreferenceID)
+	response := existing.Response
+	return &response
+}
+
+// RefundPayment refunds a payment in full or, when req.Amount is set, partially.
+func (s *PaymentService) RefundPayment(ctx context.Context, paymentID string, req domain.RefundRequest) (*domain.RefundResponse, error) {
+	if paymentID == "" || req.GymSlug == "" {
+		return &domain.RefundResponse{
+			Success:   false,
+			Error:     "payment_id and gym_slug are required",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	if req.Amount != nil && !req.Amount.IsPositive() {
+		return &domain.RefundResponse{
+			Success:   false,
+			Error:     "amount must be greater than zero",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	accessToken, err := s.tokens.Resolve(ctx, req.GymSlug, req.MPAccessToken)
+	if err != nil {
+		msg, code := tokenError(err)
+		return &domain.RefundResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	// Partial refunds are in the payment's currency
+	if req.Amount != nil {
+		current, err := s.gateway.GetPaymentInfo(ctx, accessToken, paymentID)
+		if err != nil {
+			log.Printf("Failed to get payment %s for refund, gym %s: %v", paymentID, req.GymSlug, err)
+			return refundErrorResponse(err), nil
+		}
+		amount, err := req.Amount.WithCurrency(current.Currency)
+		if err != nil {
+			return &domain.RefundResponse{
+				Success:   false,
+				Error:     "amount: " + err.Error(),
+				ErrorCode: "VALIDATION_ERROR",
+			}, nil
+		}
+		req.Amount = &amount
+	}
+
+	refundInfo, err := s.gateway.RefundPayment(ctx, accessToken, paymentID, req.Amount)
+	if err != nil {
+		log.Printf("Failed to refund payment %s for gym %s: %v", paymentID, req.GymSlug, err)
+		return refundErrorResponse(err), nil
+	}
+
+	log.Printf("Refund %s created for payment %s, gym %s, amount: %s",
+		refundInfo.RefundID, paymentID, req.GymSlug, refundInfo.Amount)
+
+	// Refresh the ledger so the refund shows up before MP's webhook arrives
+	if paymentInfo, err := s.gateway.GetPaymentInfo(ctx, accessToken, paymentID); err != nil {
+		log.Printf("Failed to refresh payment %s after refund: %v", paymentID, err)
+	} else {
+		if amount, err := refundInfo.Amount.WithCurrency(paymentInfo.Currency); err == nil {
+			refundInfo.Amount = amount
+		}
+		if _, err := s.applyPayment(ctx, req.GymSlug, paymentInfo); err != nil {
+			log.Printf("Failed to record payment %s after refund: %v", paymentID, err)
+		}
+	}
+
+	return &domain.RefundResponse{
+		Success: true,
+		Refund:  refundInfo,
+	}, nil
+}
+
+// refundErrorResponse maps a gateway refund error to a response.
+func refundErrorResponse(err error) *domain.RefundResponse {
+	switch {
+	case errors.Is(err, domain.ErrPaymentNotFound):
+		return &domain.RefundResponse{
+			Success:   false,
+			Error:     "Payment not found",
+			ErrorCode: "PAYMENT_NOT_FOUND",
+		}
+	case errors.Is(err, domain.ErrInvalidRequest):
+		return &domain.RefundResponse{
+			Success:   false,
+			Error:     "Refund rejected: " + err.Error(),
+			ErrorCode: "REFUND_REJECTED",
+		}
+	default:
+		return &domain.RefundResponse{
+			Success:   false,
+			Error:     "Failed to refund payment",
+			ErrorCode: "GATEWAY_ERROR",
+		}
+	}
+}
+
+// paymentLookupError returns the response message and error code of a
+// gateway error fetching a payment.
+func paymentLookupError(err error) (string, string) {
+	if errors.Is(err, domain.ErrPaymentNotFound) {
+		return "Payment not found", "PAYMENT_NOT_FOUND"
+	}
+	return "Failed to get payment", "GATEWAY_ERROR"
+}
+
+// CancelPayment cancels a payment that has not been completed yet, so Django
+// can release whatever the checkout reserved.
+func (s *PaymentService) CancelPayment(ctx context.Context, paymentID string, req domain.CancelRequest) (*domain.CancelResponse, error) {
+	if paymentID == "" || req.GymSlug == "" {
+		return &domain.CancelResponse{
+			Success:   false,
+			Error:     "payment_id and gym_slug are required",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	accessToken, err := s.tokens.Resolve(ctx, req.GymSlug, req.MPAccessToken)
+	if err != nil {
+		msg, code := tokenError(err)
+		return &domain.CancelResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	current, err := s.gateway.GetPaymentInfo(ctx, accessToken, paymentID)
+	if err != nil {
+		log.Printf("Failed to get payment %s for cancellation, gym %s: %v", paymentID, req.GymSlug, err)
+		msg, code := paymentLookupError(err)
+		return &domain.CancelResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	if !isCancellable(current.Status) {
+		return &domain.CancelResponse{
+			Success:   false,
+			Payment:   current,
+			Error:     "Payment with status " + current.Status + " cannot be cancelled",
+			ErrorCode: "PAYMENT_NOT_CANCELLABLE",
+		}, nil
+	}
+
+	paymentInfo, err := s.gateway.CancelPayment(ctx, accessToken, paymentID)
+	if err != nil {
+		log.Printf("Failed to cancel payment %s for gym %s: %v", paymentID, req.GymSlug, err)
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			return &domain.CancelResponse{
+				Success:   false,
+				Error:     "Cancellation rejected: " + err.Error(),
+				ErrorCode: "PAYMENT_NOT_CANCELLABLE",
+			}, nil
+		}
+		return &domain.CancelResponse{
+			Success:   false,
+			Error:     "Failed to cancel payment",
+			ErrorCode: "GATEWAY_ERROR",
+		}, nil
+	}
+
+	log.Printf("Cancelled payment %s for gym %s (was %s)", paymentID, req.GymSlug, current.Status)
+
+	if _, err := s.applyPayment(ctx, req.GymSlug, paymentInfo); err != nil {
+		log.Printf("Failed to record payment %s after cancellation: %v", paymentID, err)
+	}
+
+	return &domain.CancelResponse{
+		Success: true,
+		Payment: paymentInfo,
+	}, nil
+}
+
+// isCancellable reports whether MP allows cancelling a payment in this status.
+func isCancellable(status string) bool {
+	switch status {
+	case domain.PaymentPending, domain.PaymentInProcess, domain.PaymentAuthorized:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetPaymentStatus returns the latest known payment of an external
+// reference. With refresh, the payment is fetched from Mercado Pago first;
+// a reference nothing was recorded for yet can only be refreshed by
+// payment ID, since MP notifies payments by their ID.
+func (s *PaymentService) GetPaymentStatus(ctx context.Context, gymSlug, externalReference string, refresh bool) (*domain.PaymentStatusResponse, error) {
+	snapshot, err := s.repo.GetLatestSnapshotByReference(ctx, gymSlug, externalReference)
+	if errors.Is(err, domain.ErrPaymentNotFound) {
+		return &domain.PaymentStatusResponse{
+			Success:   false,
+			Error:     "no payment recorded for external_reference " + externalReference,
+			ErrorCode: "PAYMENT_NOT_FOUND",
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.paymentStatus(ctx, gymSlug, snapshot.Payment.PaymentID, snapshot, refresh)
+}
+
+// GetPaymentStatusByID returns the latest known state of a payment. With
+// refresh, it is fetched from Mercado Pago first, so payments not notified
+// yet are found as well.
+func (s *PaymentService) GetPaymentStatusByID(ctx context.Context, gymSlug, paymentID string, refresh bool) (*domain.PaymentStatusResponse, error) {
+	snapshot, err := s.repo.GetLatestSnapshot(ctx, gymSlug, paymentID)
+	switch {
+	case errors.Is(err, domain.ErrPaymentNotFound):
+		if !refresh {
+			return &domain.PaymentStatusResponse{
+				Success:   false,
+				Error:     "payment " + paymentID + " not recorded",
+				ErrorCode: "PAYMENT_NOT_FOUND",
+			}, nil
+		}
+	case err != nil:
+		return nil, err
+	}
+	return s.paymentStatus(ctx, gymSlug, paymentID, snapshot, refresh)
+}
+
+// paymentStatus answers a status query with the payment's snapshot, or a
+// fresh copy from Mercado Pago when refresh is set. A failed refresh, or
+// one the payment state machine rejected as stale, falls back to the
+// snapshot when there is one.
+func (s *PaymentService) paymentStatus(ctx context.Context, gymSlug, paymentID string, snapshot *domain.PaymentSnapshot, refresh bool) (*domain.PaymentStatusResponse, error) {
+	if refresh {
+		info, failure, err := s.refreshPayment(ctx, gymSlug, paymentID)
+		if err != nil {
+			return nil, err
+		}
+		stale := snapshot != nil && failure == nil &&
+			domain.CheckPaymentTransition(snapshot.Payment.Status, info.Status) != nil
+		if failure == nil && !stale {
+			fetchedAt := time.Now()
+			return &domain.PaymentStatusResponse{
+				Success:   true,
+				Payment:   info,
+				FetchedAt: &fetchedAt,
+				Refreshed: true,
+			}, nil
+		}
+		if snapshot == nil {
+			return failure, nil
+		}
+	}
+
+	return &domain.PaymentStatusResponse{
+		Success:   true,
+		Payment:   &snapshot.Payment,
+		FetchedAt: &snapshot.FetchedAt,
+	}, nil
+}
+
+// refreshPayment fetches a payment from Mercado Pago and, like a
+// notification, records it and notifies Django when its status moved
+// forward: members returning from checkout often arrive before MP's webhook
+// does. A payment that could not be fetched is reported as a failure
+// response; err is only set when recording it failed.
+func (s *PaymentService) refreshPayment(ctx context.Context, gymSlug, paymentID string) (*domain.PaymentInfo, *domain.PaymentStatusResponse, error) {
+	accessToken, err := s.tokens.Resolve(ctx, gymSlug, "")
+	if err != nil {
+		msg, code := tokenError(err)
+		return nil, &domain.PaymentStatusResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	info, err := s.gateway.GetPaymentInfo(ctx, accessToken, paymentID)
+	if err != nil {
+		log.Printf("Failed to refresh payment %s for gym %s: %v", paymentID, gymSlug, err)
+		msg, code := paymentLookupError(err)
+		return nil, &domain.PaymentStatusResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	change, err := s.applyPayment(ctx, gymSlug, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	if change != nil {
+		log.Printf("Payment %s of gym %s refreshed with new status %s, queued %s",
+			paymentID, gymSlug, info.Status, mapStatusToEvent(info.Status))
+	}
+	return info, nil, nil
+}
+
+// WatchPayment subscribes to the live status events of an external
+// reference until ctx ends or unsubscribe is called. The current state,
+// when one was recorded, is returned as well to be sent first; it is read
+// after subscribing so no transition falls in between.
+func (s *PaymentService) WatchPayment(ctx context.Context, gymSlug, externalReference string) (*domain.PaymentStatusEvent, <-chan domain.PaymentStatusEvent, func(), error) {
+	if s.events == nil {
+		return nil, nil, nil, domain.NewServiceError(domain.ErrInvalidRequest,
+			"live payment events are disabled", "EVENTS_UNAVAILABLE")
+	}
+
+	events, unsubscribe, err := s.events.Subscribe(ctx, gymSlug, externalReference)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	snapshot, err := s.repo.GetLatestSnapshotByReference(ctx, gymSlug, externalReference)
+	switch {
+	case errors.Is(err, domain.ErrPaymentNotFound):
+		return nil, events, unsubscribe, nil
+	case err != nil:
+		unsubscribe()
+		return nil, nil, nil, err
+	}
+	current := statusEvent(gymSlug, &snapshot.Payment, "", snapshot.FetchedAt)
+	return &current, events, unsubscribe, nil
+}
+
+// GetHistory returns everything the ledger knows about an external
+// reference: preferences, payment snapshots, status changes and chargebacks.
+func (s *PaymentService) GetHistory(ctx context.Context, gymSlug, externalReference string) (*domain.PaymentHistoryResponse, error) {
+	history, err := s.repo.GetHistory(ctx, gymSlug, externalReference)
+	if err != nil {
+		return nil, err
+	}
+	if history.Empty() {
+		return &domain.PaymentHistoryResponse{
+			Success:   false,
+			Error:     "no payments recorded for external_reference " + externalReference,
+			ErrorCode: "PAYMENT_NOT_FOUND",
+		}, nil
+	}
+	return &domain.PaymentHistoryResponse{Success: true, History: history}, nil
+}
+
+// ProcessWebhook handles incoming Mercado Pago webhook notifications, and
+// topic-style IPN once normalized.
+//
+// Topic-style IPN without x-signature is accepted while allowUnsignedIPN is
+// set: its body is never trusted, the notified resource is always fetched
+// from Mercado Pago with the gym's token.
 func (s *PaymentService) ProcessWebhook(
 	ctx context.Context,
 	gymSlug string,
 	notification domain.WebhookNotification,
 	xSignature string,
 	xRequestID string,
+	tenantToken string,
 ) error {
-	// Step 1: Get webhook secret for this gym
-	secret, err := s.credProvider.GetWebhookSecret(ctx, gymSlug)
+	notification = notification.Normalize()
+
+	// The notification URL's tenant token must belong to this gym
+	if !s.settings.VerifyNotificationToken(gymSlug, tenantToken) {
+		log.Printf("Webhook tenant token rejected for gym %s", gymSlug)
+		return domain.ErrWebhookValidationFailed
+	}
+
+	// The notification must be signed with one of the gym's webhook secrets
+	dataID := notification.Data.ID
+	if xSignature == "" && notification.IsTopicStyle() && s.allowUnsignedIPN {
+		log.Printf("Accepting unsigned %s IPN %s for gym %s", notification.Topic, dataID, gymSlug)
+	} else if err := s.validateWebhookSignature(ctx, gymSlug, dataID, xSignature, xRequestID); err != nil {
+		return err
+	}
+
+	// Only process payment, merchant order, chargeback and subscription notifications
+	var process func(ctx context.Context, gymSlug, dataID, eventKey string) error
+	switch {
+	case notification.Type == domain.NotificationPayment:
+		process = s.processPaymentNotification
+	case notification.Type == domain.NotificationMerchantOrder,
+		notification.Type == domain.NotificationMerchantOrderWebhook:
+		process = s.processMerchantOrderNotification
+	case notification.Type == domain.NotificationChargebacks:
+		process = s.processChargebackNotification
+	case notification.Type == domain.NotificationSubscriptionPreapproval && s.subscriptions != nil:
+		process = s.subscriptions.processPreapprovalNotification
+	case notification.Type == domain.NotificationSubscriptionAuthorizedPayment && s.subscriptions != nil:
+		process = s.subscriptions.processChargeNotification
+	default:
+		log.Printf("Ignoring webhook type: %s for gym %s", notification.Type, gymSlug)
+		return nil
+	}
+	if dataID == "" {
+		log.Printf("Ignoring %s webhook without a resource ID for gym %s", notification.Type, gymSlug)
+		return nil
+	}
+
+	// Skip redeliveries of an event we already handled. Notifications
+	// without an identifier of their own are not deduplicated; their
+	// processing only notifies Django of status changes instead.
+	eventKey := notification.EventKey(xRequestID)
+	if eventKey != "" {
+		claimed, err := s.webhookEvents.ClaimEvent(ctx, gymSlug, eventKey)
+		if err != nil {
+			log.Printf("Failed to claim webhook event %s for gym %s: %v", eventKey, gymSlug, err)
+			return err
+		}
+		if !claimed {
+			log.Printf("Ignoring duplicate webhook event %s for gym %s", eventKey, gymSlug)
+			return nil
+		}
+	}
+
+	if err := process(ctx, gymSlug, dataID, eventKey); err != nil {
+		// Let the next MP redelivery try again
+		if eventKey != "" {
+			if relErr := s.webhookEvents.ReleaseEvent(ctx, gymSlug, eventKey); relErr != nil {
+				log.Printf("Failed to release webhook event %s for gym %s: %v", eventKey, gymSlug, relErr)
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// validateWebhookSignature checks x-signature against the gym's webhook
+// secrets, including the previous one while it is being rotated.
+func (s *PaymentService) validateWebhookSignature(ctx context.Context, gymSlug, dataID, xSignature, xRequestID string) error {
+	// Get webhook secrets for this gym
+	secrets, err := s.credProvider.GetWebhookSecrets(ctx, gymSlug)
 	if err != nil {
 		log.Printf("Failed to get webhook secret for gym %s: %v", gymSlug, err)
+		if !errors.Is(err, domain.ErrGymNotFound) {
+			return err
+		}
 		return domain.NewServiceError(domain.ErrGymNotFound,
 			"gym not found: "+gymSlug, "GYM_NOT_FOUND")
 	}
 
-	// Step 2: Validate webhook signature
-	dataID := notification.Data.ID
-	if !s.webhookValidator.ValidateSignature(xSignature, xRequestID, dataID, secret) {
+	// Validate webhook signature
+	now := time.Now()
+	active := secrets.Active(now)
+	matched, ok := s.webhookValidator.ValidateSignature(xSignature, xRequestID, dataID, active)
+	if !ok {
 		log.Printf("Webhook signature validation failed for gym %s", gymSlug)
 		return domain.ErrWebhookValidationFailed
 	}
-
-	// Step 3: Only process payment notifications
-	if notification.Type != "payment" {
-		log.Printf("Ignoring webhook type: %s for gym %s", notification.Type, gymSlug)
-		return nil
+	if secrets.InGracePeriod(now) {
+		which := "current"
+		if active[matched] != secrets.Current {
+			which = "previous"
+		}
+		log.Printf("Webhook for gym %s signed with the %s secret (previous secret accepted until %s)",
+			gymSlug, which, secrets.PreviousExpiresAt.Format(time.RFC3339))
 	}
+	return nil
+}
 
-	// Step 4: Get access token to fetch payment info
+// processPaymentNotification fetches a notified payment and, in a single
+// transaction, records it in the ledger, queues the Django notification in
+// the outbox and marks the webhook event as processed. Delivery to Django
+// happens asynchronously in the OutboxDispatcher.
+//
+// Django is only notified when the payment moved forward to a new status;
+// redeliveries and out-of-order notifications queue nothing.
+func (s *PaymentService) processPaymentNotification(ctx context.Context, gymSlug, dataID, eventKey string) error {
+	// Get access token to fetch payment info
 	accessToken, err := s.credProvider.GetAccessToken(ctx, gymSlug)
 	if err != nil {
 		log.Printf("Failed to get access token for gym %s: %v", gymSlug, err)
 		return err
 	}
 
-	// Step 5: Get payment details from Mercado Pago
+	// Get payment details from Mercado Pago
 	paymentInfo, err := s.gateway.GetPaymentInfo(ctx, accessToken, dataID)
 	if err != nil {
 		log.Printf("Failed to get payment info %s for gym %s: %v", dataID, gymSlug, err)
 		return err
 	}
 
-	// Step 6: Determine event type based on status
+	// Determine event type based on status
 	event := mapStatusToEvent(paymentInfo.Status)
-	
-	// Step 7: Notify Django backend
+
+	var change *domain.StatusChange
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		// Record the snapshot and any status change in the ledger
+		var err error
+		change, err = s.recordPayment(ctx, gymSlug, paymentInfo)
+		if err != nil {
+			return err
+		}
+
+		// Queue the Django notification
+		if change != nil {
+			if err := s.enqueuePayment(ctx, gymSlug, paymentInfo); err != nil {
+				return err
+			}
+		}
+
+		return s.completeEvent(ctx, gymSlug, eventKey)
+	})
+	if err != nil {
+		log.Printf("Failed to queue Django notification for payment %s: %v", dataID, err)
+		return err
+	}
+	s.publishChange(ctx, change, paymentInfo)
+
+	if change == nil {
+		log.Printf("Webhook processed: payment %s, status %s not a new transition, gym %s", dataID, paymentInfo.Status, gymSlug)
+		return nil
+	}
+	log.Printf("Webhook processed: payment %s, status %s, gym %s (queued %s)",
+		dataID, paymentInfo.Status, gymSlug, event)
+
+	return nil
+}
+
+// processMerchantOrderNotification fetches a notified merchant order and
+// each of its payments and, in a single transaction, records them in the
+// ledger and queues a Django notification for every payment whose status
+// changed. Payments of an order are usually notified on their own as well,
+// so unchanged ones are not notified again.
+func (s *PaymentService) processMerchantOrderNotification(ctx context.Context, gymSlug, orderID, eventKey string) error {
+	accessToken, err := s.credProvider.GetAccessToken(ctx, gymSlug)
+	if err != nil {
+		log.Printf("Failed to get access token for gym %s: %v", gymSlug, err)
+		return err
+	}
+
+	order, err := s.gateway.GetMerchantOrder(ctx, accessToken, orderID)
+	if err != nil {
+		log.Printf("Failed to get merchant order %s for gym %s: %v", orderID, gymSlug, err)
+		return err
+	}
+
+	payments := make([]*domain.PaymentInfo, 0, len(order.PaymentIDs))
+	for _, paymentID := range order.PaymentIDs {
+		info, err := s.gateway.GetPaymentInfo(ctx, accessToken, paymentID)
+		if err != nil {
+			log.Printf("Failed to get payment %s of merchant order %s for gym %s: %v", paymentID, orderID, gymSlug, err)
+			return err
+		}
+		payments = append(payments, info)
+	}
+
+	changes := make([]*domain.StatusChange, len(payments))
+	queued := 0
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		for i, info := range payments {
+			change, err := s.recordPayment(ctx, gymSlug, info)
+			if err != nil {
+				return err
+			}
+			changes[i] = change
+			if change == nil {
+				continue
+			}
+			if err := s.enqueuePayment(ctx, gymSlug, info); err != nil {
+				return err
+			}
+			queued++
+		}
+		return s.completeEvent(ctx, gymSlug, eventKey)
+	})
+	if err != nil {
+		log.Printf("Failed to queue Django notifications for merchant order %s: %v", orderID, err)
+		return err
+	}
+	for i, info := range payments {
+		s.publishChange(ctx, changes[i], info)
+	}
+
+	log.Printf("Webhook processed: merchant order %s (%s, paid %s of %s), %d payment(s), gym %s (queued %d)",
+		orderID, order.OrderStatus, order.PaidAmount, order.TotalAmount, len(payments), gymSlug, queued)
+	return nil
+}
+
+// processChargebackNotification fetches a notified chargeback and the
+// disputed payment and, in a single transaction, records the chargeback in
+// the ledger and queues payment.chargeback_opened the first time it is seen
+// and payment.chargeback_resolved once MP decided on it.
+func (s *PaymentService) processChargebackNotification(ctx context.Context, gymSlug, chargebackID, eventKey string) error {
+	accessToken, err := s.credProvider.GetAccessToken(ctx, gymSlug)
+	if err != nil {
+		log.Printf("Failed to get access token for gym %s: %v", gymSlug, err)
+		return err
+	}
+
+	chargeback, err := s.gateway.GetChargeback(ctx, accessToken, chargebackID)
+	if err != nil {
+		log.Printf("Failed to get chargeback %s for gym %s: %v", chargebackID, gymSlug, err)
+		return err
+	}
+	chargeback.GymSlug = gymSlug
+
+	// The chargeback does not carry the external reference Django knows it by
+	payment := &domain.PaymentInfo{PaymentID: chargeback.PaymentID}
+	if chargeback.PaymentID != "" {
+		payment, err = s.gateway.GetPaymentInfo(ctx, accessToken, chargeback.PaymentID)
+		if err != nil {
+			log.Printf("Failed to get payment %s of chargeback %s for gym %s: %v",
+				chargeback.PaymentID, chargebackID, gymSlug, err)
+			return err
+		}
+		chargeback.ExternalReference = payment.ExternalReference
+	}
+
+	var events []string
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.LockChargeback(ctx, gymSlug, chargebackID); err != nil {
+			return err
+		}
+		previous, err := s.repo.GetChargeback(ctx, gymSlug, chargebackID)
+		if err != nil && !errors.Is(err, domain.ErrChargebackNotFound) {
+			return err
+		}
+		if err := s.repo.SaveChargeback(ctx, *chargeback); err != nil {
+			return err
+		}
+
+		events = chargebackEvents(previous, chargeback)
+		for _, event := range events {
+			payload := domain.DjangoWebhookPayload{
+				Event:             event,
+				GymSlug:           gymSlug,
+				ExternalReference: chargeback.ExternalReference,
+				PaymentID:         chargeback.PaymentID,
+				PaymentStatus:     payment.Status,
+				PaymentType:       payment.PaymentType,
+				Amount:            chargeback.Amount,
+				Currency:          chargeback.Currency,
+				PayerEmail:        payment.PayerEmail,
+				Timestamp:         time.Now().Format(time.RFC3339),
+				Chargeback:        chargeback,
+			}
+			message := domain.OutboxMessage{GymSlug: gymSlug, Kind: domain.OutboxKindPayment, Payload: &payload}
+			if err := s.outbox.Enqueue(ctx, message); err != nil {
+				return err
+			}
+		}
+
+		return s.completeEvent(ctx, gymSlug, eventKey)
+	})
+	if err != nil {
+		log.Printf("Failed to queue Django notification for chargeback %s: %v", chargebackID, err)
+		return err
+	}
+
+	log.Printf("Webhook processed: chargeback %s on payment %s (%s, documentation %s), gym %s (queued %v)",
+		chargebackID, chargeback.PaymentID, chargeback.Status, chargeback.DocumentationStatus, gymSlug, events)
+	return nil
+}
+
+// chargebackEvents returns the Django events for a chargeback moving from
+// previous (nil when first seen) to current.
+func chargebackEvents(previous, current *domain.Chargeback) []string {
+	var events []string
+	if previous == nil {
+		events = append(events, "payment.chargeback_opened")
+	}
+	if current.Status == domain.ChargebackResolved &&
+		(previous == nil || previous.Status != domain.ChargebackResolved) {
+		events = append(events, "payment.chargeback_resolved")
+	}
+	return events
+}
+
+// enqueuePayment queues the Django notification of a payment's status.
+func (s *PaymentService) enqueuePayment(ctx context.Context, gymSlug string, info *domain.PaymentInfo) error {
 	payload := domain.DjangoWebhookPayload{
-		Event:             event,
+		Event:             mapStatusToEvent(info.Status),
 		GymSlug:           gymSlug,
-		ExternalReference: paymentInfo.ExternalReference,
-		PaymentID:         paymentInfo.PaymentID,
-		PaymentStatus:     paymentInfo.Status,
-		PaymentType:       paymentInfo.PaymentType,
-		Amount:            paymentInfo.Amount,
-		PayerEmail:        paymentInfo.PayerEmail,
+		ExternalReference: info.ExternalReference,
+		PaymentID:         info.PaymentID,
+		PaymentStatus:     info.Status,
+		PaymentType:       info.PaymentType,
+		Amount:            info.Amount,
+		Currency:          info.Currency,
+		PayerEmail:        info.PayerEmail,
 		Timestamp:         time.Now().Format(time.RFC3339),
 	}
+	message := domain.OutboxMessage{GymSlug: gymSlug, Kind: domain.OutboxKindPayment, Payload: &payload}
+	return s.outbox.Enqueue(ctx, message)
+}
 
-	if err := s.djangoNotifier.NotifyPaymentConfirmed(ctx, payload); err != nil {
-		log.Printf("Failed to notify Django for payment %s: %v", dataID, err)
-		return err
+// applyPayment records a payment fetched outside of a notification, such
+// as after a refund or on a status refresh, and queues the Django
+// notification in the same transaction when its status moved forward.
+// MP's own notification then finds the payment unchanged and queues nothing.
+func (s *PaymentService) applyPayment(ctx context.Context, gymSlug string, info *domain.PaymentInfo) (*domain.StatusChange, error) {
+	var change *domain.StatusChange
+	err := s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		change, err = s.recordPayment(ctx, gymSlug, info)
+		if err != nil || change == nil {
+			return err
+		}
+		return s.enqueuePayment(ctx, gymSlug, info)
+	})
+	if err != nil {
+		return nil, err
 	}
+	s.publishChange(ctx, change, info)
+	return change, nil
+}
 
-	log.Printf("Webhook processed: payment %s, status %s, gym %s", 
-		dataID, paymentInfo.Status, gymSlug)
+// completeEvent marks a claimed webhook event as processed.
+// Notifications without an event key were never claimed.
+func (s *PaymentService) completeEvent(ctx context.Context, gymSlug, eventKey string) error {
+	if eventKey == "" {
+		return nil
+	}
+	return s.webhookEvents.CompleteEvent(ctx, gymSlug, eventKey)
+}
 
-	return nil
+// recordPayment stores a payment snapshot and records a status change when
+// the status differs from the last one seen, which it returns (nil when
+// unchanged). A change the payment state machine forbids, usually an
+// out-of-order notification, is recorded as rejected with its reason and
+// not applied: no snapshot is stored and nil is returned, so nothing is
+// notified. Ledger errors are returned so the surrounding transaction rolls
+// back and MP redelivers the notification. It must run in a transaction,
+// which holds the payment's lock until it ends.
+func (s *PaymentService) recordPayment(ctx context.Context, gymSlug string, info *domain.PaymentInfo) (*domain.StatusChange, error) {
+	// Concurrent notifications of the payment must not both see the
+	// previous status and notify the same transition
+	if err := s.repo.LockPayment(ctx, gymSlug, info.PaymentID); err != nil {
+		return nil, err
+	}
+
+	previousStatus := ""
+	previous, err := s.repo.GetLatestSnapshot(ctx, gymSlug, info.PaymentID)
+	switch {
+	case err == nil:
+		previousStatus = previous.Payment.Status
+	case !errors.Is(err, domain.ErrPaymentNotFound):
+		return nil, err
+	}
+
+	now := time.Now()
+	change := domain.StatusChange{
+		GymSlug:           gymSlug,
+		ExternalReference: info.ExternalReference,
+		PaymentID:         info.PaymentID,
+		FromStatus:        previousStatus,
+		ToStatus:          info.Status,
+		ChangedAt:         now,
+	}
+	if err := domain.CheckPaymentTransition(previousStatus, info.Status); err != nil {
+		log.Printf("Rejected status change of payment %s, gym %s: %v", info.PaymentID, gymSlug, err)
+		change.Rejected = true
+		change.Reason = err.Error()
+		return nil, s.repo.RecordStatusChange(ctx, change)
+	}
+
+	snapshot := domain.PaymentSnapshot{
+		GymSlug:   gymSlug,
+		Payment:   *info,
+		FetchedAt: now,
+	}
+	if err := s.repo.SavePaymentSnapshot(ctx, snapshot); err != nil {
+		return nil, err
+	}
+
+	if previousStatus == info.Status {
+		return nil, nil
+	}
+
+	if err := s.repo.RecordStatusChange(ctx, change); err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// publishChange pushes a recorded status change to live subscribers. Call
+// it once the transaction that recorded the change has committed.
+func (s *PaymentService) publishChange(ctx context.Context, change *domain.StatusChange, info *domain.PaymentInfo) {
+	if s.events == nil || change == nil {
+		return
+	}
+	event := statusEvent(change.GymSlug, info, change.FromStatus, change.ChangedAt)
+	if err := s.events.Publish(ctx, event); err != nil {
+		log.Printf("Failed to publish %s of payment %s, gym %s: %v", event.Event, info.PaymentID, change.GymSlug, err)
+	}
+}
+
+// statusEvent builds the live event of a payment reaching its status.
+func statusEvent(gymSlug string, info *domain.PaymentInfo, fromStatus string, at time.Time) domain.PaymentStatusEvent {
+	return domain.PaymentStatusEvent{
+		Event:             mapStatusToEvent(info.Status),
+		GymSlug:           gymSlug,
+		ExternalReference: info.ExternalReference,
+		PaymentID:         info.PaymentID,
+		FromStatus:        fromStatus,
+		Status:            info.Status,
+		StatusDetail:      info.StatusDetail,
+		Amount:            info.Amount,
+		Currency:          info.Currency,
+		OccurredAt:        at,
+	}
 }
 
 // mapStatusToEvent maps MP payment status to event name.
 func mapStatusToEvent(status string) string {
 	switch status {
-	case "approved":
+	case domain.PaymentApproved:
 		return "payment.approved"
-	case "pending", "in_process":
+	case domain.PaymentPending, domain.PaymentInProcess:
 		return "payment.pending"
-	case "rejected":
+	case domain.PaymentRejected:
 		return "payment.rejected"
-	case "cancelled":
+	case domain.PaymentCancelled:
 		return "payment.cancelled"
-	case "refunded":
+	case domain.PaymentRefunded:
 		return "payment.refunded"
+	case domain.PaymentChargedBack:
+		return "payment.charged_back"
 	default:
 		return "payment.updated"
 	}
@@ -0,0 +1,891 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// fakeGateway is a ports.PaymentGateway serving canned Mercado Pago resources.
+type fakeGateway struct {
+	ports.PaymentGateway
+	payments    map[string]domain.PaymentInfo
+	chargebacks map[string]domain.Chargeback
+	// searched is what SearchPayments pages through, oldest update first;
+	// payments without an update date match every range
+	searched  []domain.PaymentInfo
+	searchErr error
+	// beforeSearch runs before the search'th search, from 0
+	beforeSearch func(search int)
+	searches     int
+	// refunds are the amounts refunds were asked for, nil when in full
+	refunds   []*domain.Money
+	refundErr error
+	// cancelled are the payments cancellation was asked for
+	cancelled []string
+	cancelErr error
+}
+
+func (g *fakeGateway) GetPaymentInfo(_ context.Context, _ string, paymentID string) (*domain.PaymentInfo, error) {
+	info, ok := g.payments[paymentID]
+	if !ok {
+		return nil, domain.ErrPaymentNotFound
+	}
+	return &info, nil
+}
+
+// RefundPayment refunds a known payment, marking it refunded when in full.
+func (g *fakeGateway) RefundPayment(_ context.Context, _ string, paymentID string, amount *domain.Money) (*domain.RefundInfo, error) {
+	if g.refundErr != nil {
+		return nil, g.refundErr
+	}
+	info, ok := g.payments[paymentID]
+	if !ok {
+		return nil, domain.NewServiceError(domain.ErrPaymentNotFound, "payment not found", "MP_REFUND_ERROR")
+	}
+	g.refunds = append(g.refunds, amount)
+
+	refund := &domain.RefundInfo{RefundID: "r-1", PaymentID: paymentID, Status: "approved"}
+	if amount != nil {
+		refund.Amount = *amount
+	} else {
+		// MP does not report the currency of full refunds
+		refund.Amount = domain.NewMoney(info.Amount.Minor, "")
+		info.Status = domain.PaymentRefunded
+		g.payments[paymentID] = info
+	}
+	return refund, nil
+}
+
+// CancelPayment cancels a known payment whatever its status.
+func (g *fakeGateway) CancelPayment(_ context.Context, _ string, paymentID string) (*domain.PaymentInfo, error) {
+	g.cancelled = append(g.cancelled, paymentID)
+	if g.cancelErr != nil {
+		return nil, g.cancelErr
+	}
+	info, ok := g.payments[paymentID]
+	if !ok {
+		return nil, domain.ErrPaymentNotFound
+	}
+	info.Status = domain.PaymentCancelled
+	g.payments[paymentID] = info
+	return &info, nil
+}
+
+func (g *fakeGateway) GetChargeback(_ context.Context, _ string, chargebackID string) (*domain.Chargeback, error) {
+	chargeback, ok := g.chargebacks[chargebackID]
+	if !ok {
+		return nil, errors.New("chargeback not found")
+	}
+	return &chargeback, nil
+}
+
+func (g *fakeGateway) SearchPayments(_ context.Context, _ string, search domain.PaymentSearch) (*domain.PaymentPage, error) {
+	if g.beforeSearch != nil {
+		g.beforeSearch(g.searches)
+	}
+	g.searches++
+	if g.searchErr != nil {
+		return nil, g.searchErr
+	}
+
+	var matches []domain.PaymentInfo
+	for _, info := range g.searched {
+		updated := info.DateLastUpdated
+		if updated.IsZero() || !updated.Before(search.From) && !updated.After(search.To) {
+			matches = append(matches, info)
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b domain.PaymentInfo) int {
+		return a.DateLastUpdated.Compare(b.DateLastUpdated)
+	})
+	start := min(search.Offset, len(matches))
+	end := min(search.Offset+search.Limit, len(matches))
+	return &domain.PaymentPage{Payments: matches[start:end], Total: len(matches)}, nil
+}
+
+// staticCredentials is a ports.GymCredentialProvider knowing every gym.
+type staticCredentials struct{}
+
+func (staticCredentials) GetWebhookSecrets(context.Context, string) (domain.WebhookSecrets, error) {
+	return domain.WebhookSecrets{Current: "secret"}, nil
+}
+
+func (staticCredentials) GetAccessToken(context.Context, string) (string, error) {
+	return "APP_USR-123", nil
+}
+
+func (staticCredentials) GetCredentials(_ context.Context, gymSlug string) (domain.GymCredentials, error) {
+	return domain.GymCredentials{
+		GymSlug:        gymSlug,
+		WebhookSecrets: domain.WebhookSecrets{Current: "secret"},
+		AccessToken:    "APP_USR-123",
+	}, nil
+}
+
+// memoryTx is a ports.Transactor whose transactions hold the locks taken
+// with lockInTx until they end, like Postgres advisory locks. It does not
+// roll anything back.
+type memoryTx struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// memoryTxn is a transaction of a memoryTx, bound to the ctx passed to fn.
+type memoryTxn struct {
+	tx   *memoryTx
+	held map[string]*sync.Mutex
+}
+
+type memoryTxnKey struct{}
+
+func (t *memoryTx) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(memoryTxnKey{}).(*memoryTxn); ok {
+		return fn(ctx)
+	}
+	txn := &memoryTxn{tx: t, held: map[string]*sync.Mutex{}}
+	defer func() {
+		for _, lock := range txn.held {
+			lock.Unlock()
+		}
+	}()
+	return fn(context.WithValue(ctx, memoryTxnKey{}, txn))
+}
+
+// lockInTx locks key until the memoryTx transaction bound to ctx ends.
+func lockInTx(ctx context.Context, key string) error {
+	txn, ok := ctx.Value(memoryTxnKey{}).(*memoryTxn)
+	if !ok {
+		return errors.New("lock outside a transaction")
+	}
+	if _, ok := txn.held[key]; ok {
+		return nil
+	}
+
+	txn.tx.mu.Lock()
+	if txn.tx.locks == nil {
+		txn.tx.locks = map[string]*sync.Mutex{}
+	}
+	lock, ok := txn.tx.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		txn.tx.locks[key] = lock
+	}
+	txn.tx.mu.Unlock()
+
+	lock.Lock()
+	txn.held[key] = lock
+	return nil
+}
+
+// memoryLedger is an in-memory ports.PaymentRepository keeping the latest
+// snapshot of each payment.
+type memoryLedger struct {
+	ports.PaymentRepository
+	mu          sync.Mutex
+	snapshots   map[string]domain.PaymentSnapshot
+	changes     []domain.StatusChange
+	chargebacks map[string]domain.Chargeback
+	// readDelay delays returning snapshots, for concurrent writers to overlap
+	readDelay time.Duration
+}
+
+func newMemoryLedger() *memoryLedger {
+	return &memoryLedger{
+		snapshots:   map[string]domain.PaymentSnapshot{},
+		chargebacks: map[string]domain.Chargeback{},
+	}
+}
+
+func (l *memoryLedger) LockPayment(ctx context.Context, gymSlug, paymentID string) error {
+	return lockInTx(ctx, "payment:"+gymSlug+":"+paymentID)
+}
+
+func (l *memoryLedger) GetLatestSnapshot(_ context.Context, _ string, paymentID string) (*domain.PaymentSnapshot, error) {
+	l.mu.Lock()
+	s, ok := l.snapshots[paymentID]
+	l.mu.Unlock()
+	time.Sleep(l.readDelay)
+	if !ok {
+		return nil, domain.ErrPaymentNotFound
+	}
+	return &s, nil
+}
+
+func (l *memoryLedger) GetLatestSnapshotByReference(_ context.Context, _ string, externalReference string) (*domain.PaymentSnapshot, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.snapshots {
+		if s.Payment.ExternalReference == externalReference {
+			return &s, nil
+		}
+	}
+	return nil, domain.ErrPaymentNotFound
+}
+
+func (l *memoryLedger) SavePaymentSnapshot(_ context.Context, snapshot domain.PaymentSnapshot) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.snapshots[snapshot.Payment.PaymentID] = snapshot
+	return nil
+}
+
+func (l *memoryLedger) RecordStatusChange(_ context.Context, change domain.StatusChange) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.changes = append(l.changes, change)
+	return nil
+}
+
+func (l *memoryLedger) LockChargeback(ctx context.Context, gymSlug, chargebackID string) error {
+	return lockInTx(ctx, "chargeback:"+gymSlug+":"+chargebackID)
+}
+
+func (l *memoryLedger) SaveChargeback(_ context.Context, chargeback domain.Chargeback) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.chargebacks[chargeback.ChargebackID] = chargeback
+	return nil
+}
+
+func (l *memoryLedger) GetChargeback(_ context.Context, _ string, chargebackID string) (*domain.Chargeback, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	chargeback, ok := l.chargebacks[chargebackID]
+	if !ok {
+		return nil, domain.ErrChargebackNotFound
+	}
+	return &chargeback, nil
+}
+
+// memoryOutbox is an in-memory ports.OutboxRepository.
+type memoryOutbox struct {
+	ports.OutboxRepository
+	mu       sync.Mutex
+	messages []domain.OutboxMessage
+}
+
+func (o *memoryOutbox) Enqueue(_ context.Context, message domain.OutboxMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	message.ID = int64(len(o.messages) + 1)
+	if message.Status == "" {
+		message.Status = domain.OutboxPending
+	}
+	o.messages = append(o.messages, message)
+	return nil
+}
+
+func (o *memoryOutbox) LatestPaymentDelivery(_ context.Context, _ string, paymentID string) (*domain.OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if m := o.messages[i]; m.Payload != nil && m.Payload.PaymentID == paymentID {
+			return &m, nil
+		}
+	}
+	return nil, domain.ErrDeliveryNotFound
+}
+
+// events returns the events of the queued payment notifications.
+func (o *memoryOutbox) events() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var events []string
+	for _, m := range o.messages {
+		if m.Payload != nil {
+			events = append(events, m.Payload.Event)
+		}
+	}
+	return events
+}
+
+// memoryWebhookEvents is an in-memory ports.WebhookEventRepository.
+type memoryWebhookEvents struct {
+	mu        sync.Mutex
+	claimed   map[string]bool
+	completed map[string]bool
+}
+
+func (m *memoryWebhookEvents) ClaimEvent(_ context.Context, gymSlug, eventKey string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claimed == nil {
+		m.claimed = map[string]bool{}
+	}
+	if m.claimed[gymSlug+":"+eventKey] {
+		return false, nil
+	}
+	m.claimed[gymSlug+":"+eventKey] = true
+	return true, nil
+}
+
+func (m *memoryWebhookEvents) CompleteEvent(_ context.Context, gymSlug, eventKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.completed == nil {
+		m.completed = map[string]bool{}
+	}
+	m.completed[gymSlug+":"+eventKey] = true
+	return nil
+}
+
+func (m *memoryWebhookEvents) ReleaseEvent(_ context.Context, gymSlug, eventKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.claimed, gymSlug+":"+eventKey)
+	return nil
+}
+
+func TestProcessPaymentNotificationConcurrent(t *testing.T) {
+	pending := domain.PaymentInfo{PaymentID: "100", Status: domain.PaymentPending, ExternalReference: "ref-1",
+		Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+	approved := pending
+	approved.Status = domain.PaymentApproved
+
+	ledger := newMemoryLedger()
+	ledger.snapshots["100"] = domain.PaymentSnapshot{GymSlug: "level-gym", Payment: pending}
+	ledger.readDelay = 5 * time.Millisecond
+	outbox := &memoryOutbox{}
+	s := &PaymentService{
+		gateway:       &fakeGateway{payments: map[string]domain.PaymentInfo{"100": approved}},
+		credProvider:  staticCredentials{},
+		repo:          ledger,
+		webhookEvents: &memoryWebhookEvents{},
+		outbox:        outbox,
+		tx:            &memoryTx{},
+	}
+
+	// Notifications of the same payment under different event keys, such as
+	// payment.created and payment.updated, arrive at once
+	const notifications = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, notifications)
+	for i := range notifications {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.processPaymentNotification(context.Background(), "level-gym", "100", fmt.Sprintf("event-%d", i))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("processPaymentNotification: %v", err)
+		}
+	}
+
+	if events := outbox.events(); len(events) != 1 || events[0] != "payment.approved" {
+		t.Errorf("queued %v, want a single payment.approved", events)
+	}
+	if len(ledger.changes) != 1 {
+		t.Errorf("recorded %d status changes, want 1", len(ledger.changes))
+	}
+}
+
+func TestProcessChargebackNotification(t *testing.T) {
+	payment := domain.PaymentInfo{PaymentID: "100", Status: domain.PaymentChargedBack, ExternalReference: "ref-1",
+		Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+	chargeback := func(status string) domain.Chargeback {
+		return domain.Chargeback{ChargebackID: "cb-1", PaymentID: "100", Status: status,
+			Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+	}
+
+	tests := []struct {
+		name string
+		// previous is the recorded chargeback status, "" when never seen
+		previous string
+		current  string
+		want     []string
+	}{
+		{name: "opened", current: domain.ChargebackOpen, want: []string{"payment.chargeback_opened"}},
+		{name: "opened then resolved", previous: domain.ChargebackOpen, current: domain.ChargebackResolved,
+			want: []string{"payment.chargeback_resolved"}},
+		{name: "first seen resolved", current: domain.ChargebackResolved,
+			want: []string{"payment.chargeback_opened", "payment.chargeback_resolved"}},
+		{name: "open redelivered", previous: domain.ChargebackOpen, current: domain.ChargebackOpen},
+		{name: "resolved redelivered", previous: domain.ChargebackResolved, current: domain.ChargebackResolved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newMemoryLedger()
+			if tt.previous != "" {
+				ledger.chargebacks["cb-1"] = chargeback(tt.previous)
+			}
+			outbox := &memoryOutbox{}
+			events := &memoryWebhookEvents{}
+			s := &PaymentService{
+				gateway: &fakeGateway{
+					payments:    map[string]domain.PaymentInfo{"100": payment},
+					chargebacks: map[string]domain.Chargeback{"cb-1": chargeback(tt.current)},
+				},
+				credProvider:  staticCredentials{},
+				repo:          ledger,
+				webhookEvents: events,
+				outbox:        outbox,
+				tx:            &memoryTx{},
+			}
+
+			if err := s.processChargebackNotification(context.Background(), "level-gym", "cb-1", "chargebacks:cb-1"); err != nil {
+				t.Fatalf("processChargebackNotification: %v", err)
+			}
+
+			got := outbox.events()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("queued %v, want %v", got, tt.want)
+			}
+			for _, m := range outbox.messages {
+				if m.Payload.ExternalReference != "ref-1" || m.Payload.Chargeback == nil {
+					t.Errorf("payload = %+v, want the payment's reference and the chargeback", m.Payload)
+				}
+			}
+			if ledger.chargebacks["cb-1"].Status != tt.current {
+				t.Errorf("recorded status = %q, want %q", ledger.chargebacks["cb-1"].Status, tt.current)
+			}
+			if !events.completed["level-gym:chargebacks:cb-1"] {
+				t.Error("webhook event not completed")
+			}
+		})
+	}
+}
+
+// signatureValidator is a ports.WebhookValidator accepting only the
+// x-signature "valid".
+type signatureValidator struct{}
+
+func (signatureValidator) ValidateSignature(xSignature, _, _ string, _ []string) (int, bool) {
+	return 0, xSignature == "valid"
+}
+
+func TestProcessWebhookUnsignedIPN(t *testing.T) {
+	ipn := domain.WebhookNotification{Topic: domain.NotificationPayment, Resource: "https://api.mercadopago.com/v1/payments/100"}
+	webhook := domain.WebhookNotification{ID: 1, Type: domain.NotificationPayment}
+	webhook.Data.ID = "100"
+
+	tests := []struct {
+		name         string
+		notification domain.WebhookNotification
+		xSignature   string
+		allow        bool
+		wantErr      error
+	}{
+		{name: "unsigned IPN rejected by default", notification: ipn, wantErr: domain.ErrWebhookValidationFailed},
+		{name: "unsigned IPN accepted when allowed", notification: ipn, allow: true},
+		{name: "signed IPN", notification: ipn, xSignature: "valid"},
+		{name: "badly signed IPN rejected even when allowed", notification: ipn, xSignature: "forged", allow: true,
+			wantErr: domain.ErrWebhookValidationFailed},
+		{name: "unsigned webhook rejected even when allowed", notification: webhook, allow: true,
+			wantErr: domain.ErrWebhookValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approved := domain.PaymentInfo{PaymentID: "100", Status: domain.PaymentApproved, ExternalReference: "ref-1",
+				Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+			outbox := &memoryOutbox{}
+			s := &PaymentService{
+				gateway:          &fakeGateway{payments: map[string]domain.PaymentInfo{"100": approved}},
+				credProvider:     staticCredentials{},
+				repo:             newMemoryLedger(),
+				webhookValidator: signatureValidator{},
+				webhookEvents:    &memoryWebhookEvents{},
+				outbox:           outbox,
+				tx:               &memoryTx{},
+				settings:         NewGymSettingsResolver(&countingSettings{}, testGymDefaults, prefixSigner{}, false, 0),
+				allowUnsignedIPN: tt.allow,
+			}
+
+			err := s.ProcessWebhook(context.Background(), "level-gym", tt.notification, tt.xSignature, "req-1", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProcessWebhook() error = %v, want %v", err, tt.wantErr)
+			}
+			wantEvents := []string{"payment.approved"}
+			if tt.wantErr != nil {
+				wantEvents = nil
+			}
+			if got := outbox.events(); !slices.Equal(got, wantEvents) {
+				t.Errorf("queued %v, want %v", got, wantEvents)
+			}
+		})
+	}
+}
+
+func TestPaymentServiceRefundPayment(t *testing.T) {
+	partial := domain.NewMoney(50000, "")
+	zero := domain.NewMoney(0, "")
+
+	tests := []struct {
+		name      string
+		paymentID string
+		amount    *domain.Money
+		refundErr error
+		wantCode  string
+		// wantAmount is the refunded amount reported back
+		wantAmount domain.Money
+		wantEvents []string
+	}{
+		{name: "in full", paymentID: "100", wantAmount: domain.NewMoney(1500000, "ARS"),
+			wantEvents: []string{"payment.refunded"}},
+		{name: "partially", paymentID: "100", amount: &partial, wantAmount: domain.NewMoney(50000, "ARS")},
+		{name: "zero amount", paymentID: "100", amount: &zero, wantCode: "VALIDATION_ERROR"},
+		{name: "unknown payment in full", paymentID: "404", wantCode: "PAYMENT_NOT_FOUND"},
+		{name: "unknown payment partially", paymentID: "404", amount: &partial, wantCode: "PAYMENT_NOT_FOUND"},
+		{name: "rejected by Mercado Pago", paymentID: "100",
+			refundErr: domain.NewServiceError(domain.ErrInvalidRequest, "amount exceeds the payment", "MP_REFUND_ERROR"),
+			wantCode:  "REFUND_REJECTED"},
+		{name: "gateway failure", paymentID: "100",
+			refundErr: domain.NewServiceError(domain.ErrPaymentGatewayError, "timeout", "MP_REFUND_ERROR"),
+			wantCode:  "GATEWAY_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approved := domain.PaymentInfo{PaymentID: "100", Status: domain.PaymentApproved, ExternalReference: "ref-1",
+				Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+			gateway := &fakeGateway{payments: map[string]domain.PaymentInfo{"100": approved}, refundErr: tt.refundErr}
+			ledger := newMemoryLedger()
+			ledger.snapshots["100"] = domain.PaymentSnapshot{GymSlug: "level-gym", Payment: approved}
+			outbox := &memoryOutbox{}
+			s := &PaymentService{
+				gateway: gateway,
+				tokens:  NewAccessTokenResolver(staticCredentials{}, false),
+				repo:    ledger,
+				outbox:  outbox,
+				tx:      &memoryTx{},
+			}
+
+			resp, err := s.RefundPayment(context.Background(), tt.paymentID,
+				domain.RefundRequest{GymSlug: "level-gym", Amount: tt.amount})
+			if err != nil {
+				t.Fatalf("RefundPayment: %v", err)
+			}
+			if resp.ErrorCode != tt.wantCode {
+				t.Fatalf("error code = %q (%s), want %q", resp.ErrorCode, resp.Error, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				if len(gateway.refunds) != 0 {
+					t.Errorf("refunds asked = %v, want none", gateway.refunds)
+				}
+				return
+			}
+
+			if !resp.Refund.Amount.Equal(tt.wantAmount) {
+				t.Errorf("refunded %s %s, want %s %s", resp.Refund.Amount, resp.Refund.Amount.Currency,
+					tt.wantAmount, tt.wantAmount.Currency)
+			}
+			// Partial refunds are asked for in the payment's currency
+			if asked := gateway.refunds[0]; tt.amount != nil && (asked == nil || asked.Currency != "ARS") {
+				t.Errorf("refund asked for %v, want an amount in ARS", asked)
+			}
+			// The ledger is refreshed without waiting for MP's webhook
+			if got := outbox.events(); !slices.Equal(got, tt.wantEvents) {
+				t.Errorf("queued %v, want %v", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestPaymentServiceCancelPayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		paymentID  string
+		status     string
+		cancelErr  error
+		wantCode   string
+		wantCancel bool
+	}{
+		{name: "pending", paymentID: "100", status: domain.PaymentPending, wantCancel: true},
+		{name: "in process", paymentID: "100", status: domain.PaymentInProcess, wantCancel: true},
+		{name: "approved", paymentID: "100", status: domain.PaymentApproved, wantCode: "PAYMENT_NOT_CANCELLABLE"},
+		{name: "unknown payment", paymentID: "404", status: domain.PaymentPending, wantCode: "PAYMENT_NOT_FOUND"},
+		{name: "rejected by Mercado Pago", paymentID: "100", status: domain.PaymentPending, wantCancel: true,
+			cancelErr: domain.NewServiceError(domain.ErrInvalidRequest, "payment already captured", "MP_CANCEL_ERROR"),
+			wantCode:  "PAYMENT_NOT_CANCELLABLE"},
+		{name: "gateway failure", paymentID: "100", status: domain.PaymentPending, wantCancel: true,
+			cancelErr: domain.NewServiceError(domain.ErrPaymentGatewayError, "timeout", "MP_CANCEL_ERROR"),
+			wantCode:  "GATEWAY_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := domain.PaymentInfo{PaymentID: "100", Status: tt.status, ExternalReference: "ref-1",
+				Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+			gateway := &fakeGateway{payments: map[string]domain.PaymentInfo{"100": payment}, cancelErr: tt.cancelErr}
+			ledger := newMemoryLedger()
+			ledger.snapshots["100"] = domain.PaymentSnapshot{GymSlug: "level-gym", Payment: payment}
+			outbox := &memoryOutbox{}
+			s := &PaymentService{
+				gateway: gateway,
+				tokens:  NewAccessTokenResolver(staticCredentials{}, false),
+				repo:    ledger,
+				outbox:  outbox,
+				tx:      &memoryTx{},
+			}
+
+			resp, err := s.CancelPayment(context.Background(), tt.paymentID, domain.CancelRequest{GymSlug: "level-gym"})
+			if err != nil {
+				t.Fatalf("CancelPayment: %v", err)
+			}
+			if resp.ErrorCode != tt.wantCode {
+				t.Fatalf("error code = %q (%s), want %q", resp.ErrorCode, resp.Error, tt.wantCode)
+			}
+			if cancelled := len(gateway.cancelled) > 0; cancelled != tt.wantCancel {
+				t.Errorf("cancellation asked: %t, want %t", cancelled, tt.wantCancel)
+			}
+			if tt.wantCode != "" {
+				if got := ledger.snapshots["100"].Payment.Status; got != tt.status {
+					t.Errorf("ledger status = %q, want %q", got, tt.status)
+				}
+				return
+			}
+
+			if resp.Payment.Status != domain.PaymentCancelled {
+				t.Errorf("payment status = %q, want cancelled", resp.Payment.Status)
+			}
+			// Django hears of the cancellation without waiting for MP's webhook
+			if got := ledger.snapshots["100"].Payment.Status; got != domain.PaymentCancelled {
+				t.Errorf("ledger status = %q, want cancelled", got)
+			}
+			if got, want := outbox.events(), []string{mapStatusToEvent(domain.PaymentCancelled)}; !slices.Equal(got, want) {
+				t.Errorf("queued %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateCheckout(t *testing.T) {
+	item := domain.CheckoutItem{Title: "Pack 10 clases", Quantity: 2, UnitPrice: domain.Money{Minor: 750000}}
+
+	tests := []struct {
+		name  string
+		req   domain.PaymentRequest
+		valid bool
+	}{
+		{name: "single item", req: domain.PaymentRequest{GymSlug: "level-gym", Title: "Pase libre",
+			Amount: domain.Money{Minor: 1500000}}, valid: true},
+		{name: "items", req: domain.PaymentRequest{GymSlug: "level-gym",
+			Items: []domain.CheckoutItem{item, {Title: "Toalla", Quantity: 1, UnitPrice: domain.Money{Minor: 250000}}}},
+			valid: true},
+		{name: "no gym", req: domain.PaymentRequest{Title: "Pase libre", Amount: domain.Money{Minor: 1500000}}},
+		{name: "neither items nor amount", req: domain.PaymentRequest{GymSlug: "level-gym", Title: "Pase libre"}},
+		{name: "item without title", req: domain.PaymentRequest{GymSlug: "level-gym",
+			Items: []domain.CheckoutItem{{Quantity: 1, UnitPrice: domain.Money{Minor: 250000}}}}},
+		{name: "item without quantity", req: domain.PaymentRequest{GymSlug: "level-gym",
+			Items: []domain.CheckoutItem{{Title: "Toalla", UnitPrice: domain.Money{Minor: 250000}}}}},
+		{name: "item without price", req: domain.PaymentRequest{GymSlug: "level-gym",
+			Items: []domain.CheckoutItem{{Title: "Toalla", Quantity: 1}}}},
+		{name: "quantity too large", req: domain.PaymentRequest{GymSlug: "level-gym",
+			Items: []domain.CheckoutItem{{Title: "Toalla", Quantity: domain.MaxItemQuantity + 1,
+				UnitPrice: domain.Money{Minor: 250000}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg := validateCheckout(tt.req); (msg == "") != tt.valid {
+				t.Errorf("validateCheckout() = %q, want valid %t", msg, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCheckoutAmounts(t *testing.T) {
+	items := []domain.CheckoutItem{
+		{Title: "Pack 10 clases", Quantity: 2, UnitPrice: domain.Money{Minor: 750000}},
+		{Title: "Toalla", Quantity: 1, UnitPrice: domain.Money{Minor: 250050}},
+	}
+
+	tests := []struct {
+		name      string
+		req       domain.PaymentRequest
+		want      domain.Money
+		wantItems int
+		wantErr   bool
+	}{
+		{name: "single item", req: domain.PaymentRequest{Currency: "ARS", Title: "Pase libre",
+			Amount: domain.Money{Minor: 1500000}}, want: domain.NewMoney(1500000, "ARS"), wantItems: 1},
+		{name: "items times their quantities", req: domain.PaymentRequest{Currency: "ARS", Items: items},
+			want: domain.NewMoney(1750050, "ARS"), wantItems: 2},
+		{name: "amount matching the items", req: domain.PaymentRequest{Currency: "ARS", Items: items,
+			Amount: domain.Money{Minor: 1750050}}, want: domain.NewMoney(1750050, "ARS"), wantItems: 2},
+		{name: "amount not matching the items", req: domain.PaymentRequest{Currency: "ARS", Items: items,
+			Amount: domain.Money{Minor: 1500000}}, wantErr: true},
+		{name: "price with decimals the currency lacks", req: domain.PaymentRequest{Currency: "CLP", Items: items},
+			wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotItems, total, msg := checkoutAmounts(tt.req)
+			if (msg != "") != tt.wantErr {
+				t.Fatalf("checkoutAmounts() message = %q, want error %t", msg, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !total.Equal(tt.want) {
+				t.Errorf("total = %s %s, want %s %s", total, total.Currency, tt.want, tt.want.Currency)
+			}
+			if len(gotItems) != tt.wantItems {
+				t.Errorf("%d items, want %d", len(gotItems), tt.wantItems)
+			}
+			for _, item := range gotItems {
+				if item.UnitPrice.Currency != tt.want.Currency {
+					t.Errorf("item %q priced in %q, want %q", item.Title, item.UnitPrice.Currency, tt.want.Currency)
+				}
+			}
+		})
+	}
+}
+
+// secretValidator is a ports.WebhookValidator accepting an x-signature
+// "signed:<secret>" for any of the secrets.
+type secretValidator struct{}
+
+func (secretValidator) ValidateSignature(xSignature, _, _ string, secrets []string) (int, bool) {
+	for i, secret := range secrets {
+		if xSignature == "signed:"+secret {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// rotatingCredentials is a ports.GymCredentialProvider answering every gym
+// with secrets.
+type rotatingCredentials struct {
+	ports.GymCredentialProvider
+	secrets domain.WebhookSecrets
+}
+
+func (p rotatingCredentials) GetWebhookSecrets(context.Context, string) (domain.WebhookSecrets, error) {
+	return p.secrets, nil
+}
+
+func TestValidateWebhookSignature(t *testing.T) {
+	rotating := domain.WebhookSecrets{Current: "new", Previous: "old", PreviousExpiresAt: time.Now().Add(time.Hour)}
+	rotated := domain.WebhookSecrets{Current: "new", Previous: "old", PreviousExpiresAt: time.Now().Add(-time.Hour)}
+
+	tests := []struct {
+		name       string
+		secrets    domain.WebhookSecrets
+		xSignature string
+		wantErr    error
+	}{
+		{name: "current secret", secrets: rotating, xSignature: "signed:new"},
+		{name: "previous secret in its grace period", secrets: rotating, xSignature: "signed:old"},
+		{name: "previous secret after its grace period", secrets: rotated, xSignature: "signed:old",
+			wantErr: domain.ErrWebhookValidationFailed},
+		{name: "unknown secret", secrets: rotating, xSignature: "signed:other", wantErr: domain.ErrWebhookValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &PaymentService{
+				credProvider:     rotatingCredentials{secrets: tt.secrets},
+				webhookValidator: secretValidator{},
+			}
+
+			err := s.validateWebhookSignature(context.Background(), "level-gym", "100", tt.xSignature, "req-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("validateWebhookSignature() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPaymentServiceGetPaymentStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		// recorded and inMP are the payment's status in the ledger and in
+		// Mercado Pago, "" when unknown there
+		recorded    string
+		inMP        string
+		byReference bool
+		refresh     bool
+		wantCode    string
+		wantStatus  string
+		wantFresh   bool
+	}{
+		{name: "recorded", recorded: domain.PaymentPending, inMP: domain.PaymentApproved, byReference: true,
+			wantStatus: domain.PaymentPending},
+		{name: "unknown reference", inMP: domain.PaymentApproved, byReference: true, refresh: true,
+			wantCode: "PAYMENT_NOT_FOUND"},
+		{name: "refreshed by reference", recorded: domain.PaymentPending, inMP: domain.PaymentApproved,
+			byReference: true, refresh: true, wantStatus: domain.PaymentApproved, wantFresh: true},
+		{name: "not recorded", inMP: domain.PaymentApproved, wantCode: "PAYMENT_NOT_FOUND"},
+		{name: "not recorded yet, refreshed", inMP: domain.PaymentApproved, refresh: true,
+			wantStatus: domain.PaymentApproved, wantFresh: true},
+		{name: "unknown to Mercado Pago", refresh: true, wantCode: "PAYMENT_NOT_FOUND"},
+		{name: "failed refresh falls back to the ledger", recorded: domain.PaymentPending, refresh: true,
+			wantStatus: domain.PaymentPending},
+		{name: "stale refresh falls back to the ledger", recorded: domain.PaymentApproved, inMP: domain.PaymentPending,
+			refresh: true, wantStatus: domain.PaymentApproved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := func(status string) domain.PaymentInfo {
+				return domain.PaymentInfo{PaymentID: "100", Status: status, ExternalReference: "ref-1",
+					Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+			}
+			gateway := &fakeGateway{payments: map[string]domain.PaymentInfo{}}
+			if tt.inMP != "" {
+				gateway.payments["100"] = payment(tt.inMP)
+			}
+			ledger := newMemoryLedger()
+			if tt.recorded != "" {
+				ledger.snapshots["100"] = domain.PaymentSnapshot{GymSlug: "level-gym", Payment: payment(tt.recorded)}
+			}
+			outbox := &memoryOutbox{}
+			s := &PaymentService{
+				gateway: gateway,
+				tokens:  NewAccessTokenResolver(staticCredentials{}, false),
+				repo:    ledger,
+				outbox:  outbox,
+				tx:      &memoryTx{},
+			}
+
+			var resp *domain.PaymentStatusResponse
+			var err error
+			if tt.byReference {
+				resp, err = s.GetPaymentStatus(context.Background(), "level-gym", "ref-1", tt.refresh)
+			} else {
+				resp, err = s.GetPaymentStatusByID(context.Background(), "level-gym", "100", tt.refresh)
+			}
+			if err != nil {
+				t.Fatalf("GetPaymentStatus: %v", err)
+			}
+			if resp.ErrorCode != tt.wantCode {
+				t.Fatalf("error code = %q (%s), want %q", resp.ErrorCode, resp.Error, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				return
+			}
+
+			if resp.Payment.Status != tt.wantStatus || resp.Refreshed != tt.wantFresh {
+				t.Errorf("status %q refreshed %t, want %q refreshed %t",
+					resp.Payment.Status, resp.Refreshed, tt.wantStatus, tt.wantFresh)
+			}
+			// A refresh moving the payment forward is recorded and notified
+			var wantEvents []string
+			if tt.wantFresh {
+				wantEvents = []string{mapStatusToEvent(tt.wantStatus)}
+			}
+			if got := outbox.events(); !slices.Equal(got, wantEvents) {
+				t.Errorf("queued %v, want %v", got, wantEvents)
+			}
+			if got := ledger.snapshots["100"].Payment.Status; got != tt.wantStatus {
+				t.Errorf("ledger status = %q, want %q", got, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// reconcilerPollInterval is how often the reconciler looks for due gyms.
+const reconcilerPollInterval = time.Minute
+
+// Reconciler reconciles every gym with Mercado Pago in the background.
+type Reconciler struct {
+	service   *ReconciliationService
+	interval  time.Duration
+	batchSize int
+}
+
+// NewReconciler creates a new reconciliation worker. Each gym is reconciled
+// every interval, batchSize gyms at a time.
+func NewReconciler(svc *ReconciliationService, interval time.Duration, batchSize int) *Reconciler {
+	return &Reconciler{
+		service:   svc,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run reconciles due gyms until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	log.Printf("Reconciler started (every %s per gym, looking back %s)", r.interval, r.service.window)
+
+	ticker := time.NewTicker(reconcilerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.reconcileDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Reconciler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileDue reconciles due gyms batch by batch until none are left.
+func (r *Reconciler) reconcileDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimed, err := r.service.ReconcileDue(ctx, r.batchSize, r.interval)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Reconciler: failed to claim due gyms: %v", err)
+			}
+			return
+		}
+		if claimed < r.batchSize {
+			return
+		}
+	}
+}
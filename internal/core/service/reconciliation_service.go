@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// maxReconciliationWindow caps the range of an on-demand reconciliation.
+const maxReconciliationWindow = 31 * 24 * time.Hour
+
+// ReconciliationService compares gyms' Mercado Pago payments with the
+// ledger, notifies Django of what webhooks missed and reports the rest.
+type ReconciliationService struct {
+	gateway      ports.PaymentGateway
+	credProvider ports.GymCredentialProvider
+	payments     *PaymentService
+	repo         ports.PaymentRepository
+	outbox       ports.OutboxRepository
+	reports      ports.ReconciliationRepository
+	// window is how far back a run looks for updated payments
+	window   time.Duration
+	pageSize int
+	now      func() time.Time
+}
+
+// NewReconciliationService creates a new reconciliation service. Runs look
+// at payments updated within window, searched pageSize at a time.
+func NewReconciliationService(
+	gateway ports.PaymentGateway,
+	credProvider ports.GymCredentialProvider,
+	payments *PaymentService,
+	repo ports.PaymentRepository,
+	outbox ports.OutboxRepository,
+	reports ports.ReconciliationRepository,
+	window time.Duration,
+	pageSize int,
+) *ReconciliationService {
+	return &ReconciliationService{
+		gateway:      gateway,
+		credProvider: credProvider,
+		payments:     payments,
+		repo:         repo,
+		outbox:       outbox,
+		reports:      reports,
+		window:       window,
+		pageSize:     pageSize,
+		now:          time.Now,
+	}
+}
+
+// ReconcileDue reconciles up to limit gyms that are due, over the sliding
+// window, and returns how many it claimed.
+func (s *ReconciliationService) ReconcileDue(ctx context.Context, limit int, interval time.Duration) (int, error) {
+	gyms, err := s.reports.ClaimDueGyms(ctx, limit, interval)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, gymSlug := range gyms {
+		to := s.now()
+		if _, err := s.Reconcile(ctx, gymSlug, to.Add(-s.window), to); err != nil {
+			log.Printf("Reconciliation: failed to save report of gym %s: %v", gymSlug, err)
+		}
+	}
+	return len(gyms), nil
+}
+
+// ReconcileGym reconciles a gym on demand. Zero times default to the
+// sliding window ending now.
+func (s *ReconciliationService) ReconcileGym(ctx context.Context, gymSlug string, from, to time.Time) (*domain.ReconciliationReport, error) {
+	if to.IsZero() {
+		to = s.now()
+	}
+	if from.IsZero() {
+		from = to.Add(-s.window)
+	}
+	if !from.Before(to) {
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest,
+			"from must be before to", "VALIDATION_ERROR")
+	}
+	if to.Sub(from) > maxReconciliationWindow {
+		return nil, domain.NewServiceError(domain.ErrInvalidRequest,
+			"range must not exceed 31 days", "VALIDATION_ERROR")
+	}
+
+	return s.Reconcile(ctx, gymSlug, from, to)
+}
+
+// Reconcile compares the gym's payments updated between from and to with
+// the ledger and stores the report. A run that fails midway is reported
+// with its error; err is only set when the report could not be saved.
+func (s *ReconciliationService) Reconcile(ctx context.Context, gymSlug string, from, to time.Time) (*domain.ReconciliationReport, error) {
+	report := &domain.ReconciliationReport{
+		GymSlug:       gymSlug,
+		From:          from,
+		To:            to,
+		Discrepancies: []domain.Discrepancy{},
+		StartedAt:     s.now(),
+	}
+
+	if err := s.reconcile(ctx, report); err != nil {
+		log.Printf("Reconciliation of gym %s stopped after %d payments: %v", gymSlug, report.Checked, err)
+		report.Error = err.Error()
+	}
+	report.FinishedAt = s.now()
+
+	if err := s.reports.SaveReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Reconciliation of gym %s: %d payments checked, %d discrepancies (report %d)",
+		gymSlug, report.Checked, len(report.Discrepancies), report.ID)
+	return report, nil
+}
+
+// reconcile pages through the gym's payments and checks each of them.
+//
+// Payments updated during the run move to the end of the range, so pages
+// are not taken by offset, which would skip whatever slid into an earlier
+// page: each page starts at the last update seen so far, and payments seen
+// on a previous page are skipped.
+func (s *ReconciliationService) reconcile(ctx context.Context, report *domain.ReconciliationReport) error {
+	accessToken, err := s.credProvider.GetAccessToken(ctx, report.GymSlug)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	cursor, offset := report.From, 0
+	for {
+		page, err := s.gateway.SearchPayments(ctx, accessToken, domain.PaymentSearch{
+			Field:  domain.PaymentSearchUpdated,
+			From:   cursor,
+			To:     report.To,
+			Offset: offset,
+			Limit:  s.pageSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		for i := range page.Payments {
+			info := &page.Payments[i]
+			if seen[info.PaymentID] {
+				continue
+			}
+			seen[info.PaymentID] = true
+			// Payments not made through a FitStack checkout are none of Django's business
+			if info.ExternalReference == "" {
+				continue
+			}
+			discrepancy, err := s.check(ctx, report.GymSlug, info)
+			if err != nil {
+				return err
+			}
+			report.Checked++
+			if discrepancy != nil {
+				report.Discrepancies = append(report.Discrepancies, *discrepancy)
+			}
+		}
+
+		if len(page.Payments) == 0 || offset+len(page.Payments) >= page.Total {
+			return nil
+		}
+		// MP searches by the millisecond; a page updated all within one
+		// millisecond can only be moved past by offset
+		last := page.Payments[len(page.Payments)-1].DateLastUpdated.Truncate(time.Millisecond)
+		if last.After(cursor) {
+			cursor, offset = last, 0
+		} else {
+			offset += len(page.Payments)
+		}
+	}
+}
+
+// check compares a payment with the ledger and repairs what it can: a
+// missing payment or a status that moved forward is recorded and Django
+// notified, exactly as the webhook would have. Conflicts and dead
+// notifications are only reported. It returns nil when all is well.
+func (s *ReconciliationService) check(ctx context.Context, gymSlug string, info *domain.PaymentInfo) (*domain.Discrepancy, error) {
+	discrepancy := &domain.Discrepancy{
+		PaymentID:         info.PaymentID,
+		ExternalReference: info.ExternalReference,
+		MPStatus:          info.Status,
+		Amount:            info.Amount,
+		Currency:          info.Currency,
+	}
+
+	recorded, err := s.repo.GetLatestSnapshot(ctx, gymSlug, info.PaymentID)
+	switch {
+	case errors.Is(err, domain.ErrPaymentNotFound):
+		discrepancy.Kind = domain.DiscrepancyMissing
+	case err != nil:
+		return nil, err
+	case recorded.Payment.Status == info.Status:
+		return s.checkDelivery(ctx, gymSlug, discrepancy)
+	default:
+		discrepancy.RecordedStatus = recorded.Payment.Status
+		if err := domain.CheckPaymentTransition(recorded.Payment.Status, info.Status); err != nil {
+			discrepancy.Kind = domain.DiscrepancyConflict
+			discrepancy.Action = domain.ReconcileFlagged
+			discrepancy.Detail = err.Error()
+			return discrepancy, nil
+		}
+		discrepancy.Kind = domain.DiscrepancyStatusMismatch
+	}
+
+	change, err := s.payments.applyPayment(ctx, gymSlug, info)
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		// A webhook recorded it in the meantime
+		return nil, nil
+	}
+	discrepancy.Action = domain.ReconcileNotified
+	discrepancy.Detail = "queued " + mapStatusToEvent(info.Status)
+	return discrepancy, nil
+}
+
+// checkDelivery reports a recorded payment whose last Django notification
+// was dead-lettered. Payments recorded without a notification, such as
+// backfilled ones, are fine.
+func (s *ReconciliationService) checkDelivery(ctx context.Context, gymSlug string, discrepancy *domain.Discrepancy) (*domain.Discrepancy, error) {
+	delivery, err := s.outbox.LatestPaymentDelivery(ctx, gymSlug, discrepancy.PaymentID)
+	switch {
+	case errors.Is(err, domain.ErrDeliveryNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case delivery.Status != domain.OutboxDead:
+		return nil, nil
+	}
+
+	discrepancy.Kind = domain.DiscrepancyUndelivered
+	discrepancy.RecordedStatus = discrepancy.MPStatus
+	discrepancy.Action = domain.ReconcileFlagged
+	discrepancy.Detail = fmt.Sprintf("delivery %d of %s is dead: %s", delivery.ID, delivery.Payload.Event, delivery.LastError)
+	return discrepancy, nil
+}
+
+// ListReports returns reconciliation reports matching the filter.
+func (s *ReconciliationService) ListReports(ctx context.Context, filter domain.ReconciliationFilter) ([]domain.ReconciliationReport, error) {
+	return s.reports.ListReports(ctx, filter)
+}
+
+// GetReport returns a reconciliation report.
+func (s *ReconciliationService) GetReport(ctx context.Context, id int64) (*domain.ReconciliationReport, error) {
+	return s.reports.GetReport(ctx, id)
+}
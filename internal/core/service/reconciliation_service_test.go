@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// memoryReports is an in-memory ports.ReconciliationRepository.
+type memoryReports struct {
+	ports.ReconciliationRepository
+	saved []domain.ReconciliationReport
+}
+
+func (r *memoryReports) SaveReport(_ context.Context, report *domain.ReconciliationReport) error {
+	report.ID = int64(len(r.saved) + 1)
+	r.saved = append(r.saved, *report)
+	return nil
+}
+
+func TestReconciliationServiceReconcile(t *testing.T) {
+	approved := domain.PaymentInfo{PaymentID: "100", Status: domain.PaymentApproved, ExternalReference: "ref-1",
+		Amount: domain.NewMoney(1500000, "ARS"), Currency: "ARS"}
+	withStatus := func(info domain.PaymentInfo, status string) domain.PaymentInfo {
+		info.Status = status
+		return info
+	}
+
+	tests := []struct {
+		name       string
+		mp         []domain.PaymentInfo
+		recorded   []domain.PaymentInfo
+		deliveries []domain.OutboxMessage
+		searchErr  error
+		// wantKind and wantAction describe the single expected discrepancy
+		wantKind    string
+		wantAction  string
+		wantChecked int
+		wantQueued  string
+		wantErr     bool
+	}{
+		{
+			name:        "in sync",
+			mp:          []domain.PaymentInfo{approved},
+			recorded:    []domain.PaymentInfo{approved},
+			deliveries:  []domain.OutboxMessage{{Status: domain.OutboxDelivered, Payload: &domain.DjangoWebhookPayload{PaymentID: "100"}}},
+			wantChecked: 1,
+		},
+		{
+			name:        "recorded without notification",
+			mp:          []domain.PaymentInfo{approved},
+			recorded:    []domain.PaymentInfo{approved},
+			wantChecked: 1,
+		},
+		{
+			name:        "missed by webhooks",
+			mp:          []domain.PaymentInfo{approved},
+			wantKind:    domain.DiscrepancyMissing,
+			wantAction:  domain.ReconcileNotified,
+			wantChecked: 1,
+			wantQueued:  "payment.approved",
+		},
+		{
+			name:        "status moved forward",
+			mp:          []domain.PaymentInfo{withStatus(approved, domain.PaymentRefunded)},
+			recorded:    []domain.PaymentInfo{approved},
+			wantKind:    domain.DiscrepancyStatusMismatch,
+			wantAction:  domain.ReconcileNotified,
+			wantChecked: 1,
+			wantQueued:  "payment.refunded",
+		},
+		{
+			name:        "conflicting status",
+			mp:          []domain.PaymentInfo{withStatus(approved, domain.PaymentPending)},
+			recorded:    []domain.PaymentInfo{approved},
+			wantKind:    domain.DiscrepancyConflict,
+			wantAction:  domain.ReconcileFlagged,
+			wantChecked: 1,
+		},
+		{
+			name:        "dead notification",
+			mp:          []domain.PaymentInfo{approved},
+			recorded:    []domain.PaymentInfo{approved},
+			deliveries:  []domain.OutboxMessage{{Status: domain.OutboxDead, Payload: &domain.DjangoWebhookPayload{PaymentID: "100", Event: "payment.approved"}}},
+			wantKind:    domain.DiscrepancyUndelivered,
+			wantAction:  domain.ReconcileFlagged,
+			wantChecked: 1,
+		},
+		{
+			name: "payment without external reference",
+			mp:   []domain.PaymentInfo{{PaymentID: "200", Status: domain.PaymentApproved, Currency: "ARS"}},
+		},
+		{
+			name:      "search failed",
+			searchErr: errors.New("MP unavailable"),
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newMemoryLedger()
+			for _, info := range tt.recorded {
+				ledger.snapshots[info.PaymentID] = domain.PaymentSnapshot{GymSlug: "level-gym", Payment: info}
+			}
+			outbox := &memoryOutbox{messages: tt.deliveries}
+			queuedBefore := len(outbox.messages)
+			reports := &memoryReports{}
+			payments := &PaymentService{repo: ledger, outbox: outbox, tx: &memoryTx{}}
+			s := NewReconciliationService(&fakeGateway{searched: tt.mp, searchErr: tt.searchErr}, staticCredentials{},
+				payments, ledger, outbox, reports, 24*time.Hour, 50)
+
+			to := time.Now()
+			report, err := s.Reconcile(context.Background(), "level-gym", to.Add(-time.Hour), to)
+			if err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+			if len(reports.saved) != 1 {
+				t.Fatalf("saved %d reports, want 1", len(reports.saved))
+			}
+			if (report.Error != "") != tt.wantErr {
+				t.Errorf("report error = %q, want error %v", report.Error, tt.wantErr)
+			}
+			if report.Checked != tt.wantChecked {
+				t.Errorf("checked = %d, want %d", report.Checked, tt.wantChecked)
+			}
+
+			switch {
+			case tt.wantKind == "" && len(report.Discrepancies) != 0:
+				t.Errorf("discrepancies = %+v, want none", report.Discrepancies)
+			case tt.wantKind != "" && (len(report.Discrepancies) != 1 ||
+				report.Discrepancies[0].Kind != tt.wantKind || report.Discrepancies[0].Action != tt.wantAction):
+				t.Errorf("discrepancies = %+v, want one %s, %s", report.Discrepancies, tt.wantKind, tt.wantAction)
+			}
+
+			queued := outbox.messages[queuedBefore:]
+			switch {
+			case tt.wantQueued == "" && len(queued) != 0:
+				t.Errorf("queued %+v, want nothing", queued)
+			case tt.wantQueued != "" && (len(queued) != 1 || queued[0].Payload.Event != tt.wantQueued):
+				t.Errorf("queued %+v, want %s", queued, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestReconciliationServicePaging(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	payments := func(updated func(i int) time.Time) []domain.PaymentInfo {
+		var mp []domain.PaymentInfo
+		for i, id := range strings.Fields("1 2 3 4 5 6 7") {
+			mp = append(mp, domain.PaymentInfo{PaymentID: id, Status: domain.PaymentApproved,
+				ExternalReference: "ref-" + id, Currency: "ARS", DateLastUpdated: updated(i)})
+		}
+		return mp
+	}
+	hourly := func(i int) time.Time { return now.Add(time.Duration(i-10) * time.Hour) }
+
+	tests := []struct {
+		name     string
+		searched []domain.PaymentInfo
+		// beforeSearch may change searched between pages
+		beforeSearch func(searched []domain.PaymentInfo, search int)
+	}{
+		{
+			name:     "undated",
+			searched: payments(func(int) time.Time { return time.Time{} }),
+		},
+		{
+			name:     "updated one after another",
+			searched: payments(hourly),
+		},
+		{
+			name:     "seen payment updated during the run",
+			searched: payments(hourly),
+			beforeSearch: func(searched []domain.PaymentInfo, search int) {
+				if search == 1 {
+					searched[1].DateLastUpdated = now.Add(-time.Minute)
+				}
+			},
+		},
+		{
+			name:     "updated within one millisecond",
+			searched: payments(func(int) time.Time { return now.Add(-time.Hour + 300*time.Microsecond) }),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &fakeGateway{searched: tt.searched}
+			if tt.beforeSearch != nil {
+				gateway.beforeSearch = func(search int) { tt.beforeSearch(gateway.searched, search) }
+			}
+			ledger := newMemoryLedger()
+			outbox := &memoryOutbox{}
+			s := NewReconciliationService(gateway, staticCredentials{},
+				&PaymentService{repo: ledger, outbox: outbox, tx: &memoryTx{}},
+				ledger, outbox, &memoryReports{}, 24*time.Hour, 3)
+			s.now = func() time.Time { return now }
+
+			report, err := s.ReconcileGym(context.Background(), "level-gym", time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatalf("ReconcileGym: %v", err)
+			}
+			if report.Error != "" {
+				t.Fatalf("report error: %s", report.Error)
+			}
+			want := len(tt.searched)
+			if report.Checked != want || len(report.Discrepancies) != want || len(outbox.messages) != want {
+				t.Errorf("checked %d, %d discrepancies, %d queued; want %d of each",
+					report.Checked, len(report.Discrepancies), len(outbox.messages), want)
+			}
+		})
+	}
+}
+
+func TestReconciliationServiceReconcileGymRange(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		wantFrom time.Time
+		wantErr  bool
+	}{
+		{name: "default window", wantFrom: now.Add(-24 * time.Hour)},
+		{name: "explicit range", from: now.Add(-72 * time.Hour), to: now, wantFrom: now.Add(-72 * time.Hour)},
+		{name: "from after to", from: now, to: now.Add(-time.Hour), wantErr: true},
+		{name: "range too long", from: now.Add(-32 * 24 * time.Hour), to: now, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newMemoryLedger()
+			s := NewReconciliationService(&fakeGateway{}, staticCredentials{},
+				&PaymentService{repo: ledger, outbox: &memoryOutbox{}, tx: &memoryTx{}},
+				ledger, &memoryOutbox{}, &memoryReports{}, 24*time.Hour, 50)
+			s.now = func() time.Time { return now }
+
+			report, err := s.ReconcileGym(context.Background(), "level-gym", tt.from, tt.to)
+			if tt.wantErr {
+				if !errors.Is(err, domain.ErrInvalidRequest) {
+					t.Fatalf("err = %v, want ErrInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReconcileGym: %v", err)
+			}
+			if !report.From.Equal(tt.wantFrom) || !report.To.Equal(now) {
+				t.Errorf("range = %s to %s, want %s to %s", report.From, report.To, tt.wantFrom, now)
+			}
+		})
+	}
+}
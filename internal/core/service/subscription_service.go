@@ -0,0 +1,485 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// Subscription lifecycle events forwarded to Django.
+const (
+	SubscriptionEventCreated      = "subscription.created"
+	SubscriptionEventPaused       = "subscription.paused"
+	SubscriptionEventResumed      = "subscription.resumed"
+	SubscriptionEventCancelled    = "subscription.cancelled"
+	SubscriptionEventCharged      = "subscription.charged"
+	SubscriptionEventChargeFailed = "subscription.charge_failed"
+)
+
+// SubscriptionService manages recurring memberships (MP preapprovals).
+//
+// Lifecycle events reach Django only through MP webhooks, so a change made
+// through this API is reported exactly like one made by the member in MP.
+type SubscriptionService struct {
+	gateway       ports.SubscriptionGateway
+	credProvider  ports.GymCredentialProvider
+	tokens        *AccessTokenResolver
+	subscriptions ports.SubscriptionRepository
+	webhookEvents ports.WebhookEventRepository
+	outbox        ports.OutboxRepository
+	tx            ports.Transactor
+	settings      *GymSettingsResolver
+}
+
+// NewSubscriptionService creates a new subscription service.
+func NewSubscriptionService(
+	gateway ports.SubscriptionGateway,
+	credProvider ports.GymCredentialProvider,
+	tokens *AccessTokenResolver,
+	subscriptions ports.SubscriptionRepository,
+	webhookEvents ports.WebhookEventRepository,
+	outbox ports.OutboxRepository,
+	tx ports.Transactor,
+	settings *GymSettingsResolver,
+) *SubscriptionService {
+	return &SubscriptionService{
+		gateway:       gateway,
+		credProvider:  credProvider,
+		tokens:        tokens,
+		subscriptions: subscriptions,
+		webhookEvents: webhookEvents,
+		outbox:        outbox,
+		tx:            tx,
+		settings:      settings,
+	}
+}
+
+// CreatePlan creates a preapproval plan for a gym.
+func (s *SubscriptionService) CreatePlan(ctx context.Context, req domain.SubscriptionPlanRequest) (*domain.SubscriptionPlanResponse, error) {
+	if req.GymSlug == "" || req.Reason == "" || !req.Amount.IsPositive() || req.Frequency <= 0 {
+		return &domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     "gym_slug, reason, amount and frequency are required",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	settings, err := s.settings.Resolve(ctx, req.GymSlug)
+	if err != nil {
+		log.Printf("Failed to resolve settings for gym %s: %v", req.GymSlug, err)
+		return &domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     "Failed to resolve gym settings",
+			ErrorCode: settingsErrorCode(err),
+		}, nil
+	}
+	if msg := validateCurrency(req.Currency, settings); msg != "" {
+		return &domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+	if req.Amount, err = req.Amount.WithCurrency(settings.Currency); err != nil {
+		return &domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     "amount: " + err.Error(),
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	accessToken, err := s.tokens.Resolve(ctx, req.GymSlug, req.MPAccessToken)
+	if err != nil {
+		msg, code := tokenError(err)
+		return &domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	plan, err := s.gateway.CreatePlan(ctx, accessToken, req, settings)
+	if err != nil {
+		log.Printf("Failed to create plan for gym %s: %v", req.GymSlug, err)
+		return subscriptionPlanErrorResponse(err), nil
+	}
+
+	log.Printf("Created subscription plan %s for gym %s", plan.PlanID, req.GymSlug)
+
+	return &domain.SubscriptionPlanResponse{
+		Success: true,
+		Plan:    plan,
+	}, nil
+}
+
+// CreateSubscription subscribes a member, either to an existing plan or with
+// its own recurrence.
+func (s *SubscriptionService) CreateSubscription(ctx context.Context, req domain.SubscriptionRequest) (*domain.SubscriptionResponse, error) {
+	if req.GymSlug == "" || req.PayerEmail == "" || req.ExternalReference == "" {
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "gym_slug, payer_email and external_reference are required",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+	if req.PlanID == "" && (req.Reason == "" || !req.Amount.IsPositive() || req.Frequency <= 0 || req.FrequencyType == "") {
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "plan_id or reason, amount, frequency and frequency_type are required",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	settings, err := s.settings.Resolve(ctx, req.GymSlug)
+	if err != nil {
+		log.Printf("Failed to resolve settings for gym %s: %v", req.GymSlug, err)
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Failed to resolve gym settings",
+			ErrorCode: settingsErrorCode(err),
+		}, nil
+	}
+	if msg := validateCurrency(req.Currency, settings); msg != "" {
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+	if req.Amount, err = req.Amount.WithCurrency(settings.Currency); err != nil {
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "amount: " + err.Error(),
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	accessToken, err := s.tokens.Resolve(ctx, req.GymSlug, req.MPAccessToken)
+	if err != nil {
+		msg, code := tokenError(err)
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	subscription, err := s.gateway.CreateSubscription(ctx, accessToken, req, settings)
+	if err != nil {
+		log.Printf("Failed to create subscription for gym %s, ref %s: %v", req.GymSlug, req.ExternalReference, err)
+		return subscriptionErrorResponse(err), nil
+	}
+
+	log.Printf("Created subscription %s (%s) for gym %s, ref %s",
+		subscription.SubscriptionID, subscription.Status, req.GymSlug, req.ExternalReference)
+
+	return &domain.SubscriptionResponse{
+		Success:      true,
+		Subscription: subscription,
+	}, nil
+}
+
+// UpdateSubscriptionStatus pauses (paused), resumes (authorized) or cancels
+// (cancelled) a subscription.
+func (s *SubscriptionService) UpdateSubscriptionStatus(ctx context.Context, subscriptionID, status string, req domain.SubscriptionActionRequest) (*domain.SubscriptionResponse, error) {
+	if subscriptionID == "" || req.GymSlug == "" {
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "subscription_id and gym_slug are required",
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	switch status {
+	case domain.SubscriptionAuthorized, domain.SubscriptionPaused, domain.SubscriptionCancelled:
+	default:
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "unsupported subscription status: " + status,
+			ErrorCode: "VALIDATION_ERROR",
+		}, nil
+	}
+
+	accessToken, err := s.tokens.Resolve(ctx, req.GymSlug, req.MPAccessToken)
+	if err != nil {
+		msg, code := tokenError(err)
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     msg,
+			ErrorCode: code,
+		}, nil
+	}
+
+	subscription, err := s.gateway.UpdateSubscriptionStatus(ctx, accessToken, subscriptionID, status)
+	if err != nil {
+		log.Printf("Failed to set subscription %s to %s for gym %s: %v", subscriptionID, status, req.GymSlug, err)
+		return subscriptionErrorResponse(err), nil
+	}
+
+	log.Printf("Subscription %s set to %s for gym %s", subscriptionID, subscription.Status, req.GymSlug)
+
+	return &domain.SubscriptionResponse{
+		Success:      true,
+		Subscription: subscription,
+	}, nil
+}
+
+// processPreapprovalNotification fetches a notified subscription and, in a
+// single transaction, records its status, queues a Django event when the
+// status moved and marks the webhook event as processed.
+func (s *SubscriptionService) processPreapprovalNotification(ctx context.Context, gymSlug, subscriptionID, eventKey string) error {
+	accessToken, err := s.credProvider.GetAccessToken(ctx, gymSlug)
+	if err != nil {
+		log.Printf("Failed to get access token for gym %s: %v", gymSlug, err)
+		return err
+	}
+
+	subscription, err := s.gateway.GetSubscription(ctx, accessToken, subscriptionID)
+	if err != nil {
+		log.Printf("Failed to get subscription %s for gym %s: %v", subscriptionID, gymSlug, err)
+		return err
+	}
+
+	event := ""
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.subscriptions.LockSubscription(ctx, gymSlug, subscriptionID); err != nil {
+			return err
+		}
+		previousStatus := ""
+		previous, err := s.subscriptions.GetSubscription(ctx, gymSlug, subscriptionID)
+		switch {
+		case err == nil:
+			previousStatus = previous.Status
+		case !errors.Is(err, domain.ErrSubscriptionNotFound):
+			return err
+		}
+
+		record := domain.SubscriptionRecord{
+			GymSlug:           gymSlug,
+			SubscriptionID:    subscription.SubscriptionID,
+			PlanID:            subscription.PlanID,
+			ExternalReference: subscription.ExternalReference,
+			Status:            subscription.Status,
+			PayerEmail:        subscription.PayerEmail,
+			Amount:            subscription.Amount,
+			UpdatedAt:         time.Now(),
+		}
+		if err := s.subscriptions.SaveSubscription(ctx, record); err != nil {
+			return err
+		}
+
+		event = subscriptionTransitionEvent(previousStatus, subscription.Status)
+		if event != "" {
+			payload := domain.DjangoSubscriptionPayload{
+				Event:              event,
+				GymSlug:            gymSlug,
+				SubscriptionID:     subscription.SubscriptionID,
+				PlanID:             subscription.PlanID,
+				ExternalReference:  subscription.ExternalReference,
+				SubscriptionStatus: subscription.Status,
+				PayerEmail:         subscription.PayerEmail,
+				Amount:             subscription.Amount,
+				Currency:           subscription.Amount.Currency,
+				Timestamp:          time.Now().Format(time.RFC3339),
+			}
+			if err := s.enqueue(ctx, gymSlug, payload); err != nil {
+				return err
+			}
+		}
+
+		return s.completeEvent(ctx, gymSlug, eventKey)
+	})
+	if err != nil {
+		log.Printf("Failed to process subscription %s for gym %s: %v", subscriptionID, gymSlug, err)
+		return err
+	}
+
+	if event == "" {
+		log.Printf("Webhook processed: subscription %s, status %s, gym %s (no lifecycle change)",
+			subscriptionID, subscription.Status, gymSlug)
+	} else {
+		log.Printf("Webhook processed: subscription %s, status %s, gym %s (queued %s)",
+			subscriptionID, subscription.Status, gymSlug, event)
+	}
+	return nil
+}
+
+// processChargeNotification fetches a notified subscription charge and, in a
+// single transaction, records it and queues a Django event when its payment
+// became approved or rejected. Redeliveries of a charge whose payment status
+// did not change queue nothing.
+func (s *SubscriptionService) processChargeNotification(ctx context.Context, gymSlug, chargeID, eventKey string) error {
+	accessToken, err := s.credProvider.GetAccessToken(ctx, gymSlug)
+	if err != nil {
+		log.Printf("Failed to get access token for gym %s: %v", gymSlug, err)
+		return err
+	}
+
+	charge, err := s.gateway.GetSubscriptionCharge(ctx, accessToken, chargeID)
+	if err != nil {
+		log.Printf("Failed to get subscription charge %s for gym %s: %v", chargeID, gymSlug, err)
+		return err
+	}
+
+	event := ""
+	err = s.tx.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.subscriptions.LockCharge(ctx, gymSlug, charge.ChargeID); err != nil {
+			return err
+		}
+		previousStatus := ""
+		previous, err := s.subscriptions.GetCharge(ctx, gymSlug, charge.ChargeID)
+		switch {
+		case err == nil:
+			previousStatus = previous.PaymentStatus
+		case !errors.Is(err, domain.ErrChargeNotFound):
+			return err
+		}
+		if err := s.subscriptions.SaveCharge(ctx, gymSlug, *charge); err != nil {
+			return err
+		}
+
+		if charge.PaymentStatus != previousStatus {
+			event = chargeEvent(charge.PaymentStatus)
+		}
+		if event != "" {
+			payload := domain.DjangoSubscriptionPayload{
+				Event:             event,
+				GymSlug:           gymSlug,
+				SubscriptionID:    charge.SubscriptionID,
+				ExternalReference: charge.ExternalReference,
+				Amount:            charge.Amount,
+				Currency:          charge.Amount.Currency,
+				ChargeID:          charge.ChargeID,
+				PaymentID:         charge.PaymentID,
+				PaymentStatus:     charge.PaymentStatus,
+				Timestamp:         time.Now().Format(time.RFC3339),
+			}
+
+			// Fill in what the charge does not carry from the subscription record
+			record, err := s.subscriptions.GetSubscription(ctx, gymSlug, charge.SubscriptionID)
+			switch {
+			case err == nil:
+				payload.PlanID = record.PlanID
+				payload.SubscriptionStatus = record.Status
+				payload.PayerEmail = record.PayerEmail
+			case !errors.Is(err, domain.ErrSubscriptionNotFound):
+				return err
+			}
+
+			if err := s.enqueue(ctx, gymSlug, payload); err != nil {
+				return err
+			}
+		}
+
+		return s.completeEvent(ctx, gymSlug, eventKey)
+	})
+	if err != nil {
+		log.Printf("Failed to process subscription charge %s for gym %s: %v", chargeID, gymSlug, err)
+		return err
+	}
+
+	if event == "" {
+		log.Printf("Webhook processed: subscription charge %s (%s, payment %s), subscription %s, gym %s (nothing to report)",
+			chargeID, charge.Status, charge.PaymentStatus, charge.SubscriptionID, gymSlug)
+	} else {
+		log.Printf("Webhook processed: subscription charge %s (%s, payment %s), subscription %s, gym %s (queued %s)",
+			chargeID, charge.Status, charge.PaymentStatus, charge.SubscriptionID, gymSlug, event)
+	}
+	return nil
+}
+
+// completeEvent marks a claimed webhook event as processed.
+// Notifications without an event key were never claimed.
+func (s *SubscriptionService) completeEvent(ctx context.Context, gymSlug, eventKey string) error {
+	if eventKey == "" {
+		return nil
+	}
+	return s.webhookEvents.CompleteEvent(ctx, gymSlug, eventKey)
+}
+
+// enqueue queues a subscription event for delivery to Django.
+func (s *SubscriptionService) enqueue(ctx context.Context, gymSlug string, payload domain.DjangoSubscriptionPayload) error {
+	return s.outbox.Enqueue(ctx, domain.OutboxMessage{
+		GymSlug:      gymSlug,
+		Kind:         domain.OutboxKindSubscription,
+		Subscription: &payload,
+	})
+}
+
+// subscriptionTransitionEvent maps a subscription status change to the
+// lifecycle event Django is told about. Returns "" when there is none.
+func subscriptionTransitionEvent(from, to string) string {
+	if from == to {
+		return ""
+	}
+	switch to {
+	case domain.SubscriptionAuthorized:
+		if from == domain.SubscriptionPaused {
+			return SubscriptionEventResumed
+		}
+		return SubscriptionEventCreated
+	case domain.SubscriptionPaused:
+		return SubscriptionEventPaused
+	case domain.SubscriptionCancelled:
+		return SubscriptionEventCancelled
+	default:
+		return ""
+	}
+}
+
+// chargeEvent maps the payment status of a subscription charge to an event.
+// Returns "" while the charge is still scheduled or being retried.
+func chargeEvent(paymentStatus string) string {
+	switch paymentStatus {
+	case "approved":
+		return SubscriptionEventCharged
+	case "rejected":
+		return SubscriptionEventChargeFailed
+	default:
+		return ""
+	}
+}
+
+// subscriptionPlanErrorResponse maps a gateway error to a plan response.
+func subscriptionPlanErrorResponse(err error) *domain.SubscriptionPlanResponse {
+	if errors.Is(err, domain.ErrInvalidRequest) {
+		return &domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     "Plan rejected: " + err.Error(),
+			ErrorCode: "SUBSCRIPTION_REJECTED",
+		}
+	}
+	return &domain.SubscriptionPlanResponse{
+		Success:   false,
+		Error:     "Failed to create plan",
+		ErrorCode: "GATEWAY_ERROR",
+	}
+}
+
+// subscriptionErrorResponse maps a gateway error to a subscription response.
+func subscriptionErrorResponse(err error) *domain.SubscriptionResponse {
+	switch {
+	case errors.Is(err, domain.ErrSubscriptionNotFound):
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Subscription not found",
+			ErrorCode: "SUBSCRIPTION_NOT_FOUND",
+		}
+	case errors.Is(err, domain.ErrInvalidRequest):
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Subscription rejected: " + err.Error(),
+			ErrorCode: "SUBSCRIPTION_REJECTED",
+		}
+	default:
+		return &domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Subscription request failed",
+			ErrorCode: "GATEWAY_ERROR",
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+)
+
+// fakeSubscriptionGateway is a ports.SubscriptionGateway serving canned
+// preapprovals and charges, and recording the status changes asked of it.
+type fakeSubscriptionGateway struct {
+	ports.SubscriptionGateway
+	subscriptions map[string]domain.SubscriptionInfo
+	charges       map[string]domain.SubscriptionCharge
+	err           error
+	created       []domain.SubscriptionRequest
+	updates       []string
+}
+
+func (g *fakeSubscriptionGateway) CreatePlan(_ context.Context, _ string, req domain.SubscriptionPlanRequest, _ domain.GymSettings) (*domain.SubscriptionPlan, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &domain.SubscriptionPlan{PlanID: "plan-1", Reason: req.Reason, Status: "active", Amount: req.Amount}, nil
+}
+
+func (g *fakeSubscriptionGateway) CreateSubscription(_ context.Context, _ string, req domain.SubscriptionRequest, _ domain.GymSettings) (*domain.SubscriptionInfo, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	g.created = append(g.created, req)
+	return &domain.SubscriptionInfo{SubscriptionID: "sub-1", PlanID: req.PlanID, Status: domain.SubscriptionPending,
+		ExternalReference: req.ExternalReference, PayerEmail: req.PayerEmail, Amount: req.Amount}, nil
+}
+
+func (g *fakeSubscriptionGateway) GetSubscription(_ context.Context, _ string, subscriptionID string) (*domain.SubscriptionInfo, error) {
+	info, ok := g.subscriptions[subscriptionID]
+	if !ok {
+		return nil, domain.ErrSubscriptionNotFound
+	}
+	return &info, nil
+}
+
+func (g *fakeSubscriptionGateway) UpdateSubscriptionStatus(_ context.Context, _ string, subscriptionID, status string) (*domain.SubscriptionInfo, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	g.updates = append(g.updates, subscriptionID+":"+status)
+	return &domain.SubscriptionInfo{SubscriptionID: subscriptionID, Status: status}, nil
+}
+
+func (g *fakeSubscriptionGateway) GetSubscriptionCharge(_ context.Context, _ string, chargeID string) (*domain.SubscriptionCharge, error) {
+	charge, ok := g.charges[chargeID]
+	if !ok {
+		return nil, domain.ErrChargeNotFound
+	}
+	return &charge, nil
+}
+
+// memorySubscriptions is an in-memory ports.SubscriptionRepository.
+type memorySubscriptions struct {
+	records map[string]domain.SubscriptionRecord
+	charges map[string]domain.SubscriptionCharge
+}
+
+func newMemorySubscriptions() *memorySubscriptions {
+	return &memorySubscriptions{
+		records: map[string]domain.SubscriptionRecord{},
+		charges: map[string]domain.SubscriptionCharge{},
+	}
+}
+
+func (m *memorySubscriptions) LockSubscription(ctx context.Context, gymSlug, subscriptionID string) error {
+	return lockInTx(ctx, "subscription:"+gymSlug+":"+subscriptionID)
+}
+
+func (m *memorySubscriptions) SaveSubscription(_ context.Context, record domain.SubscriptionRecord) error {
+	m.records[record.SubscriptionID] = record
+	return nil
+}
+
+func (m *memorySubscriptions) GetSubscription(_ context.Context, _ string, subscriptionID string) (*domain.SubscriptionRecord, error) {
+	record, ok := m.records[subscriptionID]
+	if !ok {
+		return nil, domain.ErrSubscriptionNotFound
+	}
+	return &record, nil
+}
+
+func (m *memorySubscriptions) LockCharge(ctx context.Context, gymSlug, chargeID string) error {
+	return lockInTx(ctx, "charge:"+gymSlug+":"+chargeID)
+}
+
+func (m *memorySubscriptions) SaveCharge(_ context.Context, _ string, charge domain.SubscriptionCharge) error {
+	m.charges[charge.ChargeID] = charge
+	return nil
+}
+
+func (m *memorySubscriptions) GetCharge(_ context.Context, _ string, chargeID string) (*domain.SubscriptionCharge, error) {
+	charge, ok := m.charges[chargeID]
+	if !ok {
+		return nil, domain.ErrChargeNotFound
+	}
+	return &charge, nil
+}
+
+// subscriptionEvents returns the queued subscription notifications.
+func (o *memoryOutbox) subscriptionEvents() []domain.DjangoSubscriptionPayload {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var payloads []domain.DjangoSubscriptionPayload
+	for _, m := range o.messages {
+		if m.Subscription != nil {
+			payloads = append(payloads, *m.Subscription)
+		}
+	}
+	return payloads
+}
+
+// newTestSubscriptionService returns a SubscriptionService over gateway
+// whose gyms have no settings of their own.
+func newTestSubscriptionService(gateway ports.SubscriptionGateway, subscriptions ports.SubscriptionRepository, outbox ports.OutboxRepository, events ports.WebhookEventRepository) *SubscriptionService {
+	settings := NewGymSettingsResolver(&countingSettings{settings: &domain.GymSettings{}}, testGymDefaults, prefixSigner{}, false, 0)
+	return NewSubscriptionService(gateway, staticCredentials{}, NewAccessTokenResolver(staticCredentials{}, false),
+		subscriptions, events, outbox, &memoryTx{}, settings)
+}
+
+func TestSubscriptionTransitionEvent(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{from: "", to: domain.SubscriptionPending},
+		{from: "", to: domain.SubscriptionAuthorized, want: SubscriptionEventCreated},
+		{from: domain.SubscriptionPending, to: domain.SubscriptionAuthorized, want: SubscriptionEventCreated},
+		{from: domain.SubscriptionAuthorized, to: domain.SubscriptionPaused, want: SubscriptionEventPaused},
+		{from: domain.SubscriptionPaused, to: domain.SubscriptionAuthorized, want: SubscriptionEventResumed},
+		{from: domain.SubscriptionAuthorized, to: domain.SubscriptionCancelled, want: SubscriptionEventCancelled},
+		{from: domain.SubscriptionPaused, to: domain.SubscriptionCancelled, want: SubscriptionEventCancelled},
+		{from: domain.SubscriptionAuthorized, to: domain.SubscriptionAuthorized},
+		{from: domain.SubscriptionCancelled, to: domain.SubscriptionCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := subscriptionTransitionEvent(tt.from, tt.to); got != tt.want {
+				t.Errorf("subscriptionTransitionEvent(%q, %q) = %q, want %q", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChargeEvent(t *testing.T) {
+	tests := []struct {
+		paymentStatus string
+		want          string
+	}{
+		{paymentStatus: "approved", want: SubscriptionEventCharged},
+		{paymentStatus: "rejected", want: SubscriptionEventChargeFailed},
+		{paymentStatus: "pending"},
+		{paymentStatus: "in_process"},
+		{paymentStatus: ""},
+	}
+
+	for _, tt := range tests {
+		if got := chargeEvent(tt.paymentStatus); got != tt.want {
+			t.Errorf("chargeEvent(%q) = %q, want %q", tt.paymentStatus, got, tt.want)
+		}
+	}
+}
+
+func TestProcessPreapprovalNotification(t *testing.T) {
+	tests := []struct {
+		name string
+		// previous is the recorded status, "" when never seen
+		previous string
+		current  string
+		want     []string
+	}{
+		{name: "created pending", current: domain.SubscriptionPending},
+		{name: "authorized", previous: domain.SubscriptionPending, current: domain.SubscriptionAuthorized,
+			want: []string{SubscriptionEventCreated}},
+		{name: "paused", previous: domain.SubscriptionAuthorized, current: domain.SubscriptionPaused,
+			want: []string{SubscriptionEventPaused}},
+		{name: "resumed", previous: domain.SubscriptionPaused, current: domain.SubscriptionAuthorized,
+			want: []string{SubscriptionEventResumed}},
+		{name: "cancelled", previous: domain.SubscriptionAuthorized, current: domain.SubscriptionCancelled,
+			want: []string{SubscriptionEventCancelled}},
+		{name: "redelivered", previous: domain.SubscriptionAuthorized, current: domain.SubscriptionAuthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscriptions := newMemorySubscriptions()
+			if tt.previous != "" {
+				subscriptions.records["sub-1"] = domain.SubscriptionRecord{GymSlug: "level-gym", SubscriptionID: "sub-1", Status: tt.previous}
+			}
+			gateway := &fakeSubscriptionGateway{subscriptions: map[string]domain.SubscriptionInfo{
+				"sub-1": {SubscriptionID: "sub-1", PlanID: "plan-1", Status: tt.current, ExternalReference: "member-1",
+					PayerEmail: "member@example.com", Amount: domain.NewMoney(1500000, "ARS")},
+			}}
+			outbox := &memoryOutbox{}
+			events := &memoryWebhookEvents{}
+			s := newTestSubscriptionService(gateway, subscriptions, outbox, events)
+
+			if err := s.processPreapprovalNotification(context.Background(), "level-gym", "sub-1", "preapproval:sub-1"); err != nil {
+				t.Fatalf("processPreapprovalNotification: %v", err)
+			}
+
+			var got []string
+			for _, payload := range outbox.subscriptionEvents() {
+				got = append(got, payload.Event)
+				if payload.ExternalReference != "member-1" || payload.SubscriptionStatus != tt.current || payload.Currency != "ARS" {
+					t.Errorf("payload = %+v, want the subscription's reference, status and currency", payload)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("queued %v, want %v", got, tt.want)
+			}
+			if subscriptions.records["sub-1"].Status != tt.current {
+				t.Errorf("recorded status = %q, want %q", subscriptions.records["sub-1"].Status, tt.current)
+			}
+			if !events.completed["level-gym:preapproval:sub-1"] {
+				t.Error("webhook event not completed")
+			}
+		})
+	}
+}
+
+func TestProcessChargeNotification(t *testing.T) {
+	tests := []struct {
+		name string
+		// previous is the recorded payment status, "" when never seen
+		previous string
+		current  string
+		want     []string
+	}{
+		{name: "scheduled", current: ""},
+		{name: "charged", current: "approved", want: []string{SubscriptionEventCharged}},
+		{name: "retried then charged", previous: "rejected", current: "approved", want: []string{SubscriptionEventCharged}},
+		{name: "failed", previous: "pending", current: "rejected", want: []string{SubscriptionEventChargeFailed}},
+		{name: "charge redelivered", previous: "approved", current: "approved"},
+		{name: "failure redelivered", previous: "rejected", current: "rejected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charge := domain.SubscriptionCharge{ChargeID: "charge-1", SubscriptionID: "sub-1", ExternalReference: "member-1",
+				Status: "processed", PaymentID: "900", PaymentStatus: tt.current, Amount: domain.NewMoney(1500000, "ARS")}
+			subscriptions := newMemorySubscriptions()
+			subscriptions.records["sub-1"] = domain.SubscriptionRecord{GymSlug: "level-gym", SubscriptionID: "sub-1",
+				PlanID: "plan-1", Status: domain.SubscriptionAuthorized, PayerEmail: "member@example.com"}
+			if tt.previous != "" {
+				previous := charge
+				previous.PaymentStatus = tt.previous
+				subscriptions.charges["charge-1"] = previous
+			}
+			gateway := &fakeSubscriptionGateway{charges: map[string]domain.SubscriptionCharge{"charge-1": charge}}
+			outbox := &memoryOutbox{}
+			events := &memoryWebhookEvents{}
+			s := newTestSubscriptionService(gateway, subscriptions, outbox, events)
+
+			if err := s.processChargeNotification(context.Background(), "level-gym", "charge-1", "charge:charge-1"); err != nil {
+				t.Fatalf("processChargeNotification: %v", err)
+			}
+
+			var got []string
+			for _, payload := range outbox.subscriptionEvents() {
+				got = append(got, payload.Event)
+				// What the charge does not carry comes from the subscription record
+				if payload.PlanID != "plan-1" || payload.PayerEmail != "member@example.com" || payload.PaymentID != "900" {
+					t.Errorf("payload = %+v, want the plan, payer and payment filled in", payload)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("queued %v, want %v", got, tt.want)
+			}
+			if subscriptions.charges["charge-1"].PaymentStatus != tt.current {
+				t.Errorf("recorded payment status = %q, want %q", subscriptions.charges["charge-1"].PaymentStatus, tt.current)
+			}
+			if !events.completed["level-gym:charge:charge-1"] {
+				t.Error("webhook event not completed")
+			}
+		})
+	}
+}
+
+func TestSubscriptionServiceCreateSubscription(t *testing.T) {
+	valid := domain.SubscriptionRequest{GymSlug: "level-gym", PlanID: "plan-1", PayerEmail: "member@example.com",
+		ExternalReference: "member-1"}
+	withoutPlan := domain.SubscriptionRequest{GymSlug: "level-gym", PayerEmail: "member@example.com",
+		ExternalReference: "member-1", Reason: "Monthly", Amount: domain.NewMoney(1500000, ""), Frequency: 1, FrequencyType: "months"}
+
+	tests := []struct {
+		name       string
+		req        domain.SubscriptionRequest
+		gatewayErr error
+		wantCode   string
+	}{
+		{name: "to a plan", req: valid},
+		{name: "with its own recurrence", req: withoutPlan},
+		{name: "missing payer", req: domain.SubscriptionRequest{GymSlug: "level-gym", PlanID: "plan-1", ExternalReference: "member-1"},
+			wantCode: "VALIDATION_ERROR"},
+		{name: "neither plan nor recurrence", req: domain.SubscriptionRequest{GymSlug: "level-gym",
+			PayerEmail: "member@example.com", ExternalReference: "member-1", Reason: "Monthly"}, wantCode: "VALIDATION_ERROR"},
+		{name: "other currency", req: func() domain.SubscriptionRequest { r := withoutPlan; r.Currency = "USD"; return r }(),
+			wantCode: "VALIDATION_ERROR"},
+		{name: "rejected by Mercado Pago", req: valid,
+			gatewayErr: domain.NewServiceError(domain.ErrInvalidRequest, "invalid card token", "MP_SUBSCRIPTION_ERROR"),
+			wantCode:   "SUBSCRIPTION_REJECTED"},
+		{name: "gateway failure", req: valid,
+			gatewayErr: domain.NewServiceError(domain.ErrPaymentGatewayError, "timeout", "MP_SUBSCRIPTION_ERROR"),
+			wantCode:   "GATEWAY_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &fakeSubscriptionGateway{err: tt.gatewayErr}
+			s := newTestSubscriptionService(gateway, newMemorySubscriptions(), &memoryOutbox{}, &memoryWebhookEvents{})
+
+			resp, err := s.CreateSubscription(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("CreateSubscription: %v", err)
+			}
+			if resp.ErrorCode != tt.wantCode {
+				t.Fatalf("error code = %q (%s), want %q", resp.ErrorCode, resp.Error, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				return
+			}
+			if !resp.Success || resp.Subscription.SubscriptionID != "sub-1" {
+				t.Errorf("response = %+v, want subscription sub-1", resp)
+			}
+			if len(gateway.created) != 1 || tt.req.Amount.IsPositive() && gateway.created[0].Amount.Currency != "ARS" {
+				t.Errorf("created %+v, want one subscription in the gym's currency", gateway.created)
+			}
+		})
+	}
+}
+
+func TestSubscriptionServiceUpdateSubscriptionStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		gatewayErr error
+		wantCode   string
+	}{
+		{name: "pause", status: domain.SubscriptionPaused},
+		{name: "resume", status: domain.SubscriptionAuthorized},
+		{name: "cancel", status: domain.SubscriptionCancelled},
+		{name: "unsupported status", status: domain.SubscriptionPending, wantCode: "VALIDATION_ERROR"},
+		{name: "unknown subscription", status: domain.SubscriptionPaused,
+			gatewayErr: domain.NewServiceError(domain.ErrSubscriptionNotFound, "not found", "MP_SUBSCRIPTION_ERROR"),
+			wantCode:   "SUBSCRIPTION_NOT_FOUND"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &fakeSubscriptionGateway{err: tt.gatewayErr}
+			outbox := &memoryOutbox{}
+			s := newTestSubscriptionService(gateway, newMemorySubscriptions(), outbox, &memoryWebhookEvents{})
+
+			resp, err := s.UpdateSubscriptionStatus(context.Background(), "sub-1", tt.status,
+				domain.SubscriptionActionRequest{GymSlug: "level-gym"})
+			if err != nil {
+				t.Fatalf("UpdateSubscriptionStatus: %v", err)
+			}
+			if resp.ErrorCode != tt.wantCode {
+				t.Fatalf("error code = %q (%s), want %q", resp.ErrorCode, resp.Error, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				return
+			}
+			if !slices.Equal(gateway.updates, []string{"sub-1:" + tt.status}) {
+				t.Errorf("gateway updates = %v, want sub-1:%s", gateway.updates, tt.status)
+			}
+			// Django hears of the change from the webhook MP sends for it
+			if len(outbox.messages) != 0 {
+				t.Errorf("queued %d messages, want none", len(outbox.messages))
+			}
+		})
+	}
+}
+
+func TestSubscriptionServiceCreatePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      domain.SubscriptionPlanRequest
+		wantCode string
+	}{
+		{name: "created", req: domain.SubscriptionPlanRequest{GymSlug: "level-gym", Reason: "Monthly",
+			Amount: domain.NewMoney(1500000, ""), Frequency: 1, FrequencyType: "months"}},
+		{name: "no amount", req: domain.SubscriptionPlanRequest{GymSlug: "level-gym", Reason: "Monthly",
+			Frequency: 1, FrequencyType: "months"}, wantCode: "VALIDATION_ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSubscriptionService(&fakeSubscriptionGateway{}, newMemorySubscriptions(), &memoryOutbox{}, &memoryWebhookEvents{})
+
+			resp, err := s.CreatePlan(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("CreatePlan: %v", err)
+			}
+			if resp.ErrorCode != tt.wantCode {
+				t.Fatalf("error code = %q (%s), want %q", resp.ErrorCode, resp.Error, tt.wantCode)
+			}
+			if tt.wantCode == "" && (resp.Plan == nil || resp.Plan.Amount.Currency != "ARS") {
+				t.Errorf("plan = %+v, want one in the gym's currency", resp.Plan)
+			}
+		})
+	}
+}
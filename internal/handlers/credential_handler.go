@@ -0,0 +1,33 @@
+// Package handlers contains the HTTP handlers for gym credential administration.
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+	"github.com/gin-gonic/gin"
+)
+
+// CredentialHandler handles admin requests for cached gym credentials.
+type CredentialHandler struct {
+	invalidator ports.CredentialInvalidator
+}
+
+// NewCredentialHandler creates a new credential handler.
+func NewCredentialHandler(invalidator ports.CredentialInvalidator) *CredentialHandler {
+	return &CredentialHandler{invalidator: invalidator}
+}
+
+// InvalidateCredentials handles POST /api/v1/admin/gyms/:gym_slug/credentials/invalidate
+// Django calls it after a gym's Mercado Pago credentials change.
+func (h *CredentialHandler) InvalidateCredentials(c *gin.Context) {
+	gymSlug := c.Param("gym_slug")
+	h.invalidator.InvalidateGym(gymSlug)
+	log.Printf("Invalidated cached credentials for gym %s", gymSlug)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"gym_slug": gymSlug,
+	})
+}
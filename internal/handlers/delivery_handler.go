@@ -0,0 +1,148 @@
+// Package handlers contains the HTTP handlers for Django delivery administration.
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRedeliveryBatch caps how many deliveries one request can requeue.
+const maxRedeliveryBatch = 500
+
+// DeliveryHandler handles admin requests for Django callback deliveries.
+type DeliveryHandler struct {
+	service *service.DeliveryService
+}
+
+// NewDeliveryHandler creates a new delivery handler.
+func NewDeliveryHandler(svc *service.DeliveryService) *DeliveryHandler {
+	return &DeliveryHandler{service: svc}
+}
+
+// redeliverRequest is the body of POST /api/v1/admin/deliveries/redeliver.
+type redeliverRequest struct {
+	IDs []int64 `json:"ids" binding:"required,min=1"`
+}
+
+// ListDeliveries handles GET /api/v1/admin/deliveries
+// Query params: status (failed|retrying|pending|delivered|dead), gym_slug, limit.
+func (h *DeliveryHandler) ListDeliveries(c *gin.Context) {
+	filter := domain.DeliveryFilter{
+		Status:  c.Query("status"),
+		GymSlug: c.Query("gym_slug"),
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "limit must be between 1 and 1000",
+				"code":    "VALIDATION_ERROR",
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	deliveries, err := h.service.ListDeliveries(c.Request.Context(), filter)
+	if err != nil {
+		respondDeliveryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"deliveries": deliveries,
+	})
+}
+
+// RedeliverOne handles POST /api/v1/admin/deliveries/:id/redeliver
+func (h *DeliveryHandler) RedeliverOne(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "invalid delivery id",
+			"code":    "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	result, err := h.service.Redeliver(c.Request.Context(), []int64{id})
+	if err != nil {
+		respondDeliveryError(c, err)
+		return
+	}
+
+	if len(result.NotFound) > 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "delivery not found",
+			"code":    "DELIVERY_NOT_FOUND",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
+
+// RedeliverMany handles POST /api/v1/admin/deliveries/redeliver
+func (h *DeliveryHandler) RedeliverMany(c *gin.Context) {
+	var req redeliverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request: " + err.Error(),
+			"code":    "VALIDATION_ERROR",
+		})
+		return
+	}
+	if len(req.IDs) > maxRedeliveryBatch {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "too many ids (max " + strconv.Itoa(maxRedeliveryBatch) + ")",
+			"code":    "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	result, err := h.service.Redeliver(c.Request.Context(), req.IDs)
+	if err != nil {
+		respondDeliveryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
+
+// respondDeliveryError writes the error response for a delivery service error.
+func respondDeliveryError(c *gin.Context, err error) {
+	var svcErr *domain.ServiceError
+	if errors.Is(err, domain.ErrInvalidRequest) && errors.As(err, &svcErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   svcErr.Message,
+			"code":    svcErr.Code,
+		})
+		return
+	}
+
+	log.Printf("Delivery admin error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"error":   "Internal server error",
+		"code":    "INTERNAL_ERROR",
+	})
+}
@@ -2,8 +2,19 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/fitstack/fitstack-payments/internal/core/ports"
+	"github.com/fitstack/fitstack-payments/internal/signing"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -13,7 +24,7 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Request-ID")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Request-ID, Idempotency-Key")
 		c.Header("Access-Control-Max-Age", "86400")
 
 		if c.Request.Method == "OPTIONS" {
@@ -37,9 +48,33 @@ func RequestIDMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Route scopes a service key can be limited to.
+const (
+	ScopePayments      = "payments"
+	ScopeSubscriptions = "subscriptions"
+	ScopeAdmin         = "admin"
+)
+
+// ServiceKey is an API key accepted by ServiceAuthMiddleware.
+type ServiceKey struct {
+	// ID identifies the key in logs.
+	ID     string
+	Key    string
+	Scopes []string // empty allows every scope
+}
+
+// allows reports whether the key may call routes of the given scope.
+func (k ServiceKey) allows(scope string) bool {
+	return len(k.Scopes) == 0 || slices.Contains(k.Scopes, scope)
+}
+
 // ServiceAuthMiddleware validates Bearer token for server-to-server communication.
 // The checkout endpoint is called by Django, not by end users.
-func ServiceAuthMiddleware() gin.HandlerFunc {
+//
+// Unknown keys get 401, known keys without the route's scope get 403. Keys
+// are compared in constant time and every configured key is checked, so
+// timing reveals neither the key nor which one matched.
+func ServiceAuthMiddleware(keys []ServiceKey, scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -62,11 +97,141 @@ func ServiceAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Store token for potential validation
-		c.Set("service_token", parts[1])
+		key, ok := matchServiceKey(keys, parts[1])
+		if !ok {
+			log.Printf("Service auth: rejected unknown key for %s %s from %s",
+				c.Request.Method, c.FullPath(), c.ClientIP())
+			c.AbortWithStatusJSON(401, gin.H{
+				"success": false,
+				"error":   "Invalid API key",
+				"code":    "UNAUTHORIZED",
+			})
+			return
+		}
+
+		if !key.allows(scope) {
+			log.Printf("Service auth: key %s is not allowed %s scope (%s %s)",
+				key.ID, scope, c.Request.Method, c.FullPath())
+			c.AbortWithStatusJSON(403, gin.H{
+				"success": false,
+				"error":   "API key not allowed for this endpoint",
+				"code":    "FORBIDDEN",
+			})
+			return
+		}
+
+		log.Printf("Service auth: key %s %s %s", key.ID, c.Request.Method, c.FullPath())
+		c.Set("service_key_id", key.ID)
+
+		c.Next()
+	}
+}
+
+// matchServiceKey finds the key matching token. Hashing first makes the
+// constant-time comparison independent of the keys' lengths.
+func matchServiceKey(keys []ServiceKey, token string) (ServiceKey, bool) {
+	tokenSum := sha256.Sum256([]byte(token))
+
+	var (
+		matched ServiceKey
+		found   bool
+	)
+	for _, k := range keys {
+		keySum := sha256.Sum256([]byte(k.Key))
+		if subtle.ConstantTimeCompare(tokenSum[:], keySum[:]) == 1 && !found {
+			matched, found = k, true
+		}
+	}
+	return matched, found
+}
+
+// maxSignedBody caps the request body read for signature verification.
+const maxSignedBody = 1 << 20
 
-		// TODO: Validate token against expected service key
-		// In production, compare with PAYMENTS_SERVICE_API_KEY env var
+// SignatureConfig configures RequestSignatureMiddleware.
+type SignatureConfig struct {
+	// Secrets are the accepted HMAC secrets; empty disables verification.
+	Secrets []string
+	// Tolerance is the maximum clock skew of the signed timestamp.
+	Tolerance time.Duration
+	// Nonces rejects replays within the tolerance window.
+	Nonces ports.NonceStore
+}
+
+// RequestSignatureMiddleware verifies Django's HMAC request signature (see
+// package signing): a known secret, a timestamp within the tolerance and a
+// nonce not seen before.
+func RequestSignatureMiddleware(cfg SignatureConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(cfg.Secrets) == 0 {
+			c.Next()
+			return
+		}
+
+		reject := func(reason string) {
+			log.Printf("Request signature: rejected %s %s (key %s): %s",
+				c.Request.Method, c.FullPath(), c.GetString("service_key_id"), reason)
+			c.AbortWithStatusJSON(401, gin.H{
+				"success": false,
+				"error":   "Invalid request signature",
+				"code":    "INVALID_SIGNATURE",
+			})
+		}
+
+		timestamp := c.GetHeader(signing.HeaderTimestamp)
+		nonce := c.GetHeader(signing.HeaderNonce)
+		sig := signing.ParseSignature(c.GetHeader(signing.HeaderSignature))
+		if timestamp == "" || nonce == "" || len(nonce) > 128 || sig == "" {
+			reject("missing signature headers")
+			return
+		}
+
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			reject("malformed timestamp")
+			return
+		}
+		signedAt := time.Unix(ts, 0)
+		if skew := time.Since(signedAt); skew > cfg.Tolerance || skew < -cfg.Tolerance {
+			reject(fmt.Sprintf("timestamp outside tolerance (%s)", skew.Round(time.Second)))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBody+1))
+		if err != nil {
+			reject("unreadable body")
+			return
+		}
+		if len(body) > maxSignedBody {
+			c.AbortWithStatusJSON(413, gin.H{
+				"success": false,
+				"error":   "Request body too large",
+				"code":    "VALIDATION_ERROR",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !signing.Matches(sig, cfg.Secrets, timestamp, nonce, c.Request.Method, c.Request.URL.RequestURI(), body) {
+			reject("signature mismatch")
+			return
+		}
+
+		// Only a verified nonce is recorded, so forged requests cannot burn nonces
+		fresh, err := cfg.Nonces.UseNonce(c.Request.Context(), nonce, signedAt.Add(cfg.Tolerance))
+		if err != nil {
+			log.Printf("Request signature: failed to record nonce: %v", err)
+			c.AbortWithStatusJSON(503, gin.H{
+				"success": false,
+				"error":   "Could not verify request",
+				"code":    "INTERNAL_ERROR",
+			})
+			return
+		}
+		if !fresh {
+			reject("replayed nonce")
+			return
+		}
 
 		c.Next()
 	}
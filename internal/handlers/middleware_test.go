@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/signing"
+	"github.com/gin-gonic/gin"
+)
+
+// memoryNonces is an in-memory ports.NonceStore.
+type memoryNonces map[string]bool
+
+func (m memoryNonces) UseNonce(_ context.Context, nonce string, _ time.Time) (bool, error) {
+	if m[nonce] {
+		return false, nil
+	}
+	m[nonce] = true
+	return true, nil
+}
+
+func TestServiceAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := []ServiceKey{
+		{ID: "django", Key: "django-key"},
+		{ID: "django-next", Key: "django-next-key"},
+		{ID: "reports", Key: "reports-key", Scopes: []string{ScopeAdmin}},
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantKeyID     string
+	}{
+		{name: "valid key", authorization: "Bearer django-key", wantStatus: http.StatusOK, wantKeyID: "django"},
+		{name: "rotated key", authorization: "Bearer django-next-key", wantStatus: http.StatusOK, wantKeyID: "django-next"},
+		{name: "missing header", wantStatus: http.StatusUnauthorized},
+		{name: "not a bearer token", authorization: "Basic django-key", wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", authorization: "Bearer stolen-key", wantStatus: http.StatusUnauthorized},
+		{name: "key prefix", authorization: "Bearer django", wantStatus: http.StatusUnauthorized},
+		{name: "key without the scope", authorization: "Bearer reports-key", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ServiceAuthMiddleware(keys, ScopePayments))
+			var keyID string
+			router.POST("/api/v1/checkout", func(c *gin.Context) {
+				keyID = c.GetString("service_key_id")
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/checkout", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if keyID != tt.wantKeyID {
+				t.Errorf("key ID = %q, want %q", keyID, tt.wantKeyID)
+			}
+		})
+	}
+}
+
+func TestRequestSignatureMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := []byte(`{"gym_slug":"level-gym"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+
+	sign := func(req *http.Request, secret, timestamp, nonce string, signed []byte) {
+		req.Header.Set(signing.HeaderTimestamp, timestamp)
+		req.Header.Set(signing.HeaderNonce, nonce)
+		req.Header.Set(signing.HeaderSignature, "v1="+
+			signing.Signature(secret, timestamp, nonce, req.Method, req.URL.RequestURI(), signed))
+	}
+
+	tests := []struct {
+		name    string
+		secrets []string
+		// prepare signs the request under test
+		prepare    func(req *http.Request)
+		usedNonces []string
+		wantStatus int
+	}{
+		{
+			name:       "valid",
+			secrets:    []string{"current"},
+			prepare:    func(req *http.Request) { sign(req, "current", now, "nonce-1", body) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "previous secret",
+			secrets:    []string{"next", "current"},
+			prepare:    func(req *http.Request) { sign(req, "current", now, "nonce-1", body) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "verification disabled",
+			prepare:    func(req *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unsigned",
+			secrets:    []string{"current"},
+			prepare:    func(req *http.Request) {},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong secret",
+			secrets:    []string{"current"},
+			prepare:    func(req *http.Request) { sign(req, "other", now, "nonce-1", body) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "tampered body",
+			secrets:    []string{"current"},
+			prepare:    func(req *http.Request) { sign(req, "current", now, "nonce-1", []byte(`{}`)) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "stale timestamp",
+			secrets:    []string{"current"},
+			prepare:    func(req *http.Request) { sign(req, "current", stale, "nonce-1", body) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "replayed nonce",
+			secrets:    []string{"current"},
+			prepare:    func(req *http.Request) { sign(req, "current", now, "nonce-1", body) },
+			usedNonces: []string{"nonce-1"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonces := memoryNonces{}
+			for _, n := range tt.usedNonces {
+				nonces[n] = true
+			}
+
+			router := gin.New()
+			router.Use(RequestSignatureMiddleware(SignatureConfig{
+				Secrets:   tt.secrets,
+				Tolerance: 5 * time.Minute,
+				Nonces:    nonces,
+			}))
+			var handlerBody string
+			router.POST("/api/v1/checkout", func(c *gin.Context) {
+				raw, _ := c.GetRawData()
+				handlerBody = string(raw)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/checkout", bytes.NewReader(body))
+			tt.prepare(req)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			// The verified body is still readable by the handler
+			if w.Code == http.StatusOK && handlerBody != string(body) {
+				t.Errorf("handler read body %q, want %q", handlerBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Package handlers contains the HTTP handlers for Mercado Pago OAuth onboarding.
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/service"
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthHandler handles the Mercado Pago OAuth onboarding of gyms.
+type OAuthHandler struct {
+	service *service.OAuthService
+	// returnURL is where admins land after the callback; "{gym_slug}" is
+	// replaced with the gym's slug.
+	returnURL string
+}
+
+// NewOAuthHandler creates a new OAuth handler.
+func NewOAuthHandler(svc *service.OAuthService, returnURL string) *OAuthHandler {
+	return &OAuthHandler{service: svc, returnURL: returnURL}
+}
+
+// Authorize handles POST /api/v1/admin/gyms/:gym_slug/oauth/authorize
+// Returns the Mercado Pago URL Django redirects the gym admin to.
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	response, err := h.service.Authorize(c.Request.Context(), c.Param("gym_slug"))
+	if err != nil {
+		log.Printf("OAuth Authorize error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.OAuthAuthorization{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Status handles GET /api/v1/admin/gyms/:gym_slug/oauth
+func (h *OAuthHandler) Status(c *gin.Context) {
+	response, err := h.service.Status(c.Request.Context(), c.Param("gym_slug"))
+	if err != nil {
+		log.Printf("OAuth Status error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.OAuthStatus{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Callback handles GET /oauth/mercadopago/callback
+// Mercado Pago redirects the admin's browser here with code and state. The
+// admin is sent back to the gym's return URL with mp_oauth=connected, or
+// mp_oauth=error and the error code; an invalid state gets a plain error.
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	gymSlug, err := h.service.HandleCallback(c.Request.Context(), c.Query("code"), c.Query("state"))
+
+	code := ""
+	if err != nil {
+		code = "OAUTH_EXCHANGE_FAILED"
+		var svcErr *domain.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code != "" {
+			code = svcErr.Code
+		}
+	}
+
+	if gymSlug == "" {
+		status := errorCodeStatus(code)
+		if errors.Is(err, domain.ErrRepositoryError) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   "Mercado Pago authorization failed",
+			"code":    code,
+		})
+		return
+	}
+
+	query := url.Values{"mp_oauth": {"connected"}}
+	if err != nil {
+		query = url.Values{"mp_oauth": {"error"}, "code": {code}}
+	}
+	target := strings.ReplaceAll(h.returnURL, "{gym_slug}", url.PathEscape(gymSlug))
+	separator := "?"
+	if strings.Contains(target, "?") {
+		separator = "&"
+	}
+	c.Redirect(http.StatusFound, target+separator+query.Encode())
+}
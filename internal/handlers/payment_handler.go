@@ -2,8 +2,14 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/fitstack/fitstack-payments/internal/core/domain"
 	"github.com/fitstack/fitstack-payments/internal/core/service"
@@ -13,15 +19,22 @@ import (
 // PaymentHandler handles HTTP requests for payments.
 type PaymentHandler struct {
 	service *service.PaymentService
+	// heartbeat is how often idle event streams get a keep-alive comment
+	heartbeat time.Duration
 }
 
 // NewPaymentHandler creates a new payment handler.
-func NewPaymentHandler(svc *service.PaymentService) *PaymentHandler {
-	return &PaymentHandler{service: svc}
+// heartbeat defaults to 15s when not positive.
+func NewPaymentHandler(svc *service.PaymentService, heartbeat time.Duration) *PaymentHandler {
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	return &PaymentHandler{service: svc, heartbeat: heartbeat}
 }
 
 // CreateCheckout handles POST /api/v1/payments/checkout
 // Creates a Mercado Pago preference with the provided access token.
+// An optional Idempotency-Key header makes retries safe.
 func (h *PaymentHandler) CreateCheckout(c *gin.Context) {
 	var req domain.PaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -33,7 +46,9 @@ func (h *PaymentHandler) CreateCheckout(c *gin.Context) {
 		return
 	}
 
-	response, err := h.service.CreateCheckout(c.Request.Context(), req)
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+
+	response, err := h.service.CreateCheckout(c.Request.Context(), req, idempotencyKey)
 	if err != nil {
 		log.Printf("CreateCheckout error: %v", err)
 		c.JSON(http.StatusInternalServerError, domain.PaymentResponse{
@@ -45,13 +60,214 @@ func (h *PaymentHandler) CreateCheckout(c *gin.Context) {
 	}
 
 	if !response.Success {
-		c.JSON(http.StatusBadRequest, response)
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RefundPayment handles POST /api/v1/payments/:payment_id/refunds
+// Refunds a payment in full, or partially when amount is provided.
+func (h *PaymentHandler) RefundPayment(c *gin.Context) {
+	var req domain.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, domain.RefundResponse{
+			Success:   false,
+			Error:     "Invalid request: " + err.Error(),
+			ErrorCode: "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	response, err := h.service.RefundPayment(c.Request.Context(), c.Param("payment_id"), req)
+	if err != nil {
+		log.Printf("RefundPayment error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.RefundResponse{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// CancelPayment handles POST /api/v1/payments/:payment_id/cancel
+// Cancels a pending or in-process payment.
+func (h *PaymentHandler) CancelPayment(c *gin.Context) {
+	var req domain.CancelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, domain.CancelResponse{
+			Success:   false,
+			Error:     "Invalid request: " + err.Error(),
+			ErrorCode: "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	response, err := h.service.CancelPayment(c.Request.Context(), c.Param("payment_id"), req)
+	if err != nil {
+		log.Printf("CancelPayment error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.CancelResponse{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetPaymentStatus handles GET /api/v1/payments/:gym_slug/:external_reference
+// Returns the latest known payment of an external reference;
+// ?refresh=true fetches it from Mercado Pago first.
+func (h *PaymentHandler) GetPaymentStatus(c *gin.Context) {
+	response, err := h.service.GetPaymentStatus(c.Request.Context(),
+		c.Param("gym_slug"), c.Param("external_reference"), queryBool(c, "refresh"))
+	h.writePaymentStatus(c, response, err)
+}
+
+// GetPaymentStatusByID handles GET /api/v1/payments/:gym_slug/by-payment-id/:payment_id
+// Returns the latest known state of a payment; ?refresh=true fetches it from
+// Mercado Pago first.
+func (h *PaymentHandler) GetPaymentStatusByID(c *gin.Context) {
+	response, err := h.service.GetPaymentStatusByID(c.Request.Context(),
+		c.Param("gym_slug"), c.Param("payment_id"), queryBool(c, "refresh"))
+	h.writePaymentStatus(c, response, err)
+}
+
+// writePaymentStatus writes the result of a payment status query.
+func (h *PaymentHandler) writePaymentStatus(c *gin.Context, response *domain.PaymentStatusResponse, err error) {
+	if err != nil {
+		log.Printf("GetPaymentStatus error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.PaymentStatusResponse{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// queryBool reports whether a query parameter is set to a true value.
+func queryBool(c *gin.Context, name string) bool {
+	value, _ := strconv.ParseBool(c.Query(name))
+	return value
+}
+
+// StreamPaymentEvents handles GET /api/v1/payments/:gym_slug/:external_reference/events
+// Streams the payment's status transitions as Server-Sent Events named
+// "status", starting with its current state when one was recorded.
+func (h *PaymentHandler) StreamPaymentEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+	current, events, unsubscribe, err := h.service.WatchPayment(ctx, c.Param("gym_slug"), c.Param("external_reference"))
+	if err != nil {
+		var svcErr *domain.ServiceError
+		if errors.As(err, &svcErr) && svcErr.Code == "EVENTS_UNAVAILABLE" {
+			c.JSON(errorCodeStatus(svcErr.Code), gin.H{
+				"success":    false,
+				"error":      svcErr.Message,
+				"error_code": svcErr.Code,
+			})
+			return
+		}
+		log.Printf("StreamPaymentEvents error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success":    false,
+			"error":      "Internal server error",
+			"error_code": "INTERNAL_ERROR",
+		})
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if current != nil {
+		c.SSEvent("status", current)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("status", event)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
+
+// GetHistory handles GET /api/v1/payments/:gym_slug/:external_reference/history
+// Returns the ledger of an external reference, including its chargebacks.
+func (h *PaymentHandler) GetHistory(c *gin.Context) {
+	response, err := h.service.GetHistory(c.Request.Context(), c.Param("gym_slug"), c.Param("external_reference"))
+	if err != nil {
+		log.Printf("GetHistory error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.PaymentHistoryResponse{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
 		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// errorCodeStatus maps a response error code to its HTTP status.
+func errorCodeStatus(code string) int {
+	switch code {
+	case "IDEMPOTENCY_CONFLICT", "IDEMPOTENCY_IN_PROGRESS":
+		return http.StatusConflict
+	case "PAYMENT_NOT_FOUND", "SUBSCRIPTION_NOT_FOUND", "GYM_NOT_FOUND":
+		return http.StatusNotFound
+	case "SETTINGS_UNAVAILABLE", "CREDENTIALS_UNAVAILABLE", "OAUTH_NOT_CONFIGURED", "EVENTS_UNAVAILABLE":
+		return http.StatusServiceUnavailable
+	case "REFUND_REJECTED", "PAYMENT_NOT_CANCELLABLE", "SUBSCRIPTION_REJECTED", "GYM_NOT_CONFIGURED":
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 // HandleWebhook handles POST /webhooks/:gym_slug
 // Receives Mercado Pago IPN notifications.
 func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
@@ -67,10 +283,11 @@ func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
 	// Extract security headers
 	xSignature := c.GetHeader("x-signature")
 	xRequestID := c.GetHeader("x-request-id")
+	tenantToken := c.Query("tenant_token")
 
-	// Parse notification body
-	var notification domain.WebhookNotification
-	if err := c.ShouldBindJSON(&notification); err != nil {
+	// Parse notification body, completed from the query string (topic-style IPN)
+	notification, err := parseNotification(c)
+	if err != nil {
 		// MP may send different formats, log and accept
 		log.Printf("Webhook parse error for gym %s: %v", gymSlug, err)
 		c.JSON(http.StatusOK, gin.H{"status": "received"})
@@ -78,19 +295,27 @@ func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
 	}
 
 	// Process the webhook
-	err := h.service.ProcessWebhook(
+	err = h.service.ProcessWebhook(
 		c.Request.Context(),
 		gymSlug,
 		notification,
 		xSignature,
 		xRequestID,
+		tenantToken,
 	)
 
 	if err != nil {
 		log.Printf("Webhook processing error for gym %s: %v", gymSlug, err)
-		// Return 200 to prevent MP from retrying (we log the error)
-		c.JSON(http.StatusOK, gin.H{
-			"status": "processed_with_error",
+		if isPermanentWebhookError(err) {
+			// Return 200 to prevent MP from retrying (we log the error)
+			c.JSON(http.StatusOK, gin.H{
+				"status": "processed_with_error",
+			})
+			return
+		}
+		// Nothing was queued: ask MP to redeliver later
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "retry",
 		})
 		return
 	}
@@ -98,6 +323,57 @@ func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "processed"})
 }
 
+// maxWebhookBody caps the notification body read from Mercado Pago.
+const maxWebhookBody = 1 << 20
+
+// parseNotification reads a notification from the JSON body, which may be
+// empty for topic-style IPN, and fills what the body lacks from the query
+// string: ?topic=merchant_order&id=123 (IPN) or ?type=payment&data.id=123.
+func parseNotification(c *gin.Context) (domain.WebhookNotification, error) {
+	var notification domain.WebhookNotification
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		return notification, err
+	}
+	query := c.Request.URL.Query()
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &notification); err != nil {
+			if query.Get("topic") == "" && query.Get("type") == "" {
+				return notification, err
+			}
+			// Form-encoded or unknown body: rely on the query string alone
+			notification = domain.WebhookNotification{}
+		}
+	}
+
+	if notification.Type == "" {
+		notification.Type = query.Get("type")
+	}
+	if notification.Data.ID == "" {
+		notification.Data.ID = query.Get("data.id")
+	}
+	if notification.Topic == "" {
+		notification.Topic = query.Get("topic")
+	}
+	if notification.Resource == "" && notification.Topic != "" {
+		notification.Resource = query.Get("id")
+	}
+
+	if notification.Type == "" && notification.Topic == "" {
+		return notification, errors.New("notification has no type or topic")
+	}
+	return notification, nil
+}
+
+// isPermanentWebhookError reports whether a redelivery of the same
+// notification would fail again (bad signature, unknown gym).
+func isPermanentWebhookError(err error) bool {
+	return errors.Is(err, domain.ErrWebhookValidationFailed) ||
+		errors.Is(err, domain.ErrGymNotFound) ||
+		errors.Is(err, domain.ErrInvalidRequest)
+}
+
 // Health handles GET /health
 func (h *PaymentHandler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
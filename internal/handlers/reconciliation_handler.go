@@ -0,0 +1,165 @@
+// Package handlers contains the HTTP handlers for payment reconciliation.
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ReconciliationHandler handles admin requests for reconciliation reports.
+type ReconciliationHandler struct {
+	service *service.ReconciliationService
+}
+
+// NewReconciliationHandler creates a new reconciliation handler.
+func NewReconciliationHandler(svc *service.ReconciliationService) *ReconciliationHandler {
+	return &ReconciliationHandler{service: svc}
+}
+
+// reconcileRequest is the optional body of POST /api/v1/admin/gyms/:gym_slug/reconcile.
+type reconcileRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Reconcile handles POST /api/v1/admin/gyms/:gym_slug/reconcile
+// Runs a reconciliation now, over the configured window unless from/to are given.
+func (h *ReconciliationHandler) Reconcile(c *gin.Context) {
+	var req reconcileRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request: " + err.Error(),
+				"code":    "VALIDATION_ERROR",
+			})
+			return
+		}
+	}
+
+	report, err := h.service.ReconcileGym(c.Request.Context(), c.Param("gym_slug"), req.From, req.To)
+	if err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// ListReports handles GET /api/v1/admin/reconciliation/reports
+// Query params: gym_slug, limit.
+func (h *ReconciliationHandler) ListReports(c *gin.Context) {
+	filter := domain.ReconciliationFilter{GymSlug: c.Query("gym_slug")}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "limit must be between 1 and 500",
+				"code":    "VALIDATION_ERROR",
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	reports, err := h.service.ListReports(c.Request.Context(), filter)
+	if err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"reports": reports,
+	})
+}
+
+// GetReport handles GET /api/v1/admin/reconciliation/reports/:id
+// With format=csv the discrepancies are downloaded as a spreadsheet.
+func (h *ReconciliationHandler) GetReport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "invalid report id",
+			"code":    "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	report, err := h.service.GetReport(c.Request.Context(), id)
+	if err != nil {
+		respondReconciliationError(c, err)
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		writeReportCSV(c, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"report":  report,
+	})
+}
+
+// writeReportCSV writes a report's discrepancies as a CSV attachment.
+func writeReportCSV(c *gin.Context, report *domain.ReconciliationReport) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="reconciliation-%s-%d.csv"`, report.GymSlug, report.ID))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"kind", "payment_id", "external_reference", "mp_status", "recorded_status",
+		"amount", "currency", "action", "detail"})
+	for _, d := range report.Discrepancies {
+		_ = w.Write([]string{d.Kind, d.PaymentID, d.ExternalReference, d.MPStatus, d.RecordedStatus,
+			d.Amount.String(), d.Currency, d.Action, d.Detail})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Failed to write reconciliation report %d as CSV: %v", report.ID, err)
+	}
+}
+
+// respondReconciliationError writes the error response for a reconciliation service error.
+func respondReconciliationError(c *gin.Context, err error) {
+	var svcErr *domain.ServiceError
+	switch {
+	case errors.Is(err, domain.ErrReportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "report not found",
+			"code":    "REPORT_NOT_FOUND",
+		})
+		return
+	case errors.Is(err, domain.ErrInvalidRequest) && errors.As(err, &svcErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   svcErr.Message,
+			"code":    svcErr.Code,
+		})
+		return
+	}
+
+	log.Printf("Reconciliation admin error: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"error":   "Internal server error",
+		"code":    "INTERNAL_ERROR",
+	})
+}
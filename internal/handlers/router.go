@@ -6,7 +6,17 @@ import (
 )
 
 // SetupRouter configures the Gin router with all routes.
-func SetupRouter(handler *PaymentHandler, ginMode string) *gin.Engine {
+func SetupRouter(
+	handler *PaymentHandler,
+	subscriptionHandler *SubscriptionHandler,
+	deliveryHandler *DeliveryHandler,
+	credentialHandler *CredentialHandler,
+	oauthHandler *OAuthHandler,
+	reconciliationHandler *ReconciliationHandler,
+	serviceKeys []ServiceKey,
+	signature SignatureConfig,
+	ginMode string,
+) *gin.Engine {
 	gin.SetMode(ginMode)
 
 	router := gin.New()
@@ -18,18 +28,51 @@ func SetupRouter(handler *PaymentHandler, ginMode string) *gin.Engine {
 	// Health check (public)
 	router.GET("/health", handler.Health)
 
-	// API v1 routes (requires Bearer auth)
+	// API v1 routes (requires Bearer auth; Django routes are also HMAC-signed)
 	v1 := router.Group("/api/v1")
 	{
 		payments := v1.Group("/payments")
-		payments.Use(ServiceAuthMiddleware())
+		payments.Use(ServiceAuthMiddleware(serviceKeys, ScopePayments), RequestSignatureMiddleware(signature))
 		{
 			payments.POST("/checkout", handler.CreateCheckout)
+			payments.POST("/:payment_id/refunds", handler.RefundPayment)
+			payments.POST("/:payment_id/cancel", handler.CancelPayment)
+			payments.GET("/:gym_slug/:external_reference", handler.GetPaymentStatus)
+			payments.GET("/:gym_slug/:external_reference/history", handler.GetHistory)
+			payments.GET("/:gym_slug/:external_reference/events", handler.StreamPaymentEvents)
+			payments.GET("/:gym_slug/by-payment-id/:payment_id", handler.GetPaymentStatusByID)
+		}
+
+		subscriptions := v1.Group("/subscriptions")
+		subscriptions.Use(ServiceAuthMiddleware(serviceKeys, ScopeSubscriptions), RequestSignatureMiddleware(signature))
+		{
+			subscriptions.POST("", subscriptionHandler.CreateSubscription)
+			subscriptions.POST("/plans", subscriptionHandler.CreatePlan)
+			subscriptions.POST("/:subscription_id/pause", subscriptionHandler.PauseSubscription)
+			subscriptions.POST("/:subscription_id/resume", subscriptionHandler.ResumeSubscription)
+			subscriptions.POST("/:subscription_id/cancel", subscriptionHandler.CancelSubscription)
+		}
+
+		admin := v1.Group("/admin")
+		admin.Use(ServiceAuthMiddleware(serviceKeys, ScopeAdmin))
+		{
+			admin.GET("/deliveries", deliveryHandler.ListDeliveries)
+			admin.POST("/deliveries/redeliver", deliveryHandler.RedeliverMany)
+			admin.POST("/deliveries/:id/redeliver", deliveryHandler.RedeliverOne)
+			admin.POST("/gyms/:gym_slug/credentials/invalidate", credentialHandler.InvalidateCredentials)
+			admin.POST("/gyms/:gym_slug/oauth/authorize", oauthHandler.Authorize)
+			admin.GET("/gyms/:gym_slug/oauth", oauthHandler.Status)
+			admin.POST("/gyms/:gym_slug/reconcile", reconciliationHandler.Reconcile)
+			admin.GET("/reconciliation/reports", reconciliationHandler.ListReports)
+			admin.GET("/reconciliation/reports/:id", reconciliationHandler.GetReport)
 		}
 	}
 
 	// Webhook endpoint (public, validates x-signature)
 	router.POST("/webhooks/:gym_slug", handler.HandleWebhook)
 
+	// Mercado Pago OAuth redirect (public, validates the signed state)
+	router.GET("/oauth/mercadopago/callback", oauthHandler.Callback)
+
 	return router
 }
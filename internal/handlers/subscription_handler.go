@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/fitstack/fitstack-payments/internal/core/domain"
+	"github.com/fitstack/fitstack-payments/internal/core/service"
+	"github.com/gin-gonic/gin"
+)
+
+// SubscriptionHandler handles HTTP requests for recurring memberships.
+type SubscriptionHandler struct {
+	service *service.SubscriptionService
+}
+
+// NewSubscriptionHandler creates a new subscription handler.
+func NewSubscriptionHandler(svc *service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{service: svc}
+}
+
+// CreatePlan handles POST /api/v1/subscriptions/plans
+// Creates a Mercado Pago preapproval plan.
+func (h *SubscriptionHandler) CreatePlan(c *gin.Context) {
+	var req domain.SubscriptionPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     "Invalid request: " + err.Error(),
+			ErrorCode: "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	response, err := h.service.CreatePlan(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("CreatePlan error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.SubscriptionPlanResponse{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// CreateSubscription handles POST /api/v1/subscriptions
+// Subscribes a member to a plan or to an ad-hoc recurrence.
+func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
+	var req domain.SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Invalid request: " + err.Error(),
+			ErrorCode: "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	response, err := h.service.CreateSubscription(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("CreateSubscription error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// PauseSubscription handles POST /api/v1/subscriptions/:subscription_id/pause
+func (h *SubscriptionHandler) PauseSubscription(c *gin.Context) {
+	h.updateStatus(c, domain.SubscriptionPaused)
+}
+
+// ResumeSubscription handles POST /api/v1/subscriptions/:subscription_id/resume
+func (h *SubscriptionHandler) ResumeSubscription(c *gin.Context) {
+	h.updateStatus(c, domain.SubscriptionAuthorized)
+}
+
+// CancelSubscription handles POST /api/v1/subscriptions/:subscription_id/cancel
+func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
+	h.updateStatus(c, domain.SubscriptionCancelled)
+}
+
+// updateStatus moves a subscription to the given MP status.
+func (h *SubscriptionHandler) updateStatus(c *gin.Context, status string) {
+	var req domain.SubscriptionActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Invalid request: " + err.Error(),
+			ErrorCode: "VALIDATION_ERROR",
+		})
+		return
+	}
+
+	response, err := h.service.UpdateSubscriptionStatus(c.Request.Context(), c.Param("subscription_id"), status, req)
+	if err != nil {
+		log.Printf("UpdateSubscriptionStatus error: %v", err)
+		c.JSON(http.StatusInternalServerError, domain.SubscriptionResponse{
+			Success:   false,
+			Error:     "Internal server error",
+			ErrorCode: "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	if !response.Success {
+		c.JSON(errorCodeStatus(response.ErrorCode), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
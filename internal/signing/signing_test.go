@@ -0,0 +1,124 @@
+package signing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerSign(t *testing.T) {
+	body := []byte(`{"event":"payment.approved","payment_id":"100"}`)
+
+	tests := []struct {
+		name    string
+		secrets []string
+		method  string
+		path    string
+		body    []byte
+		nonce   string
+		want    bool
+	}{
+		{name: "valid", secrets: []string{"current"}, want: true},
+		{name: "previous secret during rotation", secrets: []string{"next", "current"}, want: true},
+		{name: "unknown secret", secrets: []string{"other"}},
+		{name: "no secrets"},
+		{name: "method changed", secrets: []string{"current"}, method: http.MethodPut},
+		{name: "path changed", secrets: []string{"current"}, path: "/api/payments/webhook/?gym=other"},
+		{name: "body changed", secrets: []string{"current"}, body: []byte(`{"event":"payment.approved","payment_id":"101"}`)},
+		{name: "nonce changed", secrets: []string{"current"}, nonce: "other-nonce"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook/?gym=level-gym", nil)
+			signer := NewSigner("current")
+			signer.now = func() time.Time { return time.Unix(1768473000, 0) }
+			signer.Sign(req, body)
+
+			if got := req.Header.Get(HeaderTimestamp); got != "1768473000" {
+				t.Errorf("timestamp header = %q, want 1768473000", got)
+			}
+			sig := ParseSignature(req.Header.Get(HeaderSignature))
+			if sig == "" {
+				t.Fatalf("signature header = %q, want a v1 signature", req.Header.Get(HeaderSignature))
+			}
+
+			method, path, signedBody, nonce := req.Method, req.URL.RequestURI(), body, req.Header.Get(HeaderNonce)
+			if tt.method != "" {
+				method = tt.method
+			}
+			if tt.path != "" {
+				path = tt.path
+			}
+			if tt.body != nil {
+				signedBody = tt.body
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			got := Matches(sig, tt.secrets, req.Header.Get(HeaderTimestamp), nonce, method, path, signedBody)
+			if got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignerDisabled(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook/", nil)
+	NewSigner("").Sign(req, []byte("{}"))
+
+	for _, header := range []string{HeaderTimestamp, HeaderNonce, HeaderSignature} {
+		if got := req.Header.Get(header); got != "" {
+			t.Errorf("%s = %q, want no header", header, got)
+		}
+	}
+}
+
+func TestSignerUniqueNonces(t *testing.T) {
+	signer := NewSigner("current")
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook/", nil)
+		signer.Sign(req, nil)
+		nonce := req.Header.Get(HeaderNonce)
+		if seen[nonce] {
+			t.Fatalf("nonce %q reused", nonce)
+		}
+		seen[nonce] = true
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "v1=abc123", want: "abc123"},
+		{header: "v2=abc123", want: ""},
+		{header: "abc123", want: ""},
+		{header: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := ParseSignature(tt.header); got != tt.want {
+				t.Errorf("ParseSignature(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignatureMethodCase(t *testing.T) {
+	lower := Signature("current", "1768473000", "n", "post", "/x", nil)
+	upper := Signature("current", "1768473000", "n", "POST", "/x", nil)
+	if lower != upper {
+		t.Errorf("signature depends on method case")
+	}
+	if strings.ToLower(upper) != upper || len(upper) != 64 {
+		t.Errorf("signature %q is not lowercase hex SHA-256", upper)
+	}
+}